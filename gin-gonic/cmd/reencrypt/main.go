@@ -0,0 +1,55 @@
+// Command reencrypt mengenkripsi ulang kolom PII users, login_events dan user_identities
+// dengan key aktif (FIELD_ENCRYPTION_KEY_ID) dan menghitung ulang blind index email.
+// Dijalankan setelah menambah key baru, sebelum key lama dihapus dari FIELD_ENCRYPTION_KEYS:
+//
+//	go run ./cmd/reencrypt -batch 500
+//
+// Aman dijalankan saat API berjalan dan bisa diulang jika terhenti.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"gin-gonic/helper"
+	"gin-gonic/modules/users"
+	"gin-gonic/utils"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 500, "jumlah user per batch")
+	flag.Parse()
+
+	config, err := helper.LoadConfig(".")
+	if err != nil {
+		log.Fatal("Cannot load config:", err)
+	}
+
+	fieldKeys, err := utils.LoadFieldKeyRing(utils.FieldKeyConfig{
+		Keys:          config.FieldEncryptionKeys,
+		ActiveKeyID:   config.FieldEncryptionKeyID,
+		BlindIndexKey: config.BlindIndexKey,
+		DevMode:       config.DevMode == "Y",
+	})
+	if err != nil {
+		log.Fatal("Cannot load field encryption keys:", err)
+	}
+	utils.SetFieldKeyRing(fieldKeys)
+
+	db := helper.OpenDb(config.DB, config.Schema, "v1")
+	if db == nil {
+		log.Fatal("Failed to connect to database")
+	}
+
+	updated, err := users.ReencryptUsers(db, *batchSize)
+	if err != nil {
+		log.Fatalf("Re-encryption stopped after %d users: %v", updated, err)
+	}
+	log.Printf("Re-encryption finished, %d users updated", updated)
+
+	updated, err = users.ReencryptEmails(db, *batchSize)
+	if err != nil {
+		log.Fatalf("Re-encryption of login event and identity emails stopped after %d rows: %v", updated, err)
+	}
+	log.Printf("Re-encryption finished, %d login events and identities updated", updated)
+}
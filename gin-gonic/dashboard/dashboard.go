@@ -0,0 +1,36 @@
+package dashboard
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+var indexTemplate = template.Must(template.ParseFS(staticFiles, "static/index.html"))
+
+// Register memasang dashboard admin di /admin/dashboard.
+// apiPrefix adalah prefix route API (misal "api/v1") yang dipanggil oleh dashboard.
+func Register(router *middlewares.Router, apiPrefix string) {
+	assets, err := fs.Sub(staticFiles, "static/assets")
+	if err != nil {
+		log.Fatal("Cannot load dashboard assets:", err)
+	}
+
+	router.GET("/admin/dashboard", middlewares.Public(), func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Header("Cache-Control", "no-store")
+		if err := indexTemplate.Execute(c.Writer, gin.H{"APIPrefix": "/" + apiPrefix}); err != nil {
+			c.Status(http.StatusInternalServerError)
+		}
+	})
+	router.StaticFS("/admin/dashboard/assets", http.FS(assets), middlewares.Public())
+}
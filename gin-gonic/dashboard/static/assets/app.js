@@ -0,0 +1,388 @@
+(function () {
+    "use strict";
+
+    var API = document.body.dataset.api;
+    var MAX_POINTS = 60;
+    var MAX_ACTIVITY = 50;
+
+    var state = {
+        token: sessionStorage.getItem("dashboard_token"),
+        refreshToken: sessionStorage.getItem("dashboard_refresh_token"),
+        permissions: JSON.parse(sessionStorage.getItem("dashboard_permissions") || "[]"),
+        ws: null,
+        reconnectTimer: null,
+        refreshing: null,
+        challenge: null,
+        series: []
+    };
+
+    function $(id) { return document.getElementById(id); }
+
+    // Permission yang sama dengan yang dicek server (lihat roles.Perm*)
+    function can(code) { return state.permissions.indexOf(code) !== -1; }
+
+    function api(method, path, body, retried) {
+        var opts = { method: method, headers: { "Content-Type": "application/json" } };
+        if (state.token) {
+            opts.headers["Authorization"] = "Bearer " + state.token;
+        }
+        if (body) {
+            opts.body = JSON.stringify(body);
+        }
+        return fetch(path, opts).then(function (res) {
+            return res.json().then(function (data) {
+                // Access token berumur pendek: coba refresh sekali lalu ulangi request
+                if (res.status === 401 && !retried && state.refreshToken) {
+                    return refresh().then(function () {
+                        return api(method, path, body, true);
+                    });
+                }
+                if (res.status === 401 && state.token) {
+                    logout();
+                }
+                if (!res.ok) {
+                    throw new Error(data.error || data.message || res.statusText);
+                }
+                return data;
+            });
+        });
+    }
+
+    // ---------------------------------------------------------------
+    // Login / logout
+    // ---------------------------------------------------------------
+
+    // Hasil true berarti login selesai, false berarti masih menunggu kode 2FA
+    function login(email, password) {
+        return api("POST", API + "/auth/login", { email: email, password: password }).then(function (data) {
+            if (data.two_factor_required) {
+                return showTwoFactor(data);
+            }
+            return finishLogin(data);
+        });
+    }
+
+    function finishLogin(data) {
+        if (!data.permissions || data.permissions.indexOf("loans:read") === -1) {
+            throw new Error("Akun ini tidak memiliki akses ke data peminjaman");
+        }
+        setTokens(data);
+        if (data.recovery_codes && data.recovery_codes.length) {
+            window.alert("Simpan recovery code berikut di tempat aman:\n\n" + data.recovery_codes.join("\n"));
+        }
+        return true;
+    }
+
+    function showTwoFactor(data) {
+        state.challenge = data.challenge_token;
+        $("login-form").hidden = true;
+        $("twofa-form").hidden = false;
+        $("twofa-code").value = "";
+        $("twofa-setup").hidden = !data.setup_required;
+        if (!data.setup_required) {
+            return false;
+        }
+        return api("POST", API + "/auth/2fa/setup", { challenge_token: data.challenge_token }).then(function (setup) {
+            $("twofa-qr").src = setup.qr_code;
+            $("twofa-secret").textContent = setup.secret;
+            return false;
+        });
+    }
+
+    function verifyTwoFactor(code) {
+        return api("POST", API + "/auth/2fa", { challenge_token: state.challenge, code: code }).then(function (data) {
+            state.challenge = null;
+            return finishLogin(data);
+        });
+    }
+
+    function setTokens(data) {
+        state.token = data.token;
+        state.refreshToken = data.refresh_token;
+        sessionStorage.setItem("dashboard_token", data.token);
+        sessionStorage.setItem("dashboard_refresh_token", data.refresh_token);
+        // Permission terbaru ikut dikirim setiap refresh token
+        state.permissions = data.permissions || [];
+        sessionStorage.setItem("dashboard_permissions", JSON.stringify(state.permissions));
+    }
+
+    // Request paralel yang sama-sama mendapat 401 memakai satu proses refresh,
+    // karena refresh token hanya bisa dipakai sekali (rotasi)
+    function refresh() {
+        if (!state.refreshing) {
+            state.refreshing = api("POST", API + "/auth/refresh", { refresh_token: state.refreshToken }, true)
+                .then(setTokens)
+                .finally(function () { state.refreshing = null; });
+        }
+        return state.refreshing;
+    }
+
+    function logout() {
+        if (state.token && state.refreshToken) {
+            api("POST", API + "/auth/logout", { refresh_token: state.refreshToken }, true).catch(function () {});
+        }
+        state.token = null;
+        state.refreshToken = null;
+        state.permissions = [];
+        sessionStorage.removeItem("dashboard_token");
+        sessionStorage.removeItem("dashboard_refresh_token");
+        sessionStorage.removeItem("dashboard_permissions");
+        if (state.ws) {
+            state.ws.onclose = null;
+            state.ws.close();
+            state.ws = null;
+        }
+        clearTimeout(state.reconnectTimer);
+        showLogin();
+    }
+
+    function showLogin() {
+        state.challenge = null;
+        $("login-form").hidden = false;
+        $("twofa-form").hidden = true;
+        $("login-panel").hidden = false;
+        $("dashboard").hidden = true;
+        $("logout").hidden = true;
+        setWsStatus(false);
+    }
+
+    function showDashboard() {
+        $("login-panel").hidden = true;
+        $("dashboard").hidden = false;
+        $("logout").hidden = false;
+        loadInitialData();
+        connectWs();
+    }
+
+    // ---------------------------------------------------------------
+    // Data awal dari endpoint stats
+    // ---------------------------------------------------------------
+
+    // Panel yang permission-nya tidak dimiliki tidak dimuat
+    function loadInitialData() {
+        if (can("stats:read")) {
+            api("GET", API + "/admin/books/stats").then(renderLoanStats).catch(console.error);
+            loadUserStats();
+        }
+        api("GET", API + "/admin/loans").then(function (res) {
+            var loans = (res.data || []).slice().sort(function (a, b) {
+                return new Date(b.updated_at) - new Date(a.updated_at);
+            }).slice(0, 20).reverse();
+            $("activity").textContent = "";
+            loans.forEach(function (loan) {
+                addActivity({
+                    action: loan.status === "returned" ? "return" : "borrow",
+                    loan_id: loan.id,
+                    user_id: loan.user_id,
+                    book_id: loan.book_id,
+                    user: loan.user && loan.user.name,
+                    book: loan.book && loan.book.title,
+                    time: loan.updated_at
+                });
+            });
+        }).catch(console.error);
+    }
+
+    function loadUserStats() {
+        api("GET", API + "/admin/users/stats").then(function (stats) {
+            $("stat-users").textContent = stats.total_users;
+            $("stat-new-users").textContent = stats.new_users_today;
+            var list = $("latest-users");
+            list.textContent = "";
+            (stats.latest_users || []).forEach(function (u) {
+                var li = document.createElement("li");
+                li.textContent = u.name + " <" + u.email + ">";
+                list.appendChild(li);
+            });
+        }).catch(console.error);
+    }
+
+    function renderLoanStats(stats) {
+        $("stat-total").textContent = stats.total_transactions;
+        $("stat-borrowed").textContent = stats.currently_borrowed;
+        $("stat-returned").textContent = stats.returned_books;
+        state.series.push({ time: new Date(), value: stats.currently_borrowed });
+        if (state.series.length > MAX_POINTS) {
+            state.series.shift();
+        }
+        drawChart();
+    }
+
+    // ---------------------------------------------------------------
+    // WebSocket
+    // ---------------------------------------------------------------
+
+    function setWsStatus(online) {
+        var el = $("ws-status");
+        el.textContent = "WebSocket: " + (online ? "online" : "offline");
+        el.className = "badge " + (online ? "on" : "off");
+    }
+
+    function connectWs() {
+        api("POST", "/ws/ticket").then(function (res) {
+            var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+            var ws = new WebSocket(scheme + location.host + "/ws?ticket=" + encodeURIComponent(res.ticket));
+            state.ws = ws;
+
+            ws.onopen = function () { setWsStatus(true); };
+            ws.onmessage = function (event) { handleMessage(JSON.parse(event.data)); };
+            ws.onclose = function (event) {
+                setWsStatus(false);
+                // 4001 = token expired: refresh lalu sambung ulang
+                if (event.code === 4001 && state.refreshToken) {
+                    refresh().then(connectWs).catch(console.error);
+                    return;
+                }
+                // 4003 = sesi dicabut: wajib login ulang
+                if (event.code === 4001 || event.code === 4003) {
+                    logout();
+                    $("login-error").textContent = "Sesi berakhir: " + event.reason;
+                    return;
+                }
+                state.reconnectTimer = setTimeout(connectWs, 3000);
+            };
+        }).catch(function (err) {
+            console.error(err);
+            if (state.token) {
+                state.reconnectTimer = setTimeout(connectWs, 5000);
+            }
+        });
+    }
+
+    function handleMessage(msg) {
+        switch (msg.type) {
+            case "STATS_UPDATE":
+                renderLoanStats(msg.data);
+                break;
+            case "LOAN_EVENT":
+                addActivity(msg.data, true);
+                break;
+            case "PRESENCE":
+                renderPresence(msg.data);
+                break;
+        }
+    }
+
+    function addActivity(event, prepend) {
+        var li = document.createElement("li");
+        var time = document.createElement("span");
+        time.className = "time";
+        time.textContent = new Date(event.time).toLocaleTimeString();
+        var tag = document.createElement("span");
+        tag.className = event.action === "return" ? "tag-return" : "tag-borrow";
+        tag.textContent = event.action === "return" ? "RETURN" : "BORROW";
+        var text = document.createElement("span");
+        text.textContent = " loan #" + event.loan_id +
+            " — user " + (event.user || "#" + event.user_id) +
+            ", buku " + (event.book || "#" + event.book_id);
+
+        li.appendChild(time);
+        li.appendChild(tag);
+        li.appendChild(text);
+
+        var list = $("activity");
+        list.insertBefore(li, list.firstChild);
+        while (list.children.length > MAX_ACTIVITY) {
+            list.removeChild(list.lastChild);
+        }
+    }
+
+    function renderPresence(data) {
+        $("stat-connections").textContent = data.connections;
+        var list = $("connected");
+        list.textContent = "";
+        (data.user_ids || []).forEach(function (id) {
+            var li = document.createElement("li");
+            li.textContent = "User #" + id;
+            list.appendChild(li);
+        });
+    }
+
+    // ---------------------------------------------------------------
+    // Chart sederhana berbasis canvas
+    // ---------------------------------------------------------------
+
+    function drawChart() {
+        var canvas = $("chart");
+        var ctx = canvas.getContext("2d");
+        var w = canvas.width, h = canvas.height, pad = 30;
+        ctx.clearRect(0, 0, w, h);
+
+        var points = state.series;
+        if (points.length === 0) {
+            return;
+        }
+
+        var max = Math.max.apply(null, points.map(function (p) { return p.value; }).concat([1]));
+        var stepX = points.length > 1 ? (w - pad * 2) / (points.length - 1) : 0;
+
+        ctx.strokeStyle = "#e5e7eb";
+        ctx.fillStyle = "#6b7280";
+        ctx.font = "11px sans-serif";
+        for (var i = 0; i <= 4; i++) {
+            var y = h - pad - (h - pad * 2) * i / 4;
+            ctx.beginPath();
+            ctx.moveTo(pad, y);
+            ctx.lineTo(w - pad, y);
+            ctx.stroke();
+            ctx.fillText(Math.round(max * i / 4), 4, y + 4);
+        }
+
+        ctx.strokeStyle = "#2563eb";
+        ctx.lineWidth = 2;
+        ctx.beginPath();
+        points.forEach(function (p, idx) {
+            var x = pad + stepX * idx;
+            var y = h - pad - (h - pad * 2) * p.value / max;
+            if (idx === 0) {
+                ctx.moveTo(x, y);
+            } else {
+                ctx.lineTo(x, y);
+            }
+        });
+        ctx.stroke();
+        ctx.lineWidth = 1;
+
+        ctx.fillStyle = "#6b7280";
+        ctx.fillText(points[0].time.toLocaleTimeString(), pad, h - 8);
+        var last = points[points.length - 1].time.toLocaleTimeString();
+        ctx.fillText(last, w - pad - ctx.measureText(last).width, h - 8);
+    }
+
+    // ---------------------------------------------------------------
+
+    $("login-form").addEventListener("submit", function (e) {
+        e.preventDefault();
+        $("login-error").textContent = "";
+        login($("email").value, $("password").value).then(function (done) {
+            if (done) {
+                showDashboard();
+            }
+        }).catch(function (err) {
+            $("login-error").textContent = err.message;
+        });
+    });
+    $("twofa-form").addEventListener("submit", function (e) {
+        e.preventDefault();
+        $("login-error").textContent = "";
+        verifyTwoFactor($("twofa-code").value.trim()).then(showDashboard).catch(function (err) {
+            $("login-error").textContent = err.message;
+        });
+    });
+    $("logout").addEventListener("click", logout);
+
+    // Refresh statistik user secara berkala karena tidak ada event NATS untuk registrasi
+    setInterval(function () {
+        if (state.token && can("stats:read")) {
+            loadUserStats();
+        }
+    }, 60000);
+
+    if (state.token && can("loans:read")) {
+        showDashboard();
+    } else if (state.token) {
+        logout();
+    } else {
+        showLogin();
+    }
+})();
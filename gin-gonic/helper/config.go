@@ -1,6 +1,8 @@
 package helper
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +15,23 @@ type Config struct {
 	DB        string `mapstructure:"DB"`
 	JWTSecret string `mapstructure:"JWT_SECRET"`
 
+	// Key JWT tambahan "kid:ALG:path" dipisah koma (HS256, RS256, EdDSA)
+	JWTKeys         string `mapstructure:"JWT_KEYS"`
+	JWTSigningKeyID string `mapstructure:"JWT_SIGNING_KEY_ID"`
+
+	// Enkripsi field PII (AES-256-GCM): "kid:base64key" dipisah koma, key aktif, dan key blind index
+	FieldEncryptionKeys  string `mapstructure:"FIELD_ENCRYPTION_KEYS"`
+	FieldEncryptionKeyID string `mapstructure:"FIELD_ENCRYPTION_KEY_ID"`
+	BlindIndexKey        string `mapstructure:"BLIND_INDEX_KEY"`
+
+	// Masa berlaku token, format durasi Go (contoh: 15m, 720h)
+	AccessTokenTTL  time.Duration `mapstructure:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `mapstructure:"REFRESH_TOKEN_TTL"`
+	// Masa berlaku token impersonate admin (default 15m)
+	ImpersonationTTL time.Duration `mapstructure:"IMPERSONATION_TTL"`
+	// Masa berlaku token kiosk hasil login kartu anggota + PIN (default 5m)
+	KioskTokenTTL time.Duration `mapstructure:"KIOSK_TOKEN_TTL"`
+
 	// Admin Seeding Configuration
 	ADMIN_EMAIL   string `mapstructure:"ADMIN_EMAIL"`
 	AdminPassword string `mapstructure:"ADMIN_PASSWORD"`
@@ -27,8 +46,63 @@ type Config struct {
 	LOG_FILE     string `mapstructure:"LOG_FILE"`
 	AUTO_MIGRATE string `mapstructure:"AUTO_MIGRATE"`
 
+	// DEV_MODE=Y mengizinkan secret JWT dan key enkripsi development serta mailer memori jika
+	// tidak dikonfigurasi. Tanpa DEV_MODE aplikasi berhenti saat key atau MAIL_DRIVER kosong.
+	// JANGAN diaktifkan di production!
+	DevMode string `mapstructure:"DEV_MODE"`
+
 	//nats 
 	NatsUrl   string `mapstructure:"NATS_URL"`
+
+	// WebSocket: daftar origin yang diizinkan, dipisah koma
+	WSAllowedOrigins string `mapstructure:"WS_ALLOWED_ORIGINS"`
+
+	// Mailer: MAIL_DRIVER = smtp | file | memory
+	MailDriver   string `mapstructure:"MAIL_DRIVER"`
+	MailFrom     string `mapstructure:"MAIL_FROM"`
+	MailFileDir  string `mapstructure:"MAIL_FILE_DIR"`
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     string `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+
+	// Halaman frontend untuk reset password, token ditambahkan sebagai ?token=
+	PasswordResetURL string `mapstructure:"PASSWORD_RESET_URL"`
+	// URL endpoint GET /auth/verify yang dikirim di email verifikasi
+	EmailVerifyURL string `mapstructure:"EMAIL_VERIFY_URL"`
+	// Halaman frontend untuk konfirmasi hapus akun, token ditambahkan sebagai ?token=
+	AccountDeletionURL string `mapstructure:"ACCOUNT_DELETION_URL"`
+	// Halaman frontend untuk persetujuan undangan wali, token ditambahkan sebagai ?token=
+	GuardianInviteURL string `mapstructure:"GUARDIAN_INVITE_URL"`
+
+	// 2FA: ADMIN_REQUIRE_2FA=Y mewajibkan TOTP untuk role admin
+	Admin2FARequired string `mapstructure:"ADMIN_REQUIRE_2FA"`
+	TOTPIssuer       string `mapstructure:"TOTP_ISSUER"`
+
+	// Path file JSON berisi daftar provider OIDC, lihat oidc.example.json
+	OIDCConfig string `mapstructure:"OIDC_CONFIG"`
+
+	// Hash password: argon2id (default) atau bcrypt. Hash lama di-upgrade saat login.
+	PasswordHashAlgo string `mapstructure:"PASSWORD_HASH_ALGO"`
+	Argon2Memory     uint32 `mapstructure:"ARGON2_MEMORY"` // KiB
+	Argon2Time       uint32 `mapstructure:"ARGON2_TIME"`
+	Argon2Threads    uint8  `mapstructure:"ARGON2_THREADS"`
+	BcryptCost       int    `mapstructure:"BCRYPT_COST"`
+
+	// Password policy (Y untuk mengaktifkan aturan)
+	PasswordMinLength     int    `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordRequireUpper  string `mapstructure:"PASSWORD_REQUIRE_UPPER"`
+	PasswordRequireLower  string `mapstructure:"PASSWORD_REQUIRE_LOWER"`
+	PasswordRequireDigit  string `mapstructure:"PASSWORD_REQUIRE_DIGIT"`
+	PasswordRequireSymbol string `mapstructure:"PASSWORD_REQUIRE_SYMBOL"`
+	PasswordAllowCommon   string `mapstructure:"PASSWORD_ALLOW_COMMON"`
+
+	// Zona waktu perpustakaan untuk menghitung umur peminjam, contoh "Asia/Jakarta"
+	LibraryTimezone string `mapstructure:"LIBRARY_TIMEZONE"`
+	// Umur minimal akun dewasa, user di bawahnya dapat dihubungkan ke akun wali (default 18)
+	AgeOfMajority int `mapstructure:"AGE_OF_MAJORITY"`
+	// Jumlah hari sebelum keanggotaan berakhir untuk mengirim email pengingat (default 14)
+	MembershipWarningDays int `mapstructure:"MEMBERSHIP_WARNING_DAYS"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -0,0 +1,178 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mail adalah email teks sederhana yang dikirim aplikasi
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer mengirim email. Implementasi dipilih lewat MAIL_DRIVER.
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// NewMailer membuat Mailer sesuai config: "smtp" memakai SMTP_*, "file" menulis ke
+// MAIL_FILE_DIR, "memory" menyimpan di memori. MAIL_DRIVER kosong hanya diizinkan dengan
+// DEV_MODE=Y (memakai memori) agar email reset password dan verifikasi tidak hilang diam-diam.
+func NewMailer(config Config) (Mailer, error) {
+	switch strings.ToLower(config.MailDriver) {
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, errors.New("MAIL_DRIVER=smtp requires SMTP_HOST")
+		}
+		return &SMTPMailer{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.MailFrom,
+		}, nil
+	case "file":
+		dir := config.MailFileDir
+		if dir == "" {
+			dir = "mails"
+		}
+		return &FileMailer{Dir: dir, From: config.MailFrom}, nil
+	case "memory":
+		log.Println("MAIL_DRIVER=memory, emails are kept in memory only")
+		return NewMemoryMailer(), nil
+	case "":
+		if config.DevMode != "Y" {
+			return nil, errors.New("MAIL_DRIVER is required (smtp, file or memory)")
+		}
+		log.Println("⚠️ MAIL_DRIVER kosong, email hanya disimpan di memori karena DEV_MODE=Y")
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", config.MailDriver)
+	}
+}
+
+// Kebijakan pengiriman notifikasi background (pengingat keanggotaan, keterlambatan pinjaman):
+// baris diklaim dengan update bersyarat sebelum email dikirim sehingga beberapa instance tidak
+// mengirim email yang sama. Klaim berlaku MailClaimLease; jika instance mati sebelum selesai,
+// baris bisa diklaim lagi setelahnya. Gagal kirim dicoba lagi setelah MailRetryDelay, sampai
+// MailMaxAttempts kali.
+var (
+	MailClaimLease  = 15 * time.Minute
+	MailMaxAttempts = 5
+)
+
+// MailRetryDelay adalah jeda sebelum percobaan berikutnya setelah percobaan ke-attempt gagal
+// (30 menit, lalu dua kali lipat setiap percobaan, maksimal 12 jam)
+func MailRetryDelay(attempt int) time.Duration {
+	delay := 30 * time.Minute
+	for i := 1; i < attempt && delay < 12*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 12*time.Hour {
+		delay = 12 * time.Hour
+	}
+	return delay
+}
+
+// formatMail menyusun pesan RFC 5322 sederhana
+func formatMail(from string, mail Mail) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mail.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// validateMail menolak alamat/subject yang mengandung baris baru (header injection)
+func validateMail(mail Mail) error {
+	if mail.To == "" {
+		return errors.New("mail recipient is required")
+	}
+	if strings.ContainsAny(mail.To+mail.Subject, "\r\n") {
+		return errors.New("invalid mail header")
+	}
+	return nil
+}
+
+// SMTPMailer mengirim email lewat server SMTP (PLAIN auth jika Username diisi)
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(mail Mail) error {
+	if err := validateMail(mail); err != nil {
+		return err
+	}
+	port := m.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, port), auth, m.From, []string{mail.To}, formatMail(m.From, mail))
+}
+
+// FileMailer menulis setiap email sebagai file .eml, berguna untuk development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(mail Mail) error {
+	if err := validateMail(mail); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(mail.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMail(m.From, mail), 0o600)
+}
+
+// MemoryMailer menyimpan email di memori, untuk testing
+type MemoryMailer struct {
+	mu    sync.Mutex
+	mails []Mail
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(mail Mail) error {
+	if err := validateMail(mail); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+// Sent mengembalikan salinan semua email yang sudah dikirim
+func (m *MemoryMailer) Sent() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mail(nil), m.mails...)
+}
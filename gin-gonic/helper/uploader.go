@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+// UploadImage mengunggah file gambar ke Cloudinary dan mengembalikan URL https-nya
+func UploadImage(file *multipart.FileHeader) (string, error) {
+	config, err := LoadConfig(".")
+	if err != nil {
+		return "", errors.New("failed to load config")
+	}
+
+	if config.CloudinaryCloudName == "" || config.CloudinaryAPIKey == "" || config.CloudinaryAPISecret == "" {
+		return "", errors.New("cloudinary config missing")
+	}
+
+	cld, err := cloudinary.NewFromParams(
+		config.CloudinaryCloudName,
+		config.CloudinaryAPIKey,
+		config.CloudinaryAPISecret,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	fileReader, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer fileReader.Close()
+
+	uploadResult, err := cld.Upload.Upload(context.Background(), fileReader, uploader.UploadParams{})
+	if err != nil {
+		return "", err
+	}
+	return uploadResult.SecureURL, nil
+}
@@ -5,8 +5,11 @@ import (
 	"log"
 	"time"
 
+	"gin-gonic/dashboard"
 	"gin-gonic/helper"
+	"gin-gonic/middlewares"
 	"gin-gonic/modules"
+	"gin-gonic/modules/roles"
 	"gin-gonic/modules/users"
 	"gin-gonic/utils"
 	"gin-gonic/websocket"
@@ -15,6 +18,8 @@ import (
 	"gorm.io/gorm"
 )
 
+const apiVersion = "api/v1"
+
 func main() {
 	// 1. Load Configuration & Logger
 	config, err := helper.LoadConfig(".")
@@ -26,6 +31,30 @@ func main() {
 		helper.SetupLogOutput()
 	}
 
+	// Load JWT keys (JWT_SECRET + JWT_KEYS)
+	keys, err := utils.LoadKeyManager(utils.KeyConfig{
+		Secret:       config.JWTSecret,
+		Keys:         config.JWTKeys,
+		SigningKeyID: config.JWTSigningKeyID,
+		DevMode:      config.DevMode == "Y",
+	})
+	if err != nil {
+		log.Fatal("Cannot load JWT keys:", err)
+	}
+	utils.SetKeyManager(keys)
+
+	// Load key enkripsi field PII (harus sebelum query ke tabel users)
+	fieldKeys, err := utils.LoadFieldKeyRing(utils.FieldKeyConfig{
+		Keys:          config.FieldEncryptionKeys,
+		ActiveKeyID:   config.FieldEncryptionKeyID,
+		BlindIndexKey: config.BlindIndexKey,
+		DevMode:       config.DevMode == "Y",
+	})
+	if err != nil {
+		log.Fatal("Cannot load field encryption keys:", err)
+	}
+	utils.SetFieldKeyRing(fieldKeys)
+
 	// 2. Initialize Database
 	db := helper.OpenDb(config.DB, config.Schema, "v1")
 	if db == nil {
@@ -41,27 +70,44 @@ func main() {
 
 	// 4. Initialize WebSocket Manager
 	// Manager ini butuh NATS yang sudah terkoneksi untuk subscribe topic
+	websocket.SetAllowedOrigins(config.WSAllowedOrigins)
 	wsManager := websocket.NewManager()
+	wsManager.ForwardNats(helper.NatsConn)
 	go wsManager.Run()
 
 	// 5. Setup Gin Engine & Middleware
 	app := gin.Default()
 	app.Use(CORSMiddleware(config.ALLOW_ORIGIN))
 
-	// 6. Define Routes
-	app.GET("/", func(c *gin.Context) {
+	// 6. Define Routes (setiap route wajib punya policy akses)
+	router := middlewares.NewRouter(&app.RouterGroup)
+	router.GET("/", middlewares.Public(), func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "API service is running"})
 	})
 
-	// Route khusus WebSocket
-	app.GET("/ws", func(c *gin.Context) {
+	// Route khusus WebSocket (autentikasi via ticket/subprotocol di dalam handler)
+	router.GET("/ws", middlewares.Public(), func(c *gin.Context) {
 		websocket.ServeWS(wsManager, c)
 	})
+	router.POST("/ws/ticket", middlewares.Authenticated(), websocket.IssueTicket)
+
+	// Public key untuk verifikasi token oleh service lain (nats-subscriber, dll)
+	router.GET("/.well-known/jwks.json", middlewares.Public(), func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, utils.Keys().JWKS())
+	})
+
+	// Dashboard admin (embedded). Halaman statis publik, data diambil lewat API admin.
+	dashboard.Register(router, apiVersion)
 
 	// Setup API Versioning & Modules
-	versionRunner := modules.NewVersion(config, app, db, helper.NatsConn, "api/v1")
+	versionRunner := modules.NewVersion(config, app, db, helper.NatsConn, apiVersion)
 	versionRunner.Run()
 
+	if err := middlewares.VerifyRoutes(app.Routes()); err != nil {
+		log.Fatal("Route policy check failed:", err)
+	}
+
 	// 7. Background Workers & Database Setup
 	// bookService := books.NewBookService(db)
 	// books.StartWorker(bookService) // Worker moved to separate service
@@ -80,7 +126,7 @@ func CORSMiddleware(allowOrigin string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -120,15 +166,24 @@ func seedAdmin(db *gorm.DB, config helper.Config) {
 			return
 		}
 
+		var adminRole roles.Role
+		if err := db.Where("name = ?", roles.RoleAdmin).First(&adminRole).Error; err != nil {
+			fmt.Printf("Error loading admin role: %v\n", err)
+			return
+		}
+
+		now := time.Now()
 		admin := users.User{
-			Name:      adminName,
-			Email:     adminEmail,
-			Password:  hashedPassword,
-			Address:   "System Administrator",
-			Role:      "admin",
-			BornDate:  time.Now(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			Name:       adminName,
+			Email:      adminEmail,
+			Password:   hashedPassword,
+			Address:    "System Administrator",
+			Role:       roles.RoleAdmin,
+			Roles:      []roles.Role{adminRole},
+			VerifiedAt: &now,
+			// Tanggal lahir kosong berarti umur tidak diketahui: tidak dibatasi umur dan tidak dianggap anak
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
 		}
 
 		if err := db.Create(&admin).Error; err != nil {
@@ -138,6 +193,23 @@ func seedAdmin(db *gorm.DB, config helper.Config) {
 		}
 	} else {
 		fmt.Println("Admin account check: OK (Admin already exists)")
+		clearSeededBornDate(db, adminEmail)
+	}
+}
+
+// clearSeededBornDate menghapus tanggal lahir admin hasil seed lama yang diisi waktu seed,
+// agar admin tidak dianggap berumur 0 tahun oleh batas umur buku dan perwalian
+func clearSeededBornDate(db *gorm.DB, adminEmail string) {
+	var admin users.User
+	if err := db.Where("email_index = ?", utils.BlindIndex(adminEmail)).First(&admin).Error; err != nil {
+		return
+	}
+	if admin.BornDate.IsZero() || admin.BornDate.Format("2006-01-02") != admin.CreatedAt.Format("2006-01-02") {
+		return
+	}
+	admin.BornDate = time.Time{}
+	if err := db.Model(&admin).Select("born_date").Updates(&admin).Error; err != nil {
+		fmt.Printf("Failed to clear seeded admin born date: %v\n", err)
 	}
 }
 
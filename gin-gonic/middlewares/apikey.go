@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"errors"
+)
+
+// APIKeyHeader adalah header untuk autentikasi dengan API key
+const APIKeyHeader = "X-API-Key"
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey adalah API key yang masih berlaku (belum dicabut dan belum kedaluwarsa)
+type APIKey struct {
+	ID     uint
+	UserID uint // Akun yang diwakili key ini
+	Scopes []string
+}
+
+// APIKeyStore dipakai middleware untuk mencari API key.
+// Implementasinya ada di module apikeys agar package ini tidak bergantung pada module.
+type APIKeyStore interface {
+	// FindAPIKey mengembalikan nil, nil jika key tidak dikenal, dicabut, atau kedaluwarsa
+	FindAPIKey(rawKey string) (*APIKey, error)
+}
+
+var apiKeyStore APIKeyStore
+
+// SetAPIKeyStore mendaftarkan APIKeyStore yang dipakai JWTMiddleware
+func SetAPIKeyStore(store APIKeyStore) {
+	apiKeyStore = store
+}
+
+// ParseAPIKey memvalidasi API key dan mengubahnya menjadi Principal.
+// Permission principal adalah irisan scope key dengan permission user pemiliknya,
+// dan role dikosongkan sehingga policy berbasis role tidak bisa dipenuhi oleh API key.
+func ParseAPIKey(rawKey string) (*Principal, error) {
+	if apiKeyStore == nil || sessionStore == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := apiKeyStore.FindAPIKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := sessionStore.FindSessionUser(key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Suspended {
+		return nil, ErrUserSuspended
+	}
+
+	granted := make(map[string]bool, len(user.Permissions))
+	for _, code := range user.Permissions {
+		granted[code] = true
+	}
+	var permissions []string
+	for _, scope := range key.Scopes {
+		if granted[scope] {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	return &Principal{
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		Permissions:  permissions,
+		APIKeyID:     key.ID,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -10,40 +11,107 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// JWTMiddleware middleware untuk validasi JWT token
-func JWTMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			helper.ErrorResponse(c, http.StatusUnauthorized, "Authorization header required", nil)
-			c.Abort()
-			return
-		}
+// bearerToken mengambil token dari header "Authorization: Bearer <token>"
+func bearerToken(c *gin.Context) (string, string) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		return "", "Authorization header required"
+	}
 
-		// Check if token starts with "Bearer "
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			helper.ErrorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Use 'Bearer <token>'", nil)
-			c.Abort()
-			return
+	// Check if token starts with "Bearer "
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return "", "Invalid authorization format. Use 'Bearer <token>'"
+	}
+
+	return tokenParts[1], ""
+}
+
+// ParseToken memvalidasi JWT dan mengubah claims menjadi Principal.
+// Status sesi (ValidateSession) tidak dicek di sini.
+func ParseToken(tokenString string) (*Principal, error) {
+	claims, err := utils.ValidateJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return principalFromClaims(claims)
+}
+
+// authenticate memvalidasi API key (header X-API-Key) atau JWT dan menyimpan Principal di context.
+// Jika gagal, response error sudah ditulis dan request di-abort.
+func authenticate(c *gin.Context) (*Principal, bool) {
+	if rawKey := c.GetHeader(APIKeyHeader); rawKey != "" {
+		return authenticateAPIKey(c, rawKey)
+	}
+
+	tokenString, message := bearerToken(c)
+	if message != "" {
+		helper.ErrorResponse(c, http.StatusUnauthorized, message, nil)
+		c.Abort()
+		return nil, false
+	}
+
+	// Validate JWT token
+	principal, err := ParseToken(tokenString)
+	if err != nil {
+		helper.ErrorResponse(c, http.StatusUnauthorized, "Invalid or expired token", err.Error())
+		c.Abort()
+		return nil, false
+	}
+
+	// Pastikan token belum dicabut (logout, user dihapus, role berubah, atau perangkat kiosk dicabut)
+	session, err := LoadSession(principal.UserID, principal.Role, principal.TokenVersion)
+	if err == nil {
+		err = validateKiosk(principal)
+	}
+	if err != nil {
+		if errors.Is(err, ErrUserSuspended) {
+			helper.ErrorResponse(c, http.StatusForbidden, "Account suspended", err.Error())
+		} else if IsSessionError(err) {
+			helper.ErrorResponse(c, http.StatusUnauthorized, "Token has been revoked", err.Error())
+		} else {
+			helper.InternalServerError(c, "Failed to validate session", err.Error())
 		}
+		c.Abort()
+		return nil, false
+	}
+	principal.Permissions = scopedPermissions(principal, session.Permissions)
 
-		tokenString := tokenParts[1]
+	SetPrincipal(c, principal)
+	return principal, true
+}
 
-		// Validate JWT token
-		claims, err := utils.ValidateJWT(tokenString)
-		if err != nil {
-			helper.ErrorResponse(c, http.StatusUnauthorized, "Invalid or expired token", err.Error())
-			c.Abort()
-			return
+// scopedPermissions mengosongkan permission untuk token ber-scope (kiosk), sehingga
+// token tersebut tidak bisa dipakai untuk aksi admin walaupun pemiliknya staf.
+func scopedPermissions(principal *Principal, permissions []string) []string {
+	if principal.Scope != "" {
+		return nil
+	}
+	return permissions
+}
+
+func authenticateAPIKey(c *gin.Context, rawKey string) (*Principal, bool) {
+	principal, err := ParseAPIKey(rawKey)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAPIKey) || IsSessionError(err) {
+			helper.ErrorResponse(c, http.StatusUnauthorized, "Invalid or expired API key", nil)
+		} else {
+			helper.InternalServerError(c, "Failed to validate API key", err.Error())
 		}
+		c.Abort()
+		return nil, false
+	}
 
-		// Set user information in context for use in handlers
-		c.Set("user_id", claims["user_id"])
-		c.Set("user_email", claims["email"])
-		c.Set("user_name", claims["name"])
-		c.Set("user_role", claims["role"])
+	SetPrincipal(c, principal)
+	return principal, true
+}
 
+// JWTMiddleware middleware untuk validasi JWT token atau API key
+func JWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := authenticate(c); !ok {
+			return
+		}
 		c.Next()
 	}
 }
@@ -51,8 +119,8 @@ func JWTMiddleware() gin.HandlerFunc {
 // middleware admin
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exits := c.Get("user_role")
-		if !exits || role != "admin" {
+		principal, ok := CurrentPrincipal(c)
+		if !ok || !principal.HasRole("admin") {
 			helper.ErrorResponse(c, http.StatusForbidden, "Forbidden", "Hanya admin dibenarkan mengakses ini")
 			c.Abort()
 			return
@@ -63,36 +131,41 @@ func AdminMiddleware() gin.HandlerFunc {
 // OptionalJWTMiddleware middleware yang opsional (tidak wajib ada token)
 func OptionalJWTMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			// No token provided, continue without user context
+		if rawKey := c.GetHeader(APIKeyHeader); rawKey != "" {
+			if principal, err := ParseAPIKey(rawKey); err == nil {
+				SetPrincipal(c, principal)
+			}
 			c.Next()
 			return
 		}
 
-		// Check if token starts with "Bearer "
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			// Invalid format, continue without user context
+		tokenString, message := bearerToken(c)
+		if message != "" {
+			// No token or invalid format, continue without user context
 			c.Next()
 			return
 		}
 
-		tokenString := tokenParts[1]
-
 		// Validate JWT token
-		claims, err := utils.ValidateJWT(tokenString)
+		principal, err := ParseToken(tokenString)
 		if err != nil {
 			// Invalid token, continue without user context
 			c.Next()
 			return
 		}
 
-		// Set user information in context for use in handlers
-		c.Set("user_id", claims["user_id"])
-		c.Set("user_email", claims["email"])
-		c.Set("user_name", claims["name"])
+		session, err := LoadSession(principal.UserID, principal.Role, principal.TokenVersion)
+		if err == nil {
+			err = validateKiosk(principal)
+		}
+		if err != nil {
+			// Revoked token, continue without user context
+			c.Next()
+			return
+		}
+		principal.Permissions = scopedPermissions(principal, session.Permissions)
 
+		SetPrincipal(c, principal)
 		c.Next()
 	}
 }
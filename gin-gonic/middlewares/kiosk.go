@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"errors"
+)
+
+// ErrKioskRevoked dikembalikan jika token sesi kiosk berasal dari perangkat yang sudah dicabut
+var ErrKioskRevoked = errors.New("kiosk revoked")
+
+// KioskStore dipakai middleware untuk mengecek perangkat kiosk pemilik token sesi.
+// Implementasinya ada di module kiosks agar package ini tidak bergantung pada module.
+type KioskStore interface {
+	// KioskActive mengembalikan false jika perangkat tidak dikenal atau sudah dicabut
+	KioskActive(kioskID uint) (bool, error)
+}
+
+var kioskStore KioskStore
+
+// SetKioskStore mendaftarkan KioskStore yang dipakai untuk memvalidasi token ber-scope kiosk
+func SetKioskStore(store KioskStore) {
+	kioskStore = store
+}
+
+// validateKiosk memastikan token sesi kiosk terikat ke perangkat yang masih aktif,
+// sehingga mencabut perangkat juga mengakhiri sesi patron yang sudah diterbitkan.
+func validateKiosk(principal *Principal) error {
+	if principal.Scope != ScopeKiosk {
+		return nil
+	}
+	if principal.KioskID == 0 || kioskStore == nil {
+		return ErrKioskRevoked
+	}
+	active, err := kioskStore.KioskActive(principal.KioskID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrKioskRevoked
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gin-gonic/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrResourceNotFound dikembalikan OwnerResolver jika resource tidak ada
+var ErrResourceNotFound = errors.New("resource not found")
+
+// OwnerResolver mengembalikan ID user pemilik resource yang diakses request
+type OwnerResolver func(c *gin.Context) (uint, error)
+
+// Policy adalah aturan akses deklaratif untuk satu route
+type Policy struct {
+	Name          string
+	Authenticated bool
+	// Roles dan Permissions yang boleh mengakses (cukup salah satu).
+	// Keduanya kosong berarti semua user yang login.
+	Roles       []string
+	Permissions []string
+	// Owner (opsional) mengizinkan pemilik resource walaupun role-nya tidak ada di Roles
+	Owner OwnerResolver
+	// DenyImpersonation menolak token impersonate untuk aksi sensitif (password, 2FA, dll)
+	DenyImpersonation bool
+	// Scopes adalah scope token terbatas yang boleh mengakses route (lihat Principal.Scope)
+	Scopes []string
+}
+
+// Public dapat diakses tanpa login
+func Public() Policy {
+	return Policy{Name: "public"}
+}
+
+// Authenticated wajib login, role apa saja
+func Authenticated() Policy {
+	return Policy{Name: "authenticated", Authenticated: true}
+}
+
+// RequireRole wajib login dengan salah satu role yang diberikan
+func RequireRole(roles ...string) Policy {
+	return Policy{Name: "role:" + strings.Join(roles, "|"), Authenticated: true, Roles: roles}
+}
+
+// RequirePermission wajib login dan memiliki salah satu permission yang diberikan
+func RequirePermission(codes ...string) Policy {
+	return Policy{Name: "permission:" + strings.Join(codes, "|"), Authenticated: true, Permissions: codes}
+}
+
+// OwnerOrPermission mengizinkan pemilik resource atau user dengan salah satu permission yang diberikan
+func OwnerOrPermission(owner OwnerResolver, codes ...string) Policy {
+	return Policy{Name: "owner|permission:" + strings.Join(codes, "|"), Authenticated: true, Permissions: codes, Owner: owner}
+}
+
+// OwnerOrRole mengizinkan pemilik resource atau user dengan salah satu role yang diberikan
+func OwnerOrRole(owner OwnerResolver, roles ...string) Policy {
+	return Policy{Name: "owner|role:" + strings.Join(roles, "|"), Authenticated: true, Roles: roles, Owner: owner}
+}
+
+// WithoutImpersonation mengembalikan policy yang sama tetapi menolak token impersonate
+func (p Policy) WithoutImpersonation() Policy {
+	p.Name += "|no-impersonation"
+	p.DenyImpersonation = true
+	return p
+}
+
+// AllowScope mengembalikan policy yang sama tetapi juga menerima token dengan scope yang diberikan
+func (p Policy) AllowScope(scopes ...string) Policy {
+	p.Name += "|scope:" + strings.Join(scopes, "|")
+	p.Scopes = append(append([]string{}, p.Scopes...), scopes...)
+	return p
+}
+
+// allowsScope mengecek apakah token ber-scope boleh mengakses route ini
+func (p Policy) allowsScope(scope string) bool {
+	if scope == "" {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// SelfParam adalah OwnerResolver untuk route yang path param-nya adalah ID user itu sendiri
+func SelfParam(param string) OwnerResolver {
+	return func(c *gin.Context) (uint, error) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err != nil {
+			return 0, ErrResourceNotFound
+		}
+		return uint(id), nil
+	}
+}
+
+// Handler mengubah policy menjadi middleware gin
+func (p Policy) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !p.Authenticated {
+			c.Next()
+			return
+		}
+
+		principal, ok := authenticate(c)
+		if !ok {
+			return
+		}
+		if p.DenyImpersonation && principal.IsImpersonated() {
+			helper.ErrorResponse(c, http.StatusForbidden, "Forbidden", "Aksi ini tidak dapat dilakukan saat impersonate user")
+			c.Abort()
+			return
+		}
+		if !p.allowsScope(principal.Scope) {
+			helper.ErrorResponse(c, http.StatusForbidden, "Forbidden", "Token ini tidak dapat mengakses resource ini")
+			c.Abort()
+			return
+		}
+
+		allowed, err := p.allows(c, principal)
+		if err != nil {
+			if errors.Is(err, ErrResourceNotFound) {
+				helper.NotFoundError(c, err.Error())
+			} else {
+				helper.InternalServerError(c, "Failed to check access", err.Error())
+			}
+			c.Abort()
+			return
+		}
+		if !allowed {
+			helper.ErrorResponse(c, http.StatusForbidden, "Forbidden", "Anda tidak memiliki akses ke resource ini")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (p Policy) allows(c *gin.Context, principal *Principal) (bool, error) {
+	// API key hanya berlaku lewat permission yang di-scope secara eksplisit,
+	// tidak sebagai sesi login pemiliknya (route Authenticated atau pemilik resource)
+	if principal.APIKeyID != 0 {
+		return principal.HasPermission(p.Permissions...), nil
+	}
+	if len(p.Roles) == 0 && len(p.Permissions) == 0 && p.Owner == nil {
+		return true, nil
+	}
+	if principal.HasRole(p.Roles...) || principal.HasPermission(p.Permissions...) {
+		return true, nil
+	}
+	if p.Owner == nil {
+		return false, nil
+	}
+
+	ownerID, err := p.Owner(c)
+	if err != nil {
+		return false, err
+	}
+	return ownerID == principal.UserID, nil
+}
+
+// =================================================================
+// Registry: setiap route wajib didaftarkan bersama policy-nya
+// =================================================================
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Policy)
+)
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// RoutePolicy mengembalikan policy untuk route tertentu
+func RoutePolicy(method, path string) (Policy, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[routeKey(method, path)]
+	return p, ok
+}
+
+// VerifyRoutes memastikan setiap route yang terdaftar di engine memiliki policy.
+// Dipanggil saat startup agar route tanpa policy tidak pernah ter-deploy.
+func VerifyRoutes(routes gin.RoutesInfo) error {
+	var missing []string
+	for _, route := range routes {
+		if _, ok := RoutePolicy(route.Method, route.Path); !ok {
+			missing = append(missing, routeKey(route.Method, route.Path))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes without policy: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Router membungkus gin.RouterGroup sehingga setiap route didaftarkan bersama policy-nya
+type Router struct {
+	group *gin.RouterGroup
+}
+
+func NewRouter(group *gin.RouterGroup) *Router {
+	return &Router{group: group}
+}
+
+// Group membuat sub-router dengan prefix path
+func (r *Router) Group(path string) *Router {
+	return &Router{group: r.group.Group(path)}
+}
+
+// Handle mendaftarkan route dengan policy. Policy dijalankan sebelum handler.
+func (r *Router) Handle(method, path string, policy Policy, handlers ...gin.HandlerFunc) {
+	// BasePath dari sub-group memakai aturan join path yang sama dengan gin
+	fullPath := r.group.Group(path).BasePath()
+
+	registryMu.Lock()
+	registry[routeKey(method, fullPath)] = policy
+	registryMu.Unlock()
+
+	r.group.Handle(method, path, append([]gin.HandlerFunc{policy.Handler()}, handlers...)...)
+}
+
+func (r *Router) GET(path string, policy Policy, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodGet, path, policy, handlers...)
+}
+
+func (r *Router) POST(path string, policy Policy, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPost, path, policy, handlers...)
+}
+
+func (r *Router) PUT(path string, policy Policy, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPut, path, policy, handlers...)
+}
+
+func (r *Router) PATCH(path string, policy Policy, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPatch, path, policy, handlers...)
+}
+
+func (r *Router) DELETE(path string, policy Policy, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodDelete, path, policy, handlers...)
+}
+
+// StaticFS menyajikan file statis (GET dan HEAD) dengan policy yang sama
+func (r *Router) StaticFS(path string, fs http.FileSystem, policy Policy) {
+	fileServer := http.StripPrefix(r.group.Group(path).BasePath(), http.FileServer(fs))
+	handler := func(c *gin.Context) {
+		// Tidak menampilkan daftar isi direktori
+		if strings.HasSuffix(c.Param("filepath"), "/") {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		fileServer.ServeHTTP(c.Writer, c.Request)
+	}
+	pattern := strings.TrimSuffix(path, "/") + "/*filepath"
+	r.Handle(http.MethodGet, pattern, policy, handler)
+	r.Handle(http.MethodHead, pattern, policy, handler)
+}
@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRouterRecordsPolicyWithFullPath(t *testing.T) {
+	engine := gin.New()
+	router := NewRouter(&engine.RouterGroup).Group("/v1").Group("/things")
+	router.GET("/:id", RequirePermission("things:read"), func(c *gin.Context) {})
+	router.POST("", Authenticated().AllowScope(ScopeKiosk), func(c *gin.Context) {})
+
+	cases := map[string]string{
+		"GET /v1/things/:id": "permission:things:read",
+		"POST /v1/things":    "authenticated|scope:kiosk",
+	}
+	for _, route := range engine.Routes() {
+		key := routeKey(route.Method, route.Path)
+		want, ok := cases[key]
+		if !ok {
+			t.Errorf("unexpected route %s", key)
+			continue
+		}
+		policy, ok := RoutePolicy(route.Method, route.Path)
+		if !ok {
+			t.Errorf("%s: no policy registered", key)
+			continue
+		}
+		if policy.Name != want {
+			t.Errorf("%s: policy %q, want %q", key, policy.Name, want)
+		}
+	}
+	if len(engine.Routes()) != len(cases) {
+		t.Errorf("got %d routes, want %d", len(engine.Routes()), len(cases))
+	}
+}
+
+func TestVerifyRoutesRejectsRouteWithoutPolicy(t *testing.T) {
+	engine := gin.New()
+	NewRouter(&engine.RouterGroup).GET("/verify/with-policy", Public(), func(c *gin.Context) {})
+	engine.GET("/verify/without-policy", func(c *gin.Context) {})
+
+	err := VerifyRoutes(engine.Routes())
+	if err == nil {
+		t.Fatal("VerifyRoutes accepted a route without policy")
+	}
+	if !strings.Contains(err.Error(), "GET /verify/without-policy") {
+		t.Errorf("error %q does not name the route without policy", err)
+	}
+	if strings.Contains(err.Error(), "/verify/with-policy") {
+		t.Errorf("error %q names a route that has a policy", err)
+	}
+}
+
+func TestStaticFSRegistersGetAndHead(t *testing.T) {
+	engine := gin.New()
+	NewRouter(&engine.RouterGroup).StaticFS("/static-test", http.Dir("."), Public())
+
+	if err := VerifyRoutes(engine.Routes()); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if _, ok := RoutePolicy(method, "/static-test/*filepath"); !ok {
+			t.Errorf("%s /static-test/*filepath: no policy registered", method)
+		}
+	}
+}
+
+func TestPublicPolicyPassesWithoutToken(t *testing.T) {
+	engine := gin.New()
+	NewRouter(&engine.RouterGroup).GET("/public-test", Public(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public-test", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	owner := func(id uint) OwnerResolver {
+		return func(c *gin.Context) (uint, error) { return id, nil }
+	}
+	user := &Principal{UserID: 7, Role: "user", Permissions: []string{"loans:borrow"}}
+
+	cases := []struct {
+		name   string
+		policy Policy
+		want   bool
+	}{
+		{"authenticated", Authenticated(), true},
+		{"missing permission", RequirePermission("users:read"), false},
+		{"held permission", RequirePermission("users:read", "loans:borrow"), true},
+		{"role", RequireRole("user"), true},
+		{"other role", RequireRole("admin"), false},
+		{"owner", OwnerOrPermission(owner(7), "users:write"), true},
+		{"not owner", OwnerOrPermission(owner(8), "users:write"), false},
+	}
+	for _, tc := range cases {
+		got, err := tc.policy.allows(nil, user)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: allows = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyAllowsAPIKeyOnlyWithScope(t *testing.T) {
+	owner := func(c *gin.Context) (uint, error) { return 7, nil }
+	key := &Principal{UserID: 7, APIKeyID: 3, Permissions: []string{"loans:read"}}
+
+	cases := []struct {
+		name   string
+		policy Policy
+		want   bool
+	}{
+		{"authenticated", Authenticated(), false},
+		{"owner without scope", OwnerOrPermission(owner, "users:write"), false},
+		{"scoped permission", RequirePermission("loans:read"), true},
+		{"owner with scope", OwnerOrPermission(owner, "loans:read"), true},
+	}
+	for _, tc := range cases {
+		got, err := tc.policy.allows(nil, key)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: allows = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyAllowsScope(t *testing.T) {
+	if Authenticated().allowsScope(ScopeKiosk) {
+		t.Error("plain policy accepted a kiosk token")
+	}
+	if !Authenticated().AllowScope(ScopeKiosk).allowsScope(ScopeKiosk) {
+		t.Error("AllowScope(ScopeKiosk) rejected a kiosk token")
+	}
+	if !Authenticated().allowsScope("") {
+		t.Error("policy rejected an unscoped token")
+	}
+}
@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"errors"
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid token claims")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrRoleChanged   = errors.New("role changed")
+	ErrTokenRevoked  = errors.New("token revoked")
+	ErrUserSuspended = errors.New("user suspended")
+)
+
+// SessionUser adalah data user terbaru yang dibutuhkan untuk memvalidasi token
+type SessionUser struct {
+	ID           uint
+	Role         string
+	TokenVersion int
+	Permissions  []string
+	Suspended    bool
+}
+
+// SessionStore dipakai middleware untuk membaca status user dari database.
+// Implementasinya ada di module users agar package ini tidak bergantung pada module.
+type SessionStore interface {
+	// FindSessionUser mengembalikan nil, nil jika user tidak ditemukan
+	FindSessionUser(userID uint) (*SessionUser, error)
+}
+
+var sessionStore SessionStore
+
+// SetSessionStore mendaftarkan SessionStore yang dipakai JWTMiddleware dan WebSocket
+func SetSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// LoadSession memastikan token masih berlaku: user masih ada dan tidak di-suspend,
+// role tidak berubah, dan token belum dicabut (token_version belum dinaikkan oleh logout).
+// Error selain yang dikenali IsSessionError adalah error database.
+func LoadSession(userID uint, role string, tokenVersion int) (*SessionUser, error) {
+	if sessionStore == nil {
+		return &SessionUser{ID: userID, Role: role, TokenVersion: tokenVersion}, nil
+	}
+
+	user, err := sessionStore.FindSessionUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Suspended {
+		return nil, ErrUserSuspended
+	}
+	if user.Role != role {
+		return nil, ErrRoleChanged
+	}
+	if user.TokenVersion != tokenVersion {
+		return nil, ErrTokenRevoked
+	}
+	return user, nil
+}
+
+// ValidateSession sama seperti LoadSession tetapi hanya mengembalikan error
+func ValidateSession(userID uint, role string, tokenVersion int) error {
+	_, err := LoadSession(userID, role, tokenVersion)
+	return err
+}
+
+// IsSessionError mengecek apakah err berarti sesi sudah tidak berlaku (bukan error database)
+func IsSessionError(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrRoleChanged) || errors.Is(err, ErrTokenRevoked) ||
+		errors.Is(err, ErrUserSuspended) || errors.Is(err, ErrKioskRevoked)
+}
@@ -0,0 +1,61 @@
+package apikeys
+
+import (
+	"net/http"
+
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController interface {
+	Create(ctx *gin.Context)
+	GetList(ctx *gin.Context)
+	Revoke(ctx *gin.Context)
+}
+
+type apiKeyController struct {
+	service APIKeyService
+}
+
+func NewAPIKeyController(service APIKeyService) APIKeyController {
+	return &apiKeyController{service: service}
+}
+
+func (c *apiKeyController) Create(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	result, err := c.service.Create(principal, &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *apiKeyController) GetList(ctx *gin.Context) {
+	keys, err := c.service.GetList()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+func (c *apiKeyController) Revoke(ctx *gin.Context) {
+	if err := c.service.Revoke(ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "API key berhasil dicabut"})
+}
@@ -0,0 +1,49 @@
+package apikeys
+
+import (
+	"log"
+
+	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type APIKeyServer struct {
+	router  *gin.RouterGroup
+	db      *gorm.DB
+	version string
+}
+
+func NewAPIKeyServer(router *gin.RouterGroup, db *gorm.DB, version string) *APIKeyServer {
+	return &APIKeyServer{router: router, db: db, version: version}
+}
+
+func (s *APIKeyServer) Init() {
+	config, err := helper.LoadConfig(".")
+	if err != nil {
+		log.Fatal("Cannot load config:", err)
+	}
+
+	if config.AUTO_MIGRATE == "Y" {
+		if err := s.db.AutoMigrate(&APIKey{}); err != nil {
+			log.Printf("Failed to auto migrate APIKey: %v", err)
+		}
+	}
+
+	middlewares.SetAPIKeyStore(NewAPIKeyStore(s.db))
+
+	service := NewAPIKeyService(s.db)
+	controller := NewAPIKeyController(service)
+
+	router := middlewares.NewRouter(s.router)
+	// API key berlaku lama, tidak boleh dibuat dari token impersonate
+	canManage := middlewares.RequirePermission(roles.PermAPIKeysManage).WithoutImpersonation()
+
+	adminKeys := router.Group("/" + s.version + "/admin/api-keys")
+	adminKeys.GET("", canManage, controller.GetList)
+	adminKeys.POST("", canManage, controller.Create)
+	adminKeys.DELETE("/:id", canManage, controller.Revoke)
+}
@@ -0,0 +1,109 @@
+package apikeys
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// keyPrefix menandai API key agar mudah dikenali (misal oleh secret scanner)
+	keyPrefix = "lk_"
+	// lastUsedInterval membatasi seberapa sering last_used_at ditulis
+	lastUsedInterval = time.Minute
+)
+
+type APIKeyService interface {
+	Create(creator *middlewares.Principal, input *CreateAPIKeyRequest) (*CreateAPIKeyResponse, error)
+	GetList() ([]APIKey, error)
+	Revoke(id string) error
+}
+
+type apiKeyService struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyService(db *gorm.DB) APIKeyService {
+	return &apiKeyService{db: db}
+}
+
+func (s *apiKeyService) Create(creator *middlewares.Principal, input *CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
+	// Pembuat tidak boleh memberi scope yang tidak dimilikinya
+	for _, scope := range input.Scopes {
+		if !creator.HasPermission(scope) {
+			return nil, fmt.Errorf("anda tidak memiliki permission %q", scope)
+		}
+	}
+
+	var known int64
+	if err := s.db.Model(&roles.Permission{}).Where("code IN ?", input.Scopes).Count(&known).Error; err != nil {
+		return nil, err
+	}
+	if int(known) != len(uniqueStrings(input.Scopes)) {
+		return nil, errors.New("scopes contain unknown permission")
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	rawKey := keyPrefix + secret
+
+	// Key selalu mewakili pembuatnya; bertindak atas nama user lain hanya lewat impersonate yang diaudit
+	key := APIKey{
+		Name:      input.Name,
+		Prefix:    rawKey[:len(keyPrefix)+8],
+		KeyHash:   utils.HashToken(rawKey),
+		UserID:    creator.UserID,
+		Scopes:    uniqueStrings(input.Scopes),
+		CreatedBy: creator.UserID,
+		CreatedAt: time.Now(),
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.db.Create(&key).Error; err != nil {
+		return nil, err
+	}
+
+	return &CreateAPIKeyResponse{Key: rawKey, APIKey: key}, nil
+}
+
+func (s *apiKeyService) GetList() ([]APIKey, error) {
+	var keys []APIKey
+	if err := s.db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *apiKeyService) Revoke(id string) error {
+	var key APIKey
+	if err := s.db.Where("id = ?", id).First(&key).Error; err != nil {
+		return errors.New("api key not found")
+	}
+	if key.RevokedAt != nil {
+		return errors.New("api key already revoked")
+	}
+	return s.db.Model(&key).Update("revoked_at", time.Now()).Error
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
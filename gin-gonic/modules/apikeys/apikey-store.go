@@ -0,0 +1,46 @@
+package apikeys
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gin-gonic/middlewares"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+type apiKeyStore struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyStore membuat APIKeyStore untuk autentikasi header X-API-Key
+func NewAPIKeyStore(db *gorm.DB) middlewares.APIKeyStore {
+	return &apiKeyStore{db: db}
+}
+
+func (s *apiKeyStore) FindAPIKey(rawKey string) (*middlewares.APIKey, error) {
+	if !strings.HasPrefix(rawKey, keyPrefix) {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var key APIKey
+	// Key lama yang dibuat untuk user lain (user_id <> created_by) tidak lagi diterima
+	err := s.db.Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND user_id = created_by",
+		utils.HashToken(rawKey), now).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// last_used_at cukup akurat per menit, tidak perlu ditulis di setiap request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		s.db.Model(&key).UpdateColumn("last_used_at", now)
+	}
+
+	return &middlewares.APIKey{ID: key.ID, UserID: key.UserID, Scopes: key.Scopes}, nil
+}
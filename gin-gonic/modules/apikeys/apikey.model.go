@@ -0,0 +1,36 @@
+package apikeys
+
+import "time"
+
+// APIKey adalah key untuk script dan integrasi. Key asli hanya ditampilkan sekali saat dibuat,
+// yang disimpan hanya hash SHA-256 dan prefix untuk identifikasi.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"index;not null"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"` // Akun yang diwakili key ini, selalu pembuatnya
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"` // Kode permission yang boleh dipakai
+	ExpiresAt  *time.Time `json:"expires_at"`                    // Nil berarti tidak kedaluwarsa
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedBy  uint       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// DTO untuk request Create API Key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,min=2,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=3650"` // Kosong berarti tidak kedaluwarsa
+}
+
+// Response Create API Key, satu-satunya saat key asli ditampilkan
+type CreateAPIKeyResponse struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
@@ -0,0 +1,39 @@
+package books
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AvailabilityEstimator memperkirakan kapan buku yang stoknya habis tersedia lagi.
+// Diisi modul loans saat Init karena data pinjaman ada di sana; nil berarti tanpa perkiraan.
+var AvailabilityEstimator func(db *gorm.DB, bookIDs []uint) (map[uint]time.Time, error)
+
+// fillAvailableFrom mengisi AvailableFrom untuk buku yang stoknya habis
+func (s *bookService) fillAvailableFrom(list []Book) error {
+	if AvailabilityEstimator == nil {
+		return nil
+	}
+
+	var ids []uint
+	for _, book := range list {
+		if book.Stock <= 0 {
+			ids = append(ids, book.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	estimates, err := AvailabilityEstimator(s.db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if at, ok := estimates[list[i].ID]; ok {
+			list[i].AvailableFrom = &at
+		}
+	}
+	return nil
+}
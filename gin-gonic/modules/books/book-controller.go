@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"gin-gonic/middlewares"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -27,6 +29,14 @@ func NewBookController(service BookService) BookController {
 	return &bookController{service: service}
 }
 
+// viewerID mengembalikan ID user yang login (diisi OptionalJWTMiddleware), 0 jika anonim
+func viewerID(ctx *gin.Context) uint {
+	if principal, ok := middlewares.CurrentPrincipal(ctx); ok {
+		return principal.UserID
+	}
+	return 0
+}
+
 func (c *bookController) GetList(ctx *gin.Context) {
 	books, err := c.service.GetList()
 	if err != nil {
@@ -43,7 +53,7 @@ func (c *bookController) GetList2(ctx *gin.Context) {
 	order := ctx.DefaultQuery("order", "DESC")
 	available := ctx.DefaultQuery("available", "false")
 
-	books, total, err := c.service.GetList2(page, limit, sortBy, order, available == "true")
+	books, total, err := c.service.GetList2(page, limit, sortBy, order, available == "true", viewerID(ctx))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -127,7 +137,7 @@ func (c *bookController) BulkDelete(ctx *gin.Context) {
 
 func (c *bookController) Search(ctx *gin.Context) {
 	q := ctx.Query("q")
-	books, err := c.service.Search(q)
+	books, err := c.service.Search(q, viewerID(ctx))
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
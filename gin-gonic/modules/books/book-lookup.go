@@ -0,0 +1,51 @@
+package books
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrBookNotFound dikembalikan Lookup jika ID atau barcode tidak cocok dengan buku mana pun
+var ErrBookNotFound = errors.New("book not found")
+
+// Lookup mencari buku berdasarkan ID atau barcode hasil scan (salah satu wajib diisi)
+func Lookup(db *gorm.DB, id uint, barcode string) (*Book, error) {
+	barcode = strings.TrimSpace(barcode)
+	if id == 0 && barcode == "" {
+		return nil, errors.New("book_id atau barcode wajib diisi")
+	}
+
+	query := db
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	}
+	if barcode != "" {
+		query = query.Where("barcode = ?", barcode)
+	}
+
+	var book Book
+	if err := query.First(&book).Error; err != nil {
+		return nil, ErrBookNotFound
+	}
+	return &book, nil
+}
+
+// setBarcode mengisi barcode buku jika diberikan dan memastikan belum dipakai buku lain
+func (s *bookService) setBarcode(book *Book, barcode string) error {
+	barcode = strings.TrimSpace(barcode)
+	if barcode == "" {
+		return nil
+	}
+
+	var count int64
+	if err := s.db.Unscoped().Model(&Book{}).Where("barcode = ? AND id <> ?", barcode, book.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("barcode sudah digunakan buku lain")
+	}
+	book.Barcode = &barcode
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"gin-gonic/helper"
 	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -35,19 +36,24 @@ func (s *BookServer) Init() {
 	service := NewBookService(s.db)
 	controller := NewBookController(service)
 
+	router := middlewares.NewRouter(s.router)
+	public := middlewares.Public()
+	canWrite := middlewares.RequirePermission(roles.PermBooksWrite)
+
 	// Public book routes
-	booksPublic := s.router.Group("/" + s.version + "/books")
-	booksPublic.GET("", controller.GetList)
-	booksPublic.GET("/all", controller.GetList2)
-	booksPublic.GET("/search", controller.Search)
-	booksPublic.GET("/:id", controller.GetByID)
+	booksPublic := router.Group("/" + s.version + "/books")
+	booksPublic.GET("", public, controller.GetList)
+	// Token opsional: buku dengan batas umur disembunyikan untuk user di bawah umur
+	optionalAuth := middlewares.OptionalJWTMiddleware()
+	booksPublic.GET("/all", public, optionalAuth, controller.GetList2)
+	booksPublic.GET("/search", public, optionalAuth, controller.Search)
+	booksPublic.GET("/:id", public, controller.GetByID)
 
 	// Admin book routes (protected)
-	adminBooks := s.router.Group("/" + s.version + "/admin/books")
-	adminBooks.Use(middlewares.JWTMiddleware(), middlewares.AdminMiddleware())
-	adminBooks.POST("", controller.Create)
-	adminBooks.PUT("/:id", controller.Update)
-	adminBooks.DELETE("/:id", controller.Delete)
-	adminBooks.DELETE("/bulk-delete", controller.BulkDelete)
-	adminBooks.PATCH("/:id/image", controller.UploadImage)
+	adminBooks := router.Group("/" + s.version + "/admin/books")
+	adminBooks.POST("", canWrite, controller.Create)
+	adminBooks.PUT("/:id", canWrite, controller.Update)
+	adminBooks.DELETE("/:id", canWrite, controller.Delete)
+	adminBooks.DELETE("/bulk-delete", canWrite, controller.BulkDelete)
+	adminBooks.PATCH("/:id/image", canWrite, controller.UploadImage)
 }
@@ -1,27 +1,26 @@
 package books
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"mime/multipart"
+	"strings"
 
 	"gin-gonic/helper"
+	"gin-gonic/modules/users"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"gorm.io/gorm"
 )
 
 type BookService interface {
 	GetList() ([]Book, error)
-	GetList2(page, limit int, sortBy, order string, available bool) ([]Book, int64, error)
+	GetList2(page, limit int, sortBy, order string, available bool, viewerID uint) ([]Book, int64, error)
 	GetByID(id string) (*Book, error)
 	Create(input *CreateBookRequest) (*Book, error)
 	Update(id string, input *UpdateBookRequest) (*Book, error)
 	Delete(id string) error
 	BulkDelete(ids []int) error
-	Search(query string) ([]Book, error)
+	Search(query string, viewerID uint) ([]Book, error)
 	UploadImage(id string, file *multipart.FileHeader) (*Book, error)
 	IncrementPopularity(bookID uint)error
 }
@@ -49,6 +48,25 @@ func (s *bookService) IncrementPopularity(bookID uint) error {
 	return nil
 }
 
+// hideRestricted menyembunyikan buku dengan batas umur di atas umur user yang login.
+// viewerID 0 (anonim) atau umur yang tidak diketahui tidak difilter, batas umur tetap dicek saat pinjam.
+func (s *bookService) hideRestricted(query *gorm.DB, viewerID uint) (*gorm.DB, error) {
+	if viewerID == 0 {
+		return query, nil
+	}
+	age, known, err := users.AgeOf(s.db, viewerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return query, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		return query, nil
+	}
+	return query.Where("min_age <= ?", age), nil
+}
+
 func (s *bookService) GetList() ([]Book, error) {
 	var books []Book
 	if err := s.db.Find(&books).Error; err != nil {
@@ -57,7 +75,7 @@ func (s *bookService) GetList() ([]Book, error) {
 	return books, nil
 }
 
-func (s *bookService) GetList2(page, limit int, sortBy, order string, available bool) ([]Book, int64, error) {
+func (s *bookService) GetList2(page, limit int, sortBy, order string, available bool, viewerID uint) ([]Book, int64, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -87,6 +105,10 @@ func (s *bookService) GetList2(page, limit int, sortBy, order string, available
 	if available {
 		query = query.Where("stock > ?", 0)
 	}
+	query, err := s.hideRestricted(query, viewerID)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	var books []Book
 	var total int64
@@ -96,6 +118,9 @@ func (s *bookService) GetList2(page, limit int, sortBy, order string, available
 	if err := query.Offset(offset).Limit(limit).Order(sortBy + " " + order).Find(&books).Error; err != nil {
 		return nil, 0, err
 	}
+	if err := s.fillAvailableFrom(books); err != nil {
+		return nil, 0, err
+	}
 
 	return books, total, nil
 }
@@ -110,10 +135,16 @@ func (s *bookService) GetByID(id string) (*Book, error) {
 
 func (s *bookService) Create(input *CreateBookRequest) (*Book, error) {
 	book := &Book{
-		Title:       input.Title,
-		Author:      input.Author,
-		Stock:       input.Stock,
-		BorrowCount: 0,
+		Title:           input.Title,
+		Author:          input.Author,
+		Stock:           input.Stock,
+		BorrowCount:     0,
+		MinAge:          input.MinAge,
+		Category:        strings.TrimSpace(input.Category),
+		ReplacementCost: input.ReplacementCost,
+	}
+	if err := s.setBarcode(book, input.Barcode); err != nil {
+		return nil, err
 	}
 
 	if err := s.db.Create(book).Error; err != nil {
@@ -138,6 +169,18 @@ func (s *bookService) Update(id string, input *UpdateBookRequest) (*Book, error)
 	if input.Stock != 0 {
 		book.Stock = input.Stock
 	}
+	if input.Category != "" {
+		book.Category = strings.TrimSpace(input.Category)
+	}
+	if input.MinAge != nil {
+		book.MinAge = *input.MinAge
+	}
+	if input.ReplacementCost != nil {
+		book.ReplacementCost = *input.ReplacementCost
+	}
+	if err := s.setBarcode(&book, input.Barcode); err != nil {
+		return nil, err
+	}
 
 	if err := s.db.Save(&book).Error; err != nil {
 		return nil, err
@@ -159,13 +202,18 @@ func (s *bookService) BulkDelete(ids []int) error {
 	return s.db.Delete(&[]Book{}, ids).Error
 }
 
-func (s *bookService) Search(query string) ([]Book, error) {
+func (s *bookService) Search(query string, viewerID uint) ([]Book, error) {
 	if query == "" {
 		return nil, errors.New("query parameter q is required")
 	}
 
+	db, err := s.hideRestricted(s.db.Where("title ILIKE ? OR author ILIKE ?", "%"+query+"%", "%"+query+"%"), viewerID)
+	if err != nil {
+		return nil, err
+	}
+
 	var books []Book
-	if err := s.db.Where("title ILIKE ? OR author ILIKE ?", "%"+query+"%", "%"+query+"%").Find(&books).Error; err != nil {
+	if err := db.Find(&books).Error; err != nil {
 		return nil, err
 	}
 	return books, nil
@@ -177,36 +225,12 @@ func (s *bookService) UploadImage(id string, file *multipart.FileHeader) (*Book,
 		return nil, errors.New("book not found")
 	}
 
-	config, err := helper.LoadConfig(".")
-	if err != nil {
-		return nil, errors.New("failed to load config")
-	}
-
-	if config.CloudinaryCloudName == "" || config.CloudinaryAPIKey == "" || config.CloudinaryAPISecret == "" {
-		return nil, errors.New("cloudinary config missing")
-	}
-
-	cld, err := cloudinary.NewFromParams(
-		config.CloudinaryCloudName,
-		config.CloudinaryAPIKey,
-		config.CloudinaryAPISecret,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	fileReader, err := file.Open()
-	if err != nil {
-		return nil, err
-	}
-	defer fileReader.Close()
-
-	uploadResult, err := cld.Upload.Upload(context.Background(), fileReader, uploader.UploadParams{})
+	imageURL, err := helper.UploadImage(file)
 	if err != nil {
 		return nil, err
 	}
 
-	book.ImageURL = uploadResult.SecureURL
+	book.ImageURL = imageURL
 	if err := s.db.Save(&book).Error; err != nil {
 		return nil, err
 	}
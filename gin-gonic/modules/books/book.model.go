@@ -7,12 +7,19 @@ import (
 )
 
 type Book struct {
-	ID          uint   `json:"id" gorm:"primaryKey;autoIncrement"`
-	Title       string `json:"title" gorm:"not null"`
-	Author      string `json:"author"`
-	Stock       int    `json:"stock" gorm:"default:0"` // [NEW] Menyimpan jumlah stok
-	BorrowCount int    `json:"borrow_count" gorm:"default:0"`
-	ImageURL    string `json:"image_url"`
+	ID          uint    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Title       string  `json:"title" gorm:"not null"`
+	Author      string  `json:"author"`
+	Stock       int     `json:"stock" gorm:"default:0"` // [NEW] Menyimpan jumlah stok
+	BorrowCount int     `json:"borrow_count" gorm:"default:0"`
+	ImageURL    string  `json:"image_url"`
+	MinAge      int     `json:"min_age" gorm:"not null;default:0"` // Umur minimal peminjam, 0 berarti semua umur
+	Category    string  `json:"category" gorm:"index"`
+	Barcode     *string `json:"barcode" gorm:"uniqueIndex;size:64"` // Barcode di buku untuk kiosk/meja pinjam, nil jika belum ada
+	// Biaya penggantian (rupiah) yang dikenakan jika buku hilang atau rusak
+	ReplacementCost int64 `json:"replacement_cost" gorm:"not null;default:0"`
+	// Perkiraan kapan buku yang stoknya habis tersedia lagi, hanya diisi GetList2
+	AvailableFrom *time.Time `json:"available_from,omitempty" gorm:"-"`
 	// fine        int64          `json:"fine" gorm:"default:0"`
 	CreatedAt time.Time      `json:"created_at"`     // [NEW] Waktu dibuat
 	UpdatedAt time.Time      `json:"updated_at"`     // [NEW] Waktu terakhir diedit
@@ -29,11 +36,21 @@ type CreateBookRequest struct {
 	Author      string `json:"author" binding:"required,min=2,max=100"`
 	Stock       int    `json:"stock" binding:"required,min=0"` // [NEW] Wajib isi stok minimal 0
 	BorrowCount int    `json:"borrow_count" gorm:"default:0"`
+	MinAge      int    `json:"min_age" binding:"omitempty,min=0,max=99"`
+	Category    string `json:"category" binding:"omitempty,max=50"`
+	Barcode     string `json:"barcode" binding:"omitempty,max=64"`
+	// Biaya penggantian jika buku hilang atau rusak
+	ReplacementCost int64 `json:"replacement_cost" binding:"omitempty,min=0"`
 }
 
 // Struct untuk validasi saat update buku (opsional fieldnya)
 type UpdateBookRequest struct {
-	Title  string `json:"title" binding:"omitempty,min=2,max=100"`
-	Author string `json:"author" binding:"omitempty,min=2,max=100"`
-	Stock  int    `json:"stock" binding:"omitempty,min=0"` // [NEW] Update stok
+	Title    string `json:"title" binding:"omitempty,min=2,max=100"`
+	Author   string `json:"author" binding:"omitempty,min=2,max=100"`
+	Stock    int    `json:"stock" binding:"omitempty,min=0"`          // [NEW] Update stok
+	MinAge   *int   `json:"min_age" binding:"omitempty,min=0,max=99"` // Pointer agar bisa diubah ke 0
+	Category string `json:"category" binding:"omitempty,max=50"`
+	Barcode  string `json:"barcode" binding:"omitempty,max=64"`
+	// Pointer agar bisa diubah ke 0
+	ReplacementCost *int64 `json:"replacement_cost" binding:"omitempty,min=0"`
 }
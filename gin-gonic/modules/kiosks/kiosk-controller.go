@@ -0,0 +1,189 @@
+package kiosks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/loans"
+	"gin-gonic/modules/memberships"
+	"gin-gonic/modules/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KioskController interface {
+	Register(ctx *gin.Context)
+	GetList(ctx *gin.Context)
+	Revoke(ctx *gin.Context)
+	GetActivity(ctx *gin.Context)
+	StartSession(ctx *gin.Context)
+	Checkout(ctx *gin.Context)
+	Checkin(ctx *gin.Context)
+}
+
+type kioskController struct {
+	service KioskService
+}
+
+func NewKioskController(service KioskService) KioskController {
+	return &kioskController{service: service}
+}
+
+func (c *kioskController) Register(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input RegisterKioskRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	result, err := c.service.Register(principal.UserID, &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *kioskController) GetList(ctx *gin.Context) {
+	kiosks, err := c.service.GetList()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": kiosks})
+}
+
+func (c *kioskController) Revoke(ctx *gin.Context) {
+	if err := c.service.Revoke(ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Kiosk berhasil dicabut"})
+}
+
+func (c *kioskController) GetActivity(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+
+	activities, total, err := c.service.GetActivity(ctx.Param("id"), page, limit)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":      activities,
+		"total_row": total,
+	})
+}
+
+func (c *kioskController) StartSession(ctx *gin.Context) {
+	kiosk, ok := CurrentKiosk(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Kiosk not authenticated"})
+		return
+	}
+
+	var input users.KioskLoginRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	meta := users.LoginMeta{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	result, err := c.service.StartSession(kiosk, &input, meta)
+	var throttled *users.LoginThrottledError
+	if errors.As(err, &throttled) {
+		ctx.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, users.ErrCardPINLocked) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// patronSession mengambil perangkat kiosk dan patron dari request. Patron wajib memakai
+// token sesi kiosk, bukan token login biasa yang mungkin tertinggal di perangkat.
+func patronSession(ctx *gin.Context) (*Kiosk, uint, bool) {
+	kiosk, ok := CurrentKiosk(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Kiosk not authenticated"})
+		return nil, 0, false
+	}
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, 0, false
+	}
+	if principal.Scope != middlewares.ScopeKiosk {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Gunakan sesi kiosk (kartu anggota dan PIN)"})
+		return nil, 0, false
+	}
+	// Sesi hanya berlaku di perangkat tempat patron login
+	if principal.KioskID != kiosk.ID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Sesi kiosk berasal dari perangkat lain"})
+		return nil, 0, false
+	}
+	return kiosk, principal.UserID, true
+}
+
+func (c *kioskController) Checkout(ctx *gin.Context) {
+	kiosk, userID, ok := patronSession(ctx)
+	if !ok {
+		return
+	}
+
+	var input KioskBookRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	loan, err := c.service.Checkout(kiosk, userID, &input, ctx.ClientIP())
+	if errors.Is(err, loans.ErrEmailNotVerified) || errors.Is(err, loans.ErrAgeRestricted) || errors.Is(err, loans.ErrGuardianApprovalRequired) ||
+		errors.Is(err, memberships.ErrMembershipExpired) || errors.Is(err, loans.ErrLoanLimitReached) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, loan)
+}
+
+func (c *kioskController) Checkin(ctx *gin.Context) {
+	kiosk, userID, ok := patronSession(ctx)
+	if !ok {
+		return
+	}
+
+	var input KioskBookRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	loan, err := c.service.Checkin(kiosk, userID, &input, ctx.ClientIP())
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, loan)
+}
@@ -0,0 +1,52 @@
+package kiosks
+
+import (
+	"errors"
+	"net/http"
+
+	"gin-gonic/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceKeyHeader adalah header berisi key perangkat kiosk
+const DeviceKeyHeader = "X-Kiosk-Key"
+
+const kioskKey = "kiosk"
+
+// RequireDevice memastikan request berasal dari perangkat kiosk terdaftar.
+// Dipasang setelah policy route sehingga token patron sudah divalidasi lebih dulu.
+func RequireDevice(service KioskService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader(DeviceKeyHeader)
+		if rawKey == "" {
+			helper.ErrorResponse(c, http.StatusUnauthorized, "Kiosk key required", nil)
+			c.Abort()
+			return
+		}
+
+		kiosk, err := service.Authenticate(rawKey)
+		if err != nil {
+			if errors.Is(err, ErrInvalidKioskKey) {
+				helper.ErrorResponse(c, http.StatusUnauthorized, "Invalid kiosk key", err.Error())
+			} else {
+				helper.InternalServerError(c, "Failed to validate kiosk key", err.Error())
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set(kioskKey, kiosk)
+		c.Next()
+	}
+}
+
+// CurrentKiosk mengambil perangkat kiosk dari gin.Context
+func CurrentKiosk(c *gin.Context) (*Kiosk, bool) {
+	value, exists := c.Get(kioskKey)
+	if !exists {
+		return nil, false
+	}
+	kiosk, ok := value.(*Kiosk)
+	return kiosk, ok && kiosk != nil
+}
@@ -0,0 +1,61 @@
+package kiosks
+
+import (
+	"log"
+
+	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/loans"
+	"gin-gonic/modules/roles"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"gorm.io/gorm"
+)
+
+type KioskServer struct {
+	router  *gin.RouterGroup
+	db      *gorm.DB
+	nc      *nats.Conn
+	version string
+}
+
+func NewKioskServer(router *gin.RouterGroup, db *gorm.DB, nc *nats.Conn, version string) *KioskServer {
+	return &KioskServer{router: router, db: db, nc: nc, version: version}
+}
+
+func (s *KioskServer) Init() {
+	config, err := helper.LoadConfig(".")
+	if err != nil {
+		log.Fatal("Cannot load config:", err)
+	}
+
+	if config.AUTO_MIGRATE == "Y" {
+		if err := s.db.AutoMigrate(&Kiosk{}, &KioskActivity{}); err != nil {
+			log.Printf("Failed to auto migrate Kiosk: %v", err)
+		}
+	}
+
+	// Token sesi kiosk hanya berlaku selama perangkatnya belum dicabut
+	middlewares.SetKioskStore(NewKioskStore(s.db))
+
+	service := NewKioskService(s.db, loans.NewLoanService(s.db, s.nc))
+	controller := NewKioskController(service)
+	device := RequireDevice(service)
+
+	router := middlewares.NewRouter(s.router)
+	// Key perangkat berlaku lama, tidak boleh dibuat dari token impersonate
+	canManage := middlewares.RequirePermission(roles.PermKiosksManage).WithoutImpersonation()
+
+	adminKiosks := router.Group("/" + s.version + "/admin/kiosks")
+	adminKiosks.GET("", canManage, controller.GetList)
+	adminKiosks.POST("", canManage, controller.Register)
+	adminKiosks.DELETE("/:id", canManage, controller.Revoke)
+	adminKiosks.GET("/:id/activity", canManage, controller.GetActivity)
+
+	// Dipanggil perangkat kiosk (header X-Kiosk-Key). Pinjam dan kembali memakai token sesi patron.
+	kioskRoutes := router.Group("/" + s.version + "/kiosk")
+	kioskRoutes.POST("/session", middlewares.Public(), device, controller.StartSession)
+	kioskRoutes.POST("/checkout", middlewares.Authenticated().AllowScope(middlewares.ScopeKiosk), device, controller.Checkout)
+	kioskRoutes.POST("/checkin", middlewares.Authenticated().AllowScope(middlewares.ScopeKiosk), device, controller.Checkin)
+}
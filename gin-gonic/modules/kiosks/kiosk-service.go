@@ -0,0 +1,193 @@
+package kiosks
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gin-gonic/modules/books"
+	"gin-gonic/modules/loans"
+	"gin-gonic/modules/users"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// keyPrefix menandai key perangkat kiosk agar tidak tertukar dengan API key
+	keyPrefix = "kk_"
+	// lastSeenInterval membatasi seberapa sering last_seen_at ditulis
+	lastSeenInterval = time.Minute
+)
+
+// ErrInvalidKioskKey dikembalikan Authenticate jika key perangkat tidak dikenal atau sudah dicabut
+var ErrInvalidKioskKey = errors.New("perangkat kiosk tidak terdaftar atau sudah dicabut")
+
+type KioskService interface {
+	Register(actorID uint, input *RegisterKioskRequest) (*RegisterKioskResponse, error)
+	GetList() ([]Kiosk, error)
+	Revoke(id string) error
+	GetActivity(id string, page, limit int) ([]KioskActivity, int64, error)
+	Authenticate(rawKey string) (*Kiosk, error)
+	StartSession(kiosk *Kiosk, input *users.KioskLoginRequest, meta users.LoginMeta) (*users.KioskLoginResponse, error)
+	Checkout(kiosk *Kiosk, userID uint, input *KioskBookRequest, ip string) (*loans.Loan, error)
+	Checkin(kiosk *Kiosk, userID uint, input *KioskBookRequest, ip string) (*loans.Loan, error)
+}
+
+type kioskService struct {
+	db    *gorm.DB
+	loans loans.LoanService
+}
+
+func NewKioskService(db *gorm.DB, loanService loans.LoanService) KioskService {
+	return &kioskService{db: db, loans: loanService}
+}
+
+func (s *kioskService) Register(actorID uint, input *RegisterKioskRequest) (*RegisterKioskResponse, error) {
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	rawKey := keyPrefix + secret
+
+	kiosk := Kiosk{
+		Name:         input.Name,
+		Location:     input.Location,
+		Prefix:       rawKey[:len(keyPrefix)+8],
+		KeyHash:      utils.HashToken(rawKey),
+		RegisteredBy: actorID,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.db.Create(&kiosk).Error; err != nil {
+		return nil, err
+	}
+
+	return &RegisterKioskResponse{Key: rawKey, Kiosk: kiosk}, nil
+}
+
+func (s *kioskService) GetList() ([]Kiosk, error) {
+	var kiosks []Kiosk
+	if err := s.db.Order("created_at DESC").Find(&kiosks).Error; err != nil {
+		return nil, err
+	}
+	return kiosks, nil
+}
+
+func (s *kioskService) Revoke(id string) error {
+	var kiosk Kiosk
+	if err := s.db.Where("id = ?", id).First(&kiosk).Error; err != nil {
+		return errors.New("kiosk not found")
+	}
+	if kiosk.RevokedAt != nil {
+		return errors.New("kiosk already revoked")
+	}
+	return s.db.Model(&kiosk).Update("revoked_at", time.Now()).Error
+}
+
+// GetActivity mengembalikan log aktivitas satu perangkat kiosk, terbaru lebih dulu
+func (s *kioskService) GetActivity(id string, page, limit int) ([]KioskActivity, int64, error) {
+	var kiosk Kiosk
+	if err := s.db.Where("id = ?", id).First(&kiosk).Error; err != nil {
+		return nil, 0, errors.New("kiosk not found")
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := s.db.Model(&KioskActivity{}).Where("kiosk_id = ?", kiosk.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var activities []KioskActivity
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&activities).Error; err != nil {
+		return nil, 0, err
+	}
+	return activities, total, nil
+}
+
+// Authenticate mencari perangkat kiosk aktif berdasarkan key perangkat
+func (s *kioskService) Authenticate(rawKey string) (*Kiosk, error) {
+	now := time.Now()
+	var kiosk Kiosk
+	err := s.db.Where("key_hash = ? AND revoked_at IS NULL", utils.HashToken(rawKey)).First(&kiosk).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidKioskKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// last_seen_at cukup akurat per menit, tidak perlu ditulis di setiap request
+	if kiosk.LastSeenAt == nil || now.Sub(*kiosk.LastSeenAt) > lastSeenInterval {
+		s.db.Model(&kiosk).UpdateColumn("last_seen_at", now)
+	}
+	return &kiosk, nil
+}
+
+// record menyimpan aktivitas kiosk. Gagal menyimpan tidak menggagalkan aksi patron.
+func (s *kioskService) record(activity KioskActivity, err error) {
+	activity.Success = err == nil
+	if err != nil {
+		activity.Detail = err.Error()
+	}
+	activity.CreatedAt = time.Now()
+	if dbErr := s.db.Create(&activity).Error; dbErr != nil {
+		log.Printf("Failed to record kiosk activity: %v", dbErr)
+	}
+}
+
+// StartSession melakukan login patron dengan kartu anggota dan PIN di perangkat kiosk
+func (s *kioskService) StartSession(kiosk *Kiosk, input *users.KioskLoginRequest, meta users.LoginMeta) (*users.KioskLoginResponse, error) {
+	session, err := users.KioskSession(s.db, kiosk.ID, input, meta)
+
+	activity := KioskActivity{KioskID: kiosk.ID, Action: ActivitySession, IP: meta.IP}
+	if session != nil {
+		activity.UserID = &session.User.ID
+	}
+	s.record(activity, err)
+	return session, err
+}
+
+// Checkout meminjam buku (ID atau barcode) untuk patron yang login di kiosk
+func (s *kioskService) Checkout(kiosk *Kiosk, userID uint, input *KioskBookRequest, ip string) (*loans.Loan, error) {
+	activity := KioskActivity{KioskID: kiosk.ID, UserID: &userID, Action: ActivityCheckout, IP: ip}
+
+	book, err := books.Lookup(s.db, input.BookID, input.Barcode)
+	if err != nil {
+		s.record(activity, err)
+		return nil, err
+	}
+	activity.BookID = &book.ID
+
+	loan, err := s.loans.KioskBorrow(kiosk.ID, userID, &loans.LoanRequest{BookID: book.ID})
+	if loan != nil {
+		activity.LoanID = &loan.ID
+	}
+	s.record(activity, err)
+	return loan, err
+}
+
+// Checkin mengembalikan buku (ID atau barcode) yang dipinjam patron yang login di kiosk
+func (s *kioskService) Checkin(kiosk *Kiosk, userID uint, input *KioskBookRequest, ip string) (*loans.Loan, error) {
+	activity := KioskActivity{KioskID: kiosk.ID, UserID: &userID, Action: ActivityCheckin, IP: ip}
+
+	book, err := books.Lookup(s.db, input.BookID, input.Barcode)
+	if err != nil {
+		s.record(activity, err)
+		return nil, err
+	}
+	activity.BookID = &book.ID
+
+	loan, err := s.loans.KioskReturn(kiosk.ID, userID, book.ID)
+	if loan != nil {
+		activity.LoanID = &loan.ID
+	}
+	s.record(activity, err)
+	return loan, err
+}
@@ -0,0 +1,24 @@
+package kiosks
+
+import (
+	"gin-gonic/middlewares"
+
+	"gorm.io/gorm"
+)
+
+type kioskStore struct {
+	db *gorm.DB
+}
+
+// NewKioskStore membuat KioskStore untuk memvalidasi token sesi kiosk di setiap request
+func NewKioskStore(db *gorm.DB) middlewares.KioskStore {
+	return &kioskStore{db: db}
+}
+
+func (s *kioskStore) KioskActive(kioskID uint) (bool, error) {
+	var count int64
+	if err := s.db.Model(&Kiosk{}).Where("id = ? AND revoked_at IS NULL", kioskID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
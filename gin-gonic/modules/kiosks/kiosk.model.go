@@ -0,0 +1,64 @@
+package kiosks
+
+import "time"
+
+// Aksi perangkat kiosk yang dicatat di log aktivitas
+const (
+	ActivitySession  = "session"
+	ActivityCheckout = "checkout"
+	ActivityCheckin  = "checkin"
+)
+
+// Kiosk adalah perangkat self-checkout yang terdaftar. Key perangkat hanya ditampilkan
+// sekali saat didaftarkan, yang disimpan hanya hash SHA-256 dan prefix untuk identifikasi.
+type Kiosk struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"not null"`
+	Location     string     `json:"location"`
+	Prefix       string     `json:"prefix" gorm:"index;not null"`
+	KeyHash      string     `json:"-" gorm:"uniqueIndex;not null"`
+	RegisteredBy uint       `json:"registered_by"`
+	LastSeenAt   *time.Time `json:"last_seen_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (Kiosk) TableName() string {
+	return "kiosks"
+}
+
+// KioskActivity mencatat setiap aksi di perangkat kiosk beserta patron yang melakukannya
+type KioskActivity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	KioskID   uint      `json:"kiosk_id" gorm:"index;not null"`
+	UserID    *uint     `json:"user_id" gorm:"index"` // Nil jika patron belum dikenali (login gagal)
+	Action    string    `json:"action" gorm:"not null"`
+	BookID    *uint     `json:"book_id"`
+	LoanID    *uint     `json:"loan_id"`
+	Success   bool      `json:"success"`
+	Detail    string    `json:"detail"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (KioskActivity) TableName() string {
+	return "kiosk_activities"
+}
+
+// DTO untuk request pendaftaran perangkat kiosk
+type RegisterKioskRequest struct {
+	Name     string `json:"name" binding:"required,min=2,max=100"`
+	Location string `json:"location" binding:"omitempty,max=255"`
+}
+
+// Response pendaftaran kiosk, satu-satunya saat key perangkat ditampilkan
+type RegisterKioskResponse struct {
+	Key   string `json:"key"`
+	Kiosk Kiosk  `json:"kiosk"`
+}
+
+// DTO untuk pinjam atau kembali buku di kiosk, cukup salah satu dari book_id atau barcode
+type KioskBookRequest struct {
+	BookID  uint   `json:"book_id"`
+	Barcode string `json:"barcode" binding:"omitempty,max=64"`
+}
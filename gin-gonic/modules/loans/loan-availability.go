@@ -0,0 +1,159 @@
+package loans
+
+import (
+	"sort"
+	"time"
+
+	"gin-gonic/modules/books"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Jumlah pengembalian terakhir yang dipakai menghitung median keterlambatan
+	latenessSampleSize = 200
+	// Judul dengan sampel lebih sedikit memakai median seluruh perpustakaan
+	minLatenessSamples = 5
+)
+
+// forecastStatuses adalah pinjaman yang diperkirakan akan kembali ke rak
+var forecastStatuses = []string{LoanBorrowed, LoanOverdue}
+
+// lateSample adalah tanggal harus kembali dan waktu kembali satu pinjaman
+type lateSample struct {
+	BookID     uint
+	ReturnDate time.Time
+	ReturnedAt time.Time
+}
+
+func medianLateness(samples []lateSample) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	values := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		values[i] = sample.ReturnedAt.Sub(sample.ReturnDate)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values[len(values)/2]
+}
+
+// latenessOf menghitung median keterlambatan pengembalian per buku.
+// Hanya pinjaman yang punya returned_at yang dihitung karena return_date pinjaman lama sudah tertimpa.
+func latenessOf(db *gorm.DB, bookIDs []uint) (map[uint]time.Duration, error) {
+	var rows []lateSample
+	if err := db.Model(&Loan{}).Select("book_id", "return_date", "returned_at").
+		Where("book_id IN ? AND returned_at IS NOT NULL", bookIDs).
+		Order("returned_at DESC").Limit(latenessSampleSize * len(bookIDs)).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	perBook := make(map[uint][]lateSample, len(bookIDs))
+	for _, row := range rows {
+		if len(perBook[row.BookID]) < latenessSampleSize {
+			perBook[row.BookID] = append(perBook[row.BookID], row)
+		}
+	}
+
+	var overall []lateSample
+	if err := db.Model(&Loan{}).Select("book_id", "return_date", "returned_at").
+		Where("returned_at IS NOT NULL").
+		Order("returned_at DESC").Limit(latenessSampleSize).Scan(&overall).Error; err != nil {
+		return nil, err
+	}
+	fallback := medianLateness(overall)
+
+	result := make(map[uint]time.Duration, len(bookIDs))
+	for _, id := range bookIDs {
+		if len(perBook[id]) >= minLatenessSamples {
+			result[id] = medianLateness(perBook[id])
+		} else {
+			result[id] = fallback
+		}
+	}
+	return result, nil
+}
+
+// expectedReturn memperkirakan waktu buku kembali dari tanggal harus kembali dan median keterlambatan.
+// Pinjaman yang sudah lewat perkiraan dianggap bisa kembali kapan saja.
+func expectedReturn(due time.Time, lateness time.Duration, now time.Time) time.Time {
+	at := due.Add(lateness)
+	if at.Before(now) {
+		return now
+	}
+	return at
+}
+
+// AvailableFrom memperkirakan kapan buku yang stoknya habis tersedia lagi, yaitu perkiraan
+// kembalinya pinjaman aktif paling awal. Buku tanpa pinjaman aktif tidak ada di hasil.
+// Reservasi belum ada, jadi eksemplar yang kembali dianggap langsung tersedia.
+func AvailableFrom(db *gorm.DB, bookIDs []uint) (map[uint]time.Time, error) {
+	result := make(map[uint]time.Time)
+	if len(bookIDs) == 0 {
+		return result, nil
+	}
+
+	var earliest []struct {
+		BookID  uint
+		DueDate time.Time
+	}
+	if err := db.Model(&Loan{}).Select("book_id, MIN(return_date) AS due_date").
+		Where("book_id IN ? AND status IN ?", bookIDs, forecastStatuses).
+		Group("book_id").Scan(&earliest).Error; err != nil {
+		return nil, err
+	}
+	if len(earliest) == 0 {
+		return result, nil
+	}
+
+	lateness, err := latenessOf(db, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, row := range earliest {
+		result[row.BookID] = expectedReturn(row.DueDate, lateness[row.BookID], now)
+	}
+	return result, nil
+}
+
+// GetAvailability mengembalikan stok, tanggal kembali pinjaman aktif dan perkiraan buku tersedia lagi
+func (s *loanService) GetAvailability(bookID string) (*BookAvailability, error) {
+	var book books.Book
+	if err := s.db.First(&book, bookID).Error; err != nil {
+		return nil, books.ErrBookNotFound
+	}
+
+	var active []Loan
+	if err := s.db.Select("id", "return_date").Where("book_id = ? AND status IN ?", book.ID, forecastStatuses).
+		Order("return_date").Find(&active).Error; err != nil {
+		return nil, err
+	}
+	lateness, err := latenessOf(s.db, []uint{book.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	availability := &BookAvailability{
+		BookID:         book.ID,
+		Stock:          book.Stock,
+		Available:      book.Stock > 0,
+		ActiveLoans:    make([]LoanDue, 0, len(active)),
+		MedianLateDays: lateness[book.ID].Hours() / 24,
+	}
+	for _, loan := range active {
+		availability.ActiveLoans = append(availability.ActiveLoans, LoanDue{
+			DueDate: loan.ReturnDate,
+			Overdue: loan.ReturnDate.Before(now),
+		})
+	}
+
+	switch {
+	case availability.Available:
+		availability.EstimatedAvailableAt = &now
+	case len(active) > 0:
+		at := expectedReturn(active[0].ReturnDate, lateness[book.ID], now)
+		availability.EstimatedAvailableAt = &at
+	}
+	return availability, nil
+}
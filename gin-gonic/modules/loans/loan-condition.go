@@ -0,0 +1,161 @@
+package loans
+
+import (
+	"errors"
+	"mime/multipart"
+
+	"gin-gonic/helper"
+	"gin-gonic/modules/books"
+
+	"gorm.io/gorm"
+)
+
+// maxConditionPhotos adalah jumlah foto maksimal per penilaian kondisi
+const maxConditionPhotos = 5
+
+var errConditionAssessed = errors.New("kondisi buku untuk pinjaman ini sudah dinilai")
+
+// CheckIn menerima buku dari peminjam sekaligus mencatat kondisinya.
+// Pinjaman yang sudah dikembalikan (misalnya lewat kiosk) tetap bisa dinilai setelahnya.
+// Buku rusak ditarik dari sirkulasi dan peminjam dikenakan biaya kerusakan.
+func (s *loanService) CheckIn(id string, staffID uint, input *CheckInRequest) (*Loan, error) {
+	var loan Loan
+	if err := s.db.First(&loan, id).Error; err != nil {
+		return nil, errors.New("loan not found")
+	}
+
+	var assessed int64
+	if err := s.db.Model(&LoanCondition{}).Where("loan_id = ?", loan.ID).Count(&assessed).Error; err != nil {
+		return nil, err
+	}
+	if assessed > 0 {
+		return nil, errConditionAssessed
+	}
+
+	returning := loan.Status != LoanReturned && loan.Status != LoanDamaged
+	origin := loanOrigin{ActorID: staffID, StaffID: &staffID}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkInTx(tx, &loan, input, origin); err != nil {
+			return err
+		}
+		return tx.Create(&LoanCondition{
+			LoanID:     loan.ID,
+			BookID:     loan.BookID,
+			UserID:     loan.UserID,
+			Condition:  input.Condition,
+			Notes:      input.Notes,
+			Photos:     []string{},
+			AssessedBy: staffID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if returning {
+		s.publishReturned(&loan)
+	}
+	go s.broadcastStats()
+
+	var fullLoan Loan
+	if err := s.db.Preload("User").Preload("Book").First(&fullLoan, loan.ID).Error; err != nil {
+		return nil, err
+	}
+	return &fullLoan, nil
+}
+
+// checkInTx memindahkan status pinjaman sesuai kondisi buku dan menyimpan kondisinya di pinjaman
+func checkInTx(tx *gorm.DB, loan *Loan, input *CheckInRequest, origin loanOrigin) error {
+	from := loan.Status
+	switch {
+	case from == LoanDamaged:
+		// Sudah ditandai rusak (dan didenda) sebelumnya, penilaian hanya melengkapi catatan
+		if input.Condition != ConditionDamaged {
+			return ErrInvalidTransition
+		}
+	case input.Condition == ConditionDamaged:
+		var updates map[string]interface{}
+		if from != LoanReturned {
+			updates = returnUpdates(origin)
+		}
+		if err := damageTx(tx, loan, origin, input.Amount, input.Notes, updates); err != nil {
+			return err
+		}
+		if err := lateFeeTx(tx, loan, from, origin); err != nil {
+			return err
+		}
+	case from != LoanReturned:
+		if err := returnTx(tx, loan, origin); err != nil {
+			return err
+		}
+	}
+
+	loan.ReturnCondition = input.Condition
+	return tx.Model(&Loan{}).Where("id = ?", loan.ID).Update("return_condition", input.Condition).Error
+}
+
+// AddConditionPhoto mengunggah foto kondisi buku untuk pinjaman yang sudah dinilai
+func (s *loanService) AddConditionPhoto(id string, file *multipart.FileHeader) (*LoanCondition, error) {
+	var condition LoanCondition
+	if err := s.db.Where("loan_id = ?", id).First(&condition).Error; err != nil {
+		return nil, errors.New("kondisi buku untuk pinjaman ini belum dinilai")
+	}
+	if len(condition.Photos) >= maxConditionPhotos {
+		return nil, errors.New("jumlah foto kondisi sudah maksimal")
+	}
+
+	photoURL, err := helper.UploadImage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	condition.Photos = append(condition.Photos, photoURL)
+	if err := s.db.Model(&condition).Select("photos").Updates(&condition).Error; err != nil {
+		return nil, err
+	}
+	return &condition, nil
+}
+
+// GetBookConditions mengembalikan riwayat kondisi satu judul buku, terbaru lebih dulu
+func (s *loanService) GetBookConditions(bookID string) ([]LoanCondition, error) {
+	var book books.Book
+	if err := s.db.Unscoped().Select("id").First(&book, bookID).Error; err != nil {
+		return nil, books.ErrBookNotFound
+	}
+
+	var conditions []LoanCondition
+	if err := s.db.Where("book_id = ?", book.ID).Order("created_at DESC").Find(&conditions).Error; err != nil {
+		return nil, err
+	}
+	return conditions, nil
+}
+
+// GetDamageReport menghitung buku rusak dan aus per patron ("patron") atau per judul ("title")
+func (s *loanService) GetDamageReport(by string) ([]DamageReportRow, error) {
+	var id, name, join string
+	switch by {
+	case "patron":
+		id, name = "loan_conditions.user_id", "users.name"
+		join = "JOIN users ON users.id = loan_conditions.user_id"
+	case "title":
+		id, name = "loan_conditions.book_id", "books.title"
+		join = "JOIN books ON books.id = loan_conditions.book_id"
+	default:
+		return nil, errors.New("parameter by harus patron atau title")
+	}
+	var rows []DamageReportRow
+	err := s.db.Model(&LoanCondition{}).
+		Select(id+" AS id, "+name+" AS name, "+
+			"SUM(CASE WHEN loan_conditions.condition = ? THEN 1 ELSE 0 END) AS damaged, "+
+			"SUM(CASE WHEN loan_conditions.condition = ? THEN 1 ELSE 0 END) AS worn, "+
+			"MAX(loan_conditions.created_at) AS last_assessed_at", ConditionDamaged, ConditionWorn).
+		Joins(join).
+		Where("loan_conditions.condition IN ?", []string{ConditionDamaged, ConditionWorn}).
+		Group(id + ", " + name).
+		Order("damaged DESC, worn DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -1,7 +1,14 @@
 package loans
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/memberships"
+	"gin-gonic/modules/roles"
+	"gin-gonic/modules/users"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,6 +20,25 @@ type LoanController interface {
 	Return(ctx *gin.Context)
 	GetMy(ctx *gin.Context)
 	GetAll(ctx *gin.Context)
+	GrantAgeOverride(ctx *gin.Context)
+	GetChildLoans(ctx *gin.Context)
+	GetChildFines(ctx *gin.Context)
+	Renew(ctx *gin.Context)
+	ApproveForChild(ctx *gin.Context)
+	DeskCheckout(ctx *gin.Context)
+	DeskReturn(ctx *gin.Context)
+	MarkLost(ctx *gin.Context)
+	MarkDamaged(ctx *gin.Context)
+	MarkClaimedReturned(ctx *gin.Context)
+	GetHistory(ctx *gin.Context)
+	GetMyFines(ctx *gin.Context)
+	GetFines(ctx *gin.Context)
+	SettleFine(ctx *gin.Context)
+	CheckIn(ctx *gin.Context)
+	AddConditionPhoto(ctx *gin.Context)
+	GetBookConditions(ctx *gin.Context)
+	GetDamageReport(ctx *gin.Context)
+	GetAvailability(ctx *gin.Context)
 }
 
 type loanController struct {
@@ -42,15 +68,9 @@ func (c *loanController) GetPopularBooks(ctx *gin.Context) {
 }
 
 func (c *loanController) Borrow(ctx *gin.Context) {
-	userIDVal, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	userIDFloat, ok := userIDVal.(float64)
+	principal, ok := middlewares.CurrentPrincipal(ctx)
 	if !ok {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
@@ -60,7 +80,11 @@ func (c *loanController) Borrow(ctx *gin.Context) {
 		return
 	}
 
-	loan, err := c.service.Borrow(uint(userIDFloat), &input)
+	loan, err := c.service.Borrow(principal.UserID, &input)
+	if borrowForbidden(err) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -70,28 +94,45 @@ func (c *loanController) Borrow(ctx *gin.Context) {
 }
 
 func (c *loanController) Return(ctx *gin.Context) {
+	var actorID uint
+	staff := false
+	if principal, ok := middlewares.CurrentPrincipal(ctx); ok {
+		actorID = principal.UserID
+		// Token kiosk tidak punya permission, jadi selalu dianggap peminjam
+		staff = principal.HasPermission(roles.PermLoansCheckout)
+	}
+
 	id := ctx.Param("id")
-	if err := c.service.Return(id); err != nil {
+	if err := c.service.Return(id, actorID, staff); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"message": "Book returned successfully"})
 }
 
-func (c *loanController) GetMy(ctx *gin.Context) {
-	userIDVal, exists := ctx.Get("user_id")
-	if !exists {
+func (c *loanController) Renew(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	userIDFloat, ok := userIDVal.(float64)
+	loan, err := c.service.Renew(ctx.Param("id"), principal.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, loan)
+}
+
+func (c *loanController) GetMy(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
 	if !ok {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	loans, err := c.service.GetMy(uint(userIDFloat))
+	loans, err := c.service.GetMy(principal.UserID)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -109,3 +150,329 @@ func (c *loanController) GetAll(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"data": loans})
 }
+
+func (c *loanController) GrantAgeOverride(ctx *gin.Context) {
+	var input AgeOverrideRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	meta := users.AuditMeta{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	if principal, ok := middlewares.CurrentPrincipal(ctx); ok {
+		meta.ActorID = principal.UserID
+	}
+
+	override, err := c.service.GrantAgeOverride(&input, meta)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, override)
+}
+
+func (c *loanController) GetChildLoans(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	childID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID tidak valid"})
+		return
+	}
+
+	loans, err := c.service.GetChildLoans(principal.UserID, uint(childID))
+	if errors.Is(err, users.ErrNotGuardian) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": loans})
+}
+
+func (c *loanController) GetChildFines(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	childID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID tidak valid"})
+		return
+	}
+
+	fines, err := c.service.GetChildFines(principal.UserID, uint(childID), ctx.Query("status"))
+	if errors.Is(err, users.ErrNotGuardian) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": fines})
+}
+
+func (c *loanController) ApproveForChild(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	childID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID tidak valid"})
+		return
+	}
+
+	var input GuardianApprovalRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	approval, err := c.service.ApproveForChild(principal.UserID, uint(childID), &input)
+	if errors.Is(err, users.ErrNotGuardian) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, approval)
+}
+
+// borrowForbidden mengecek error pinjam yang berasal dari aturan patron (dijawab 403)
+func borrowForbidden(err error) bool {
+	return errors.Is(err, ErrEmailNotVerified) || errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAgeRestricted) || errors.Is(err, ErrGuardianApprovalRequired) ||
+		errors.Is(err, memberships.ErrMembershipExpired) || errors.Is(err, ErrLoanLimitReached)
+}
+
+func (c *loanController) DeskCheckout(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input DeskCheckoutRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	loans, err := c.service.DeskCheckout(principal.UserID, &input)
+	if borrowForbidden(err) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": loans})
+}
+
+func (c *loanController) DeskReturn(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input DeskReturnRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	loans, err := c.service.DeskReturn(principal.UserID, &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": loans})
+}
+
+func (c *loanController) MarkLost(ctx *gin.Context) {
+	c.markLoan(ctx, c.service.MarkLost)
+}
+
+func (c *loanController) MarkDamaged(ctx *gin.Context) {
+	c.markLoan(ctx, c.service.MarkDamaged)
+}
+
+func (c *loanController) MarkClaimedReturned(ctx *gin.Context) {
+	c.markLoan(ctx, c.service.MarkClaimedReturned)
+}
+
+func (c *loanController) markLoan(ctx *gin.Context, mark func(id string, staffID uint, input *MarkLoanRequest) (*Loan, error)) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input MarkLoanRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	loan, err := mark(ctx.Param("id"), principal.UserID, &input)
+	if errors.Is(err, ErrInvalidTransition) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loan)
+}
+
+func (c *loanController) GetHistory(ctx *gin.Context) {
+	history, err := c.service.GetHistory(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+func (c *loanController) GetMyFines(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	fines, err := c.service.GetFines(principal.UserID, ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": fines})
+}
+
+func (c *loanController) GetFines(ctx *gin.Context) {
+	userID, _ := strconv.ParseUint(ctx.Query("user_id"), 10, 64)
+
+	fines, err := c.service.GetFines(uint(userID), ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": fines})
+}
+
+func (c *loanController) SettleFine(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input SettleFineRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	fine, err := c.service.SettleFine(ctx.Param("id"), principal.UserID, &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, fine)
+}
+
+func (c *loanController) CheckIn(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input CheckInRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	loan, err := c.service.CheckIn(ctx.Param("id"), principal.UserID, &input)
+	if errors.Is(err, ErrInvalidTransition) || errors.Is(err, errConditionAssessed) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loan)
+}
+
+func (c *loanController) AddConditionPhoto(ctx *gin.Context) {
+	file, err := ctx.FormFile("photo")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Photo file is required: " + err.Error()})
+		return
+	}
+
+	condition, err := c.service.AddConditionPhoto(ctx.Param("id"), file)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, condition)
+}
+
+func (c *loanController) GetBookConditions(ctx *gin.Context) {
+	conditions, err := c.service.GetBookConditions(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": conditions})
+}
+
+func (c *loanController) GetDamageReport(ctx *gin.Context) {
+	rows, err := c.service.GetDamageReport(ctx.DefaultQuery("by", "patron"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+func (c *loanController) GetAvailability(ctx *gin.Context) {
+	availability, err := c.service.GetAvailability(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, availability)
+}
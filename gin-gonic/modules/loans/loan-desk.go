@@ -0,0 +1,140 @@
+package loans
+
+import (
+	"errors"
+
+	"gin-gonic/modules/books"
+	"gin-gonic/modules/users"
+
+	"gorm.io/gorm"
+)
+
+// resolvePatron mencari ID patron dari user_id atau nomor kartu anggota (salah satu wajib diisi)
+func resolvePatron(db *gorm.DB, userID uint, cardNumber string) (uint, error) {
+	if cardNumber != "" {
+		user, err := users.FindByCard(db.Select("id"), cardNumber)
+		if err != nil {
+			return 0, err
+		}
+		if userID != 0 && userID != user.ID {
+			return 0, errors.New("user_id dan card_number tidak cocok")
+		}
+		return user.ID, nil
+	}
+	if userID == 0 {
+		return 0, errors.New("user_id atau card_number wajib diisi")
+	}
+
+	var user users.User
+	if err := db.Select("id").First(&user, userID).Error; err != nil {
+		return 0, errors.New("user not found")
+	}
+	return user.ID, nil
+}
+
+// resolveBooks menggabungkan book_ids dan barcodes menjadi daftar ID buku sesuai urutan request
+func resolveBooks(db *gorm.DB, bookIDs []uint, barcodes []string) ([]uint, error) {
+	ids := append([]uint{}, bookIDs...)
+	for _, barcode := range barcodes {
+		book, err := books.Lookup(db, 0, barcode)
+		if err != nil {
+			return nil, errors.New("barcode " + barcode + " tidak ditemukan")
+		}
+		ids = append(ids, book.ID)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("book_ids atau barcodes wajib diisi")
+	}
+	return ids, nil
+}
+
+// DeskCheckout meminjamkan beberapa buku sekaligus untuk patron di meja pustakawan.
+// Semua aturan pinjam patron tetap berlaku, staffID dicatat di setiap pinjaman.
+func (s *loanService) DeskCheckout(staffID uint, input *DeskCheckoutRequest) ([]Loan, error) {
+	userID, err := resolvePatron(s.db, input.UserID, input.CardNumber)
+	if err != nil {
+		return nil, err
+	}
+	bookIDs, err := resolveBooks(s.db, input.BookIDs, input.Barcodes)
+	if err != nil {
+		return nil, err
+	}
+	return s.borrowBooks(userID, bookIDs, loanOrigin{ActorID: staffID, StaffID: &staffID})
+}
+
+// DeskReturn mengembalikan beberapa pinjaman sekaligus di meja pustakawan.
+// Buku yang di-scan dicocokkan dengan pinjaman aktif patron yang paling lama.
+func (s *loanService) DeskReturn(staffID uint, input *DeskReturnRequest) ([]Loan, error) {
+	var selected []Loan
+	if len(input.LoanIDs) > 0 {
+		if err := s.db.Where("id IN ?", input.LoanIDs).Find(&selected).Error; err != nil {
+			return nil, err
+		}
+		if len(selected) != len(uniqueIDs(input.LoanIDs)) {
+			return nil, errors.New("loan not found")
+		}
+	}
+
+	if len(input.BookIDs) > 0 || len(input.Barcodes) > 0 {
+		userID, err := resolvePatron(s.db, input.UserID, input.CardNumber)
+		if err != nil {
+			return nil, err
+		}
+		bookIDs, err := resolveBooks(s.db, input.BookIDs, input.Barcodes)
+		if err != nil {
+			return nil, err
+		}
+
+		var open []Loan
+		if err := s.db.Where("user_id = ? AND status IN ?", userID, returnableStatuses).Order("loan_date").Find(&open).Error; err != nil {
+			return nil, err
+		}
+		taken := make(map[uint]bool, len(selected))
+		for _, loan := range selected {
+			taken[loan.ID] = true
+		}
+		for _, bookID := range bookIDs {
+			found := false
+			for _, loan := range open {
+				if loan.BookID == bookID && !taken[loan.ID] {
+					taken[loan.ID] = true
+					selected = append(selected, loan)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.New("tidak ada pinjaman aktif patron untuk buku yang di-scan")
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, errors.New("loan_ids atau buku yang dikembalikan wajib diisi")
+	}
+	if err := s.returnLoans(selected, loanOrigin{ActorID: staffID, StaffID: &staffID}); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(selected))
+	for i, loan := range selected {
+		ids[i] = loan.ID
+	}
+	var fullLoans []Loan
+	if err := s.db.Preload("User").Preload("Book").Where("id IN ?", ids).Order("id").Find(&fullLoans).Error; err != nil {
+		return nil, err
+	}
+	return fullLoans, nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package loans
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/modules/users"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// OverdueCheckInterval adalah jeda pengecekan peminjaman yang terlambat
+	OverdueCheckInterval = time.Hour
+	// overdueBatchSize membatasi jumlah pemberitahuan per pengecekan
+	overdueBatchSize = 100
+)
+
+// StartOverdueNotifier menjalankan MarkOverdue dan SendOverdueNotices secara berkala di background
+func StartOverdueNotifier(db *gorm.DB, mailer helper.Mailer) {
+	go func() {
+		ticker := time.NewTicker(OverdueCheckInterval)
+		defer ticker.Stop()
+		for {
+			if marked, err := MarkOverdue(db, time.Now()); err != nil {
+				log.Printf("Failed to mark overdue loans: %v", err)
+			} else if marked > 0 {
+				log.Printf("Marked %d loans as overdue", marked)
+			}
+			sent, err := SendOverdueNotices(db, mailer, time.Now())
+			if err != nil {
+				log.Printf("Failed to send overdue notices: %v", err)
+			} else if sent > 0 {
+				log.Printf("Sent %d overdue notices", sent)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// SendOverdueNotices mengirim pemberitahuan keterlambatan satu kali per loan ke peminjam,
+// dan ke wali aktifnya jika peminjam masih anak. Setiap loan diklaim sebelum dikirim dan
+// dicoba lagi jika email ke peminjam gagal (lihat helper.MailClaimLease); email ke wali
+// dikirim setelahnya tanpa diulang. Mengembalikan jumlah loan yang diberitahukan.
+func SendOverdueNotices(db *gorm.DB, mailer helper.Mailer, now time.Time) (int, error) {
+	var overdue []Loan
+	if err := db.Preload("Book").
+		Where("status = ? AND return_date < ? AND overdue_notified_at IS NULL", LoanOverdue, now).
+		Where("overdue_notice_attempts < ? AND (overdue_notice_next_at IS NULL OR overdue_notice_next_at <= ?)",
+			helper.MailMaxAttempts, now).
+		Order("id").Limit(overdueBatchSize).Find(&overdue).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, loan := range overdue {
+		claimed, err := claimNotice(db, &loan, now)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			// Sudah diklaim instance lain
+			continue
+		}
+
+		var borrower users.User
+		err = db.Select("id", "name", "email").First(&borrower, loan.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := markNotified(db, loan.ID, now); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		days := int(now.Sub(loan.ReturnDate).Hours()/24) + 1
+		if err := mailer.Send(helper.Mail{
+			To:      borrower.Email,
+			Subject: "Peminjaman buku terlambat",
+			Body: fmt.Sprintf("Halo %s,\n\nBuku \"%s\" seharusnya dikembalikan pada %s (terlambat %d hari). "+
+				"Mohon segera kembalikan buku ke perpustakaan.\n",
+				borrower.Name, loan.Book.Title, loan.ReturnDate.In(users.LibraryLocation).Format("2006-01-02"), days),
+		}); err != nil {
+			log.Printf("Failed to send overdue notice for loan %d (attempt %d): %v", loan.ID, loan.OverdueNoticeAttempts, err)
+			if err := retryNotice(db, &loan, now); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := markNotified(db, loan.ID, now); err != nil {
+			return sent, err
+		}
+
+		guardians, err := users.GuardianContacts(db, loan.UserID)
+		if err != nil {
+			return sent, err
+		}
+		for _, guardian := range guardians {
+			if err := mailer.Send(helper.Mail{
+				To:      guardian.Email,
+				Subject: "Peminjaman buku anak Anda terlambat",
+				Body: fmt.Sprintf("Halo %s,\n\n%s belum mengembalikan buku \"%s\" yang seharusnya dikembalikan pada %s "+
+					"(terlambat %d hari).\n",
+					guardian.Name, borrower.Name, loan.Book.Title,
+					loan.ReturnDate.In(users.LibraryLocation).Format("2006-01-02"), days),
+			}); err != nil {
+				log.Printf("Failed to send overdue notice for loan %d to guardian %d: %v", loan.ID, guardian.ID, err)
+			}
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// claimNotice menaikkan jumlah percobaan jika belum berubah sejak dibaca, sehingga hanya
+// satu instance yang mengirim pemberitahuan. Klaim berlaku sampai helper.MailClaimLease.
+func claimNotice(db *gorm.DB, loan *Loan, now time.Time) (bool, error) {
+	result := db.Model(&Loan{}).
+		Where("id = ? AND overdue_notified_at IS NULL AND overdue_notice_attempts = ?", loan.ID, loan.OverdueNoticeAttempts).
+		Updates(map[string]interface{}{
+			"overdue_notice_attempts": gorm.Expr("overdue_notice_attempts + 1"),
+			"overdue_notice_next_at":  now.Add(helper.MailClaimLease),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	loan.OverdueNoticeAttempts++
+	return result.RowsAffected == 1, nil
+}
+
+// retryNotice melepas klaim setelah gagal kirim dan menjadwalkan percobaan berikutnya
+func retryNotice(db *gorm.DB, loan *Loan, now time.Time) error {
+	if loan.OverdueNoticeAttempts >= helper.MailMaxAttempts {
+		log.Printf("Giving up overdue notice for loan %d after %d attempts", loan.ID, loan.OverdueNoticeAttempts)
+	}
+	return db.Model(&Loan{}).
+		Where("id = ? AND overdue_notified_at IS NULL AND overdue_notice_attempts = ?", loan.ID, loan.OverdueNoticeAttempts).
+		Update("overdue_notice_next_at", now.Add(helper.MailRetryDelay(loan.OverdueNoticeAttempts))).Error
+}
+
+// markNotified mencatat pemberitahuan keterlambatan sudah terkirim
+func markNotified(db *gorm.DB, loanID uint, now time.Time) error {
+	return db.Model(&Loan{}).Where("id = ? AND overdue_notified_at IS NULL", loanID).
+		Updates(map[string]interface{}{"overdue_notified_at": now, "overdue_notice_next_at": nil}).Error
+}
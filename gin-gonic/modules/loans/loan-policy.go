@@ -0,0 +1,25 @@
+package loans
+
+import (
+	"errors"
+
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LoanOwner adalah OwnerResolver yang mengembalikan peminjam dari loan di path param
+func LoanOwner(db *gorm.DB, param string) middlewares.OwnerResolver {
+	return func(c *gin.Context) (uint, error) {
+		var loan Loan
+		err := db.Select("id", "user_id").Where("id = ?", c.Param(param)).First(&loan).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, middlewares.ErrResourceNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		return loan.UserID, nil
+	}
+}
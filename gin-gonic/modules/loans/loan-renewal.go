@@ -0,0 +1,70 @@
+package loans
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-gonic/modules/memberships"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRenewalLimitReached dikembalikan jika pinjaman sudah diperpanjang sebanyak MaxRenewals plan
+	ErrRenewalLimitReached = errors.New("pinjaman sudah mencapai batas perpanjangan keanggotaan")
+
+	errRenewalNotAllowed = errors.New("hanya pinjaman yang belum jatuh tempo yang dapat diperpanjang")
+)
+
+// Renew memperpanjang pinjaman sebanyak LoanDays plan keanggotaan, dihitung dari tanggal harus kembali.
+// Pinjaman yang sudah terlambat tidak bisa diperpanjang agar denda keterlambatan tidak terhindari.
+func (s *loanService) Renew(id string, actorID uint) (*Loan, error) {
+	var loan Loan
+	if err := s.db.First(&loan, id).Error; err != nil {
+		return nil, errors.New("loan not found")
+	}
+	now := time.Now()
+	if loan.Status != LoanBorrowed || !now.Before(loan.ReturnDate) {
+		return nil, errRenewalNotAllowed
+	}
+
+	membership, err := memberships.Current(s.db, loan.UserID, now)
+	if err != nil {
+		return nil, err
+	}
+	if membership.Expired(now) {
+		return nil, memberships.ErrMembershipExpired
+	}
+	if loan.Renewals >= membership.Plan.MaxRenewals {
+		return nil, fmt.Errorf("%w (maksimal %d kali)", ErrRenewalLimitReached, membership.Plan.MaxRenewals)
+	}
+
+	dueDate := loan.ReturnDate.AddDate(0, 0, membership.Plan.LoanDays)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Kondisi renewals dan status mencegah perpanjangan ganda dari request bersamaan
+		result := tx.Model(&Loan{}).Where("id = ? AND status = ? AND renewals = ?", loan.ID, LoanBorrowed, loan.Renewals).
+			Updates(map[string]interface{}{"return_date": dueDate, "renewals": loan.Renewals + 1})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRenewalNotAllowed
+		}
+		origin := loanOrigin{ActorID: actorID}
+		if actorID != loan.UserID {
+			origin.StaffID = &actorID
+		}
+		return recordStatus(tx, loan.ID, LoanBorrowed, LoanBorrowed, origin,
+			fmt.Sprintf("diperpanjang sampai %s", dueDate.Format("2006-01-02")))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var fullLoan Loan
+	if err := s.db.Preload("Book").First(&fullLoan, loan.ID).Error; err != nil {
+		return nil, err
+	}
+	return &fullLoan, nil
+}
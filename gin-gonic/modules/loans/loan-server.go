@@ -5,6 +5,8 @@ import (
 
 	"gin-gonic/helper"
 	"gin-gonic/middlewares"
+	"gin-gonic/modules/books"
+	"gin-gonic/modules/roles"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nats-io/nats.go"
@@ -29,25 +31,71 @@ func (s *LoanServer) Init() {
 	}
 
 	if config.AUTO_MIGRATE == "Y" {
-		if err := s.db.AutoMigrate(&Loan{}); err != nil {
+		if err := s.db.AutoMigrate(&Loan{}, &AgeOverride{}, &GuardianApproval{}, &LoanStatusChange{}, &LoanFine{}, &LoanCondition{}); err != nil {
 			log.Printf("Failed to auto migrate Loan: %v", err)
 		}
 	}
 
+	// GetList2 di modul books memakai perkiraan ini untuk available_from
+	books.AvailabilityEstimator = AvailableFrom
+
 	service := NewLoanService(s.db, s.nc)
 	controller := NewLoanController(service)
 
+	mailer, err := helper.NewMailer(config)
+	if err != nil {
+		log.Fatal("Cannot create mailer:", err)
+	}
+	// Pemberitahuan keterlambatan ke peminjam dan walinya
+	StartOverdueNotifier(s.db, mailer)
+
+	router := middlewares.NewRouter(s.router)
+	authenticated := middlewares.Authenticated()
+	// Token sesi kiosk hanya bisa melihat pinjaman dan denda sendiri di sini;
+	// pinjam dan kembali di kiosk wajib lewat /kiosk/* yang memeriksa perangkat dan mencatat aktivitasnya
+	kiosk := authenticated.AllowScope(middlewares.ScopeKiosk)
+
 	// Protected loan routes
-	loanRoutes := s.router.Group("/" + s.version + "/loans")
-	loanRoutes.Use(middlewares.JWTMiddleware())
-	loanRoutes.POST("/", controller.Borrow)
-	loanRoutes.GET("/my", controller.GetMy)
-	loanRoutes.POST("/return/:id", controller.Return)
-	loanRoutes.GET("/fav", controller.GetPopularBooks)
+	loanRoutes := router.Group("/" + s.version + "/loans")
+	loanRoutes.POST("/", authenticated, controller.Borrow)
+	loanRoutes.GET("/my", kiosk, controller.GetMy)
+	loanRoutes.POST("/return/:id", middlewares.OwnerOrPermission(LoanOwner(s.db, "id"), roles.PermLoansCheckout), controller.Return)
+	loanRoutes.POST("/renew/:id", middlewares.OwnerOrPermission(LoanOwner(s.db, "id"), roles.PermLoansCheckout), controller.Renew)
+	loanRoutes.GET("/fav", authenticated, controller.GetPopularBooks)
+	loanRoutes.GET("/fines", kiosk, controller.GetMyFines)
+
+	// Ketersediaan buku dan perkiraan kapan tersedia lagi
+	bookRoutes := router.Group("/" + s.version + "/books")
+	bookRoutes.GET("/:id/availability", middlewares.Public(), controller.GetAvailability)
+
+	// Wali melihat dan menyetujui peminjaman akun anak
+	children := router.Group("/" + s.version + "/users/me/children")
+	children.GET("/:id/loans", authenticated, controller.GetChildLoans)
+	children.GET("/:id/fines", authenticated, controller.GetChildFines)
+	children.POST("/:id/approvals", authenticated.WithoutImpersonation(), controller.ApproveForChild)
 
 	// Admin loan stats
-	adminRoutes := s.router.Group("/" + s.version + "/admin")
-	adminRoutes.Use(middlewares.JWTMiddleware(), middlewares.AdminMiddleware())
-	adminRoutes.GET("/books/stats", controller.GetStats)
-	adminRoutes.GET("/loans", controller.GetAll)
+	adminRoutes := router.Group("/" + s.version + "/admin")
+	adminRoutes.GET("/books/stats", middlewares.RequirePermission(roles.PermStatsRead), controller.GetStats)
+	adminRoutes.GET("/loans", middlewares.RequirePermission(roles.PermLoansRead), controller.GetAll)
+	adminRoutes.POST("/loans/age-overrides", middlewares.RequirePermission(roles.PermLoansOverride), controller.GrantAgeOverride)
+
+	// Meja pustakawan: pinjam dan kembali atas nama patron, staf dicatat di setiap pinjaman
+	canCheckout := middlewares.RequirePermission(roles.PermLoansCheckout)
+	adminRoutes.POST("/desk/checkout", canCheckout, controller.DeskCheckout)
+	adminRoutes.POST("/desk/return", canCheckout, controller.DeskReturn)
+
+	// Status pinjaman (hilang, rusak, diklaim dikembalikan) dan denda
+	adminRoutes.POST("/loans/:id/lost", canCheckout, controller.MarkLost)
+	adminRoutes.POST("/loans/:id/damaged", canCheckout, controller.MarkDamaged)
+	adminRoutes.POST("/loans/:id/claimed-returned", canCheckout, controller.MarkClaimedReturned)
+	adminRoutes.GET("/loans/:id/history", middlewares.RequirePermission(roles.PermLoansRead), controller.GetHistory)
+	adminRoutes.GET("/fines", middlewares.RequirePermission(roles.PermLoansRead), controller.GetFines)
+	adminRoutes.POST("/fines/:id/settle", canCheckout, controller.SettleFine)
+
+	// Penilaian kondisi buku saat check-in dan laporan kerusakan
+	adminRoutes.POST("/loans/:id/checkin", canCheckout, controller.CheckIn)
+	adminRoutes.POST("/loans/:id/condition/photos", canCheckout, controller.AddConditionPhoto)
+	adminRoutes.GET("/books/:id/conditions", middlewares.RequirePermission(roles.PermLoansRead), controller.GetBookConditions)
+	adminRoutes.GET("/reports/damage", middlewares.RequirePermission(roles.PermLoansRead), controller.GetDamageReport)
 }
@@ -4,16 +4,35 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime/multipart"
 
 	// "log"
 	"time"
 
 	"gin-gonic/modules/books"
+	"gin-gonic/modules/memberships"
+	"gin-gonic/modules/users"
 
 	"github.com/nats-io/nats.go"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrEmailNotVerified dikembalikan Borrow jika email user belum diverifikasi
+var ErrEmailNotVerified = errors.New("email belum diverifikasi, silakan cek email Anda")
+
+// ErrAccountSuspended dikembalikan Borrow jika akun user sedang ditangguhkan
+var ErrAccountSuspended = errors.New("akun sedang ditangguhkan, tidak dapat meminjam buku")
+
+// ErrAgeRestricted dikembalikan Borrow jika umur user di bawah batas umur buku dan tidak ada izin admin
+var ErrAgeRestricted = errors.New("buku ini dibatasi umur peminjam")
+
+// ErrLoanLimitReached dikembalikan Borrow jika jumlah buku yang dipinjam sudah mencapai batas plan
+var ErrLoanLimitReached = errors.New("jumlah pinjaman sudah mencapai batas keanggotaan")
+
+// ErrGuardianApprovalRequired dikembalikan Borrow jika kategori buku wajib disetujui wali anak
+var ErrGuardianApprovalRequired = errors.New("peminjaman buku kategori ini membutuhkan persetujuan wali")
+
 type LoanStats struct {
 	TotalTransactions int64 `json:"total_transactions"`
 	CurrentlyBorrowed int64 `json:"currently_borrowed"`
@@ -24,9 +43,29 @@ type LoanService interface {
 	GetStats() (*LoanStats, error)
 	GetPopularBooks() ([]books.Book, error)
 	Borrow(userID uint, input *LoanRequest) (*Loan, error)
-	Return(id string) error
+	Return(id string, actorID uint, staff bool) error
+	KioskBorrow(kioskID, userID uint, input *LoanRequest) (*Loan, error)
+	KioskReturn(kioskID, userID, bookID uint) (*Loan, error)
+	DeskCheckout(staffID uint, input *DeskCheckoutRequest) ([]Loan, error)
+	DeskReturn(staffID uint, input *DeskReturnRequest) ([]Loan, error)
+	MarkLost(id string, staffID uint, input *MarkLoanRequest) (*Loan, error)
+	MarkDamaged(id string, staffID uint, input *MarkLoanRequest) (*Loan, error)
+	MarkClaimedReturned(id string, staffID uint, input *MarkLoanRequest) (*Loan, error)
+	GetHistory(id string) ([]LoanStatusChange, error)
+	GetFines(userID uint, status string) ([]LoanFine, error)
+	SettleFine(id string, staffID uint, input *SettleFineRequest) (*LoanFine, error)
+	CheckIn(id string, staffID uint, input *CheckInRequest) (*Loan, error)
+	AddConditionPhoto(id string, file *multipart.FileHeader) (*LoanCondition, error)
+	GetBookConditions(bookID string) ([]LoanCondition, error)
+	GetDamageReport(by string) ([]DamageReportRow, error)
+	GetAvailability(bookID string) (*BookAvailability, error)
 	GetMy(userID uint) ([]Loan, error)
 	GetAll() ([]Loan, error)
+	GrantAgeOverride(input *AgeOverrideRequest, meta users.AuditMeta) (*AgeOverride, error)
+	GetChildLoans(guardianID, childID uint) ([]Loan, error)
+	GetChildFines(guardianID, childID uint, status string) ([]LoanFine, error)
+	Renew(id string, actorID uint) (*Loan, error)
+	ApproveForChild(guardianID, childID uint, input *GuardianApprovalRequest) (*GuardianApproval, error)
 }
 
 type loanService struct {
@@ -48,10 +87,10 @@ func (s *loanService) GetStats() (*LoanStats, error) {
 	if err := s.db.Model(&Loan{}).Count(&totalLoans).Error; err != nil {
 		return nil, err
 	}
-	if err := s.db.Model(&Loan{}).Where("status = ?", "borrowed").Count(&activeLoans).Error; err != nil {
+	if err := s.db.Model(&Loan{}).Where("status IN ?", openStatuses).Count(&activeLoans).Error; err != nil {
 		return nil, err
 	}
-	if err := s.db.Model(&Loan{}).Where("status = ?", "returned").Count(&returnedLoans).Error; err != nil {
+	if err := s.db.Model(&Loan{}).Where("status = ?", LoanReturned).Count(&returnedLoans).Error; err != nil {
 		return nil, err
 	}
 
@@ -95,39 +134,197 @@ func (s *loanService) GetPopularBooks() ([]books.Book, error) {
 
 
 func (s *loanService) Borrow(userID uint, input *LoanRequest) (*Loan, error) {
-	var book books.Book
-	if err := s.db.First(&book, input.BookID).Error; err != nil {
-		return nil, errors.New("book not found")
+	return s.borrow(userID, input, loanOrigin{ActorID: userID})
+}
+
+// KioskBorrow meminjam buku untuk patron yang login di perangkat kiosk
+func (s *loanService) KioskBorrow(kioskID, userID uint, input *LoanRequest) (*Loan, error) {
+	return s.borrow(userID, input, loanOrigin{ActorID: userID, KioskID: &kioskID})
+}
+
+func (s *loanService) borrow(userID uint, input *LoanRequest, origin loanOrigin) (*Loan, error) {
+	loans, err := s.borrowBooks(userID, []uint{input.BookID}, origin)
+	if err != nil {
+		return nil, err
 	}
-	if book.Stock <= 0 {
-		return nil, errors.New("stok habis")
+	return &loans[0], nil
+}
+
+// borrowBooks meminjam beberapa buku untuk satu user dalam satu transaksi.
+// Jika salah satu buku gagal (stok habis, batas umur, dll) tidak ada buku yang dipinjam.
+func (s *loanService) borrowBooks(userID uint, bookIDs []uint, origin loanOrigin) ([]Loan, error) {
+	var user users.User
+	if err := s.db.Select("id", "verified_at", "suspended_at", "born_date").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
+	if user.VerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Batas jumlah pinjaman dan lama pinjam mengikuti plan keanggotaan user
+	now := time.Now()
+	membership, err := memberships.Current(s.db, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	if membership.Expired(now) {
+		return nil, memberships.ErrMembershipExpired
 	}
 
 	tx := s.db.Begin()
 
-	if err := tx.Model(&books.Book{}).Where("id = ?", input.BookID).
-		Update("stock", gorm.Expr("stock - ?", 1)).Error; err != nil {
+	// Kunci baris user agar request pinjam bersamaan tidak melewati batas plan
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&users.User{}, userID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var open int64
+	if err := tx.Model(&Loan{}).Where("user_id = ? AND status IN ?", userID, openStatuses).Count(&open).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	if open+int64(len(bookIDs)) > int64(membership.Plan.MaxLoans) {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w (maksimal %d buku)", ErrLoanLimitReached, membership.Plan.MaxLoans)
+	}
+
+	created := make([]Loan, 0, len(bookIDs))
+	for _, bookID := range bookIDs {
+		loan, err := borrowTx(tx, &user, bookID, membership, origin, now)
+		if err != nil {
+			tx.Rollback()
+			if len(bookIDs) > 1 {
+				err = fmt.Errorf("buku %d: %w", bookID, err)
+			}
+			return nil, err
+		}
+		created = append(created, *loan)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	for _, loan := range created {
+		s.publishBorrowed(&loan)
+	}
+
+	// goroutine agar tidak memblokir response API
+	go s.broadcastStats()
+
+	ids := make([]uint, len(created))
+	for i, loan := range created {
+		ids[i] = loan.ID
+	}
+	var fullLoans []Loan
+	if err := s.db.Preload("User").Preload("Book").Where("id IN ?", ids).Order("id").Find(&fullLoans).Error; err != nil {
+		return nil, err
+	}
+
+	return fullLoans, nil
+}
+
+// borrowTx membuat satu pinjaman di dalam transaksi borrowBooks: cek stok, batas umur dan persetujuan wali
+func borrowTx(tx *gorm.DB, user *users.User, bookID uint, membership *memberships.Membership, origin loanOrigin, now time.Time) (*Loan, error) {
+	var book books.Book
+	if err := tx.First(&book, bookID).Error; err != nil {
+		return nil, errors.New("book not found")
+	}
+
+	// Umur dihitung menurut tanggal di zona waktu perpustakaan. User yang belum cukup umur
+	// (atau tanggal lahirnya tidak diketahui) membutuhkan izin admin yang belum dipakai.
+	var override *AgeOverride
+	if book.MinAge > 0 {
+		if age, known := user.AgeAt(now); !known || age < book.MinAge {
+			var grant AgeOverride
+			err := tx.Where("user_id = ? AND book_id = ? AND used_at IS NULL", user.ID, book.ID).
+				Order("id").First(&grant).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w (minimal %d tahun)", ErrAgeRestricted, book.MinAge)
+			}
+			if err != nil {
+				return nil, err
+			}
+			override = &grant
+		}
+	}
+
+	// Akun anak membutuhkan persetujuan wali untuk kategori yang dipilih walinya
+	var approval *GuardianApproval
+	if book.Category != "" {
+		required, err := guardianApprovalRequired(tx, user.ID, book.Category)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			var grant GuardianApproval
+			err := tx.Where("child_id = ? AND book_id = ? AND used_at IS NULL", user.ID, book.ID).
+				Order("id").First(&grant).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrGuardianApprovalRequired
+			}
+			if err != nil {
+				return nil, err
+			}
+			approval = &grant
+		}
+	}
+
+	// Kondisi stock > 0 mencegah stok minus saat beberapa request meminjam buku terakhir
+	result := tx.Model(&books.Book{}).Where("id = ? AND stock > 0", book.ID).
+		Update("stock", gorm.Expr("stock - ?", 1))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("stok habis")
+	}
 
 	loan := Loan{
-		UserID:     userID,
-		BookID:     input.BookID,
-		LoanDate:   time.Now(),
-		ReturnDate: time.Now().AddDate(0, 0, 7),
-		Status:     "borrowed",
+		UserID:          user.ID,
+		BookID:          book.ID,
+		LoanDate:        now,
+		ReturnDate:      now.AddDate(0, 0, membership.Plan.LoanDays),
+		Status:          LoanBorrowed,
+		CheckoutKioskID: origin.KioskID,
+		CheckoutStaffID: origin.StaffID,
+		LateFeePerDay:   membership.Plan.LateFeePerDay,
 	}
 
 	if err := tx.Create(&loan).Error; err != nil {
-		tx.Rollback()
 		return nil, err
 	}
-
-	if err := tx.Commit().Error; err != nil {
+	if err := recordStatus(tx, loan.ID, "", LoanBorrowed, origin, ""); err != nil {
 		return nil, err
 	}
 
+	if override != nil {
+		claimed, err := claimGrant(tx, &AgeOverride{}, override.ID, loan.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			return nil, fmt.Errorf("%w (minimal %d tahun)", ErrAgeRestricted, book.MinAge)
+		}
+	}
+	if approval != nil {
+		claimed, err := claimGrant(tx, &GuardianApproval{}, approval.ID, loan.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			return nil, ErrGuardianApprovalRequired
+		}
+	}
+
+	return &loan, nil
+}
+
+// publishBorrowed mengirim notifikasi peminjaman ke NATS
+func (s *loanService) publishBorrowed(loan *Loan) {
 	// 1. Buat Payload Data untuk Frontend
 	// Structure ini nanti akan diterima oleh WebSocket di browser
 	// notificationData := map[string]interface{}{
@@ -142,8 +339,8 @@ func (s *loanService) Borrow(userID uint, input *LoanRequest) (*Loan, error) {
 	// }
 	// data flat lebih sederhana tanpa perlu parsing
 	natsPayload := map[string]interface{}{
-		"book_id": input.BookID,
-		"user_id": userID,
+		"book_id": loan.BookID,
+		"user_id": loan.UserID,
 		"action":  "borrow",
 		"loan_id": loan.ID,
 		"time":    time.Now(),
@@ -165,42 +362,97 @@ func (s *loanService) Borrow(userID uint, input *LoanRequest) (*Loan, error) {
 	} else {
 		fmt.Println("❌ Error: Koneksi NATS belum siap (nil)")
 	}
+}
 
-	// goroutine agar tidak memblokir response API
-	go s.broadcastStats()
+// Return mengembalikan pinjaman. actorID selain peminjam dicatat sebagai staf yang memproses.
+// staff false (peminjam sendiri) hanya bisa mengembalikan pinjaman berstatus borrowed/overdue.
+func (s *loanService) Return(id string, actorID uint, staff bool) error {
+	var loan Loan
+	if err := s.db.First(&loan, id).Error; err != nil {
+		return errors.New("loan not found")
+	}
+	if !staff && loan.Status != LoanReturned && !patronCanReturn(loan.Status) {
+		return errStaffReturnRequired
+	}
+	origin := loanOrigin{ActorID: actorID}
+	if actorID != 0 && actorID != loan.UserID {
+		origin.StaffID = &actorID
+	}
+	return s.returnLoans([]Loan{loan}, origin)
+}
 
-	var fullLoan Loan
-	if err := s.db.Preload("User").Preload("Book").First(&fullLoan, loan.ID).Error; err != nil {
+// KioskReturn mengembalikan pinjaman patron untuk buku yang di-scan di perangkat kiosk.
+// Jika patron meminjam beberapa eksemplar, pinjaman terlama yang dikembalikan.
+func (s *loanService) KioskReturn(kioskID, userID, bookID uint) (*Loan, error) {
+	var loan Loan
+	if err := s.db.Where("user_id = ? AND book_id = ? AND status IN ?", userID, bookID, patronReturnableStatuses).
+		Order("loan_date").First(&loan).Error; err != nil {
+		return nil, errors.New("tidak ada pinjaman aktif untuk buku ini")
+	}
+	if err := s.returnLoans([]Loan{loan}, loanOrigin{ActorID: userID, KioskID: &kioskID}); err != nil {
 		return nil, err
 	}
 
+	var fullLoan Loan
+	if err := s.db.Preload("Book").First(&fullLoan, loan.ID).Error; err != nil {
+		return nil, err
+	}
 	return &fullLoan, nil
 }
-func (s *loanService) Return(id string) error {
-	var loan Loan
-	if err := s.db.First(&loan, id).Error; err != nil {
-		return errors.New("loan not found")
+
+// returnLoans mengembalikan beberapa pinjaman dalam satu transaksi: semua berhasil atau tidak sama sekali
+func (s *loanService) returnLoans(loans []Loan, origin loanOrigin) error {
+	tx := s.db.Begin()
+	for _, loan := range loans {
+		if err := returnTx(tx, &loan, origin); err != nil {
+			tx.Rollback()
+			if len(loans) > 1 {
+				err = fmt.Errorf("pinjaman %d: %w", loan.ID, err)
+			}
+			return err
+		}
 	}
-	if loan.Status == "returned" {
-		return errors.New("book already returned")
+	if err := tx.Commit().Error; err != nil {
+		return err
 	}
 
-	tx := s.db.Begin()
+	for _, loan := range loans {
+		s.publishReturned(&loan)
+	}
+	go s.broadcastStats()
 
-	if err := tx.Model(&Loan{}).Where("id = ?", loan.ID).
-		Updates(map[string]interface{}{"status": "returned", "return_date": time.Now()}).Error; err != nil {
-		tx.Rollback()
-		return err
+	return nil
+}
+
+func returnTx(tx *gorm.DB, loan *Loan, origin loanOrigin) error {
+	if loan.Status == LoanReturned {
+		return errors.New("book already returned")
 	}
 
-	if err := tx.Model(&books.Book{}).Where("id = ?", loan.BookID).
-		Update("stock", gorm.Expr("stock + ?", 1)).Error; err != nil {
-		tx.Rollback()
+	from := loan.Status
+	if err := transitionTx(tx, loan, LoanReturned, origin, "", returnUpdates(origin)); err != nil {
 		return err
 	}
-	if err := tx.Commit().Error; err != nil {
+	if err := lateFeeTx(tx, loan, from, origin); err != nil {
 		return err
 	}
+	if from == LoanLost {
+		return waiveReplacementFines(tx, loan.ID, origin)
+	}
+	return nil
+}
+
+// returnUpdates adalah kolom yang diisi saat buku kembali ke perpustakaan
+func returnUpdates(origin loanOrigin) map[string]interface{} {
+	return map[string]interface{}{
+		"returned_at":     time.Now(),
+		"return_kiosk_id": origin.KioskID,
+		"return_staff_id": origin.StaffID,
+	}
+}
+
+// publishReturned mengirim notifikasi pengembalian ke NATS
+func (s *loanService) publishReturned(loan *Loan) {
 	// nats implementation for returning notification
 	// eventData := map[string]interface{}{
 	// 	"type":    "BOOK_RETURNED",
@@ -235,9 +487,6 @@ func (s *loanService) Return(id string) error {
 	} else {
 		fmt.Println("❌ Error: Koneksi NATS belum siap (nil)")
 	}
-	go s.broadcastStats()
-
-	return nil
 }
 
 func (s *loanService) GetMy(userID uint) ([]Loan, error) {
@@ -255,3 +504,121 @@ func (s *loanService) GetAll() ([]Loan, error) {
 	}
 	return loansData, nil
 }
+
+// HasOpenLoans mengecek apakah user masih memiliki buku yang belum dikembalikan
+func HasOpenLoans(db *gorm.DB, userID uint) (bool, error) {
+	var open int64
+	if err := db.Model(&Loan{}).Where("user_id = ? AND status IN ?", userID, openStatuses).Count(&open).Error; err != nil {
+		return false, err
+	}
+	return open > 0, nil
+}
+
+// GrantAgeOverride mengizinkan user meminjam satu kali buku yang dibatasi umur.
+// Izin dan audit log dibuat dalam satu transaksi.
+func (s *loanService) GrantAgeOverride(input *AgeOverrideRequest, meta users.AuditMeta) (*AgeOverride, error) {
+	var book books.Book
+	if err := s.db.First(&book, input.BookID).Error; err != nil {
+		return nil, errors.New("book not found")
+	}
+	if book.MinAge == 0 {
+		return nil, errors.New("buku tidak memiliki batas umur")
+	}
+
+	var user users.User
+	if err := s.db.Select("id").First(&user, input.UserID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	override := AgeOverride{
+		UserID:    user.ID,
+		BookID:    book.ID,
+		GrantedBy: meta.ActorID,
+		Reason:    input.Reason,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&override).Error; err != nil {
+			return err
+		}
+		return tx.Create(&users.UserAuditLog{
+			ActorID:   meta.ActorID,
+			UserID:    user.ID,
+			Action:    users.AuditAgeOverride,
+			Reason:    input.Reason,
+			Detail:    fmt.Sprintf("book_id=%d min_age=%d", book.ID, book.MinAge),
+			IP:        meta.IP,
+			UserAgent: meta.UserAgent,
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// claimGrant menandai izin sekali pakai (AgeOverride atau GuardianApproval) sebagai terpakai oleh loan.
+// Kondisi used_at IS NULL mencegah satu izin dipakai dua kali oleh request bersamaan.
+func claimGrant(tx *gorm.DB, model interface{}, id, loanID uint) (bool, error) {
+	result := tx.Model(model).Where("id = ? AND used_at IS NULL", id).
+		Updates(map[string]interface{}{"loan_id": loanID, "used_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// guardianApprovalRequired mengecek apakah salah satu wali aktif user mewajibkan persetujuan untuk kategori buku
+func guardianApprovalRequired(db *gorm.DB, userID uint, category string) (bool, error) {
+	links, err := users.ActiveGuardians(db, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, link := range links {
+		if link.RequiresApproval(category) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetChildLoans mengembalikan peminjaman akun anak untuk walinya
+func (s *loanService) GetChildLoans(guardianID, childID uint) ([]Loan, error) {
+	if _, err := users.GuardianOf(s.db, guardianID, childID); err != nil {
+		return nil, err
+	}
+	return s.GetMy(childID)
+}
+
+// GetChildFines mengembalikan denda akun anak untuk walinya
+func (s *loanService) GetChildFines(guardianID, childID uint, status string) ([]LoanFine, error) {
+	if _, err := users.GuardianOf(s.db, guardianID, childID); err != nil {
+		return nil, err
+	}
+	return s.GetFines(childID, status)
+}
+
+// ApproveForChild menyetujui satu kali peminjaman buku oleh anak
+func (s *loanService) ApproveForChild(guardianID, childID uint, input *GuardianApprovalRequest) (*GuardianApproval, error) {
+	if _, err := users.GuardianOf(s.db, guardianID, childID); err != nil {
+		return nil, err
+	}
+
+	var book books.Book
+	if err := s.db.First(&book, input.BookID).Error; err != nil {
+		return nil, errors.New("book not found")
+	}
+
+	// Persetujuan yang belum dipakai tidak perlu dibuat ulang
+	var approval GuardianApproval
+	err := s.db.Where("child_id = ? AND book_id = ? AND used_at IS NULL", childID, book.ID).First(&approval).Error
+	if err == nil {
+		return &approval, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	approval = GuardianApproval{ChildID: childID, BookID: book.ID, GuardianID: guardianID}
+	if err := s.db.Create(&approval).Error; err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
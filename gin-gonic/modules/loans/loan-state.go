@@ -0,0 +1,343 @@
+package loans
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gin-gonic/modules/books"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTransition dikembalikan jika status pinjaman tidak boleh berpindah ke status yang diminta
+var ErrInvalidTransition = errors.New("perubahan status pinjaman tidak diizinkan")
+
+// loanTransitions adalah perpindahan status pinjaman yang diizinkan
+var loanTransitions = map[string][]string{
+	LoanBorrowed:        {LoanOverdue, LoanReturned, LoanLost, LoanDamaged, LoanClaimedReturned},
+	LoanOverdue:         {LoanReturned, LoanLost, LoanDamaged, LoanClaimedReturned},
+	LoanClaimedReturned: {LoanReturned, LoanLost},
+	// Buku hilang yang ditemukan kembali (bisa dalam kondisi rusak)
+	LoanLost: {LoanReturned, LoanDamaged},
+	// Kerusakan yang baru diketahui setelah buku dikembalikan
+	LoanReturned: {LoanDamaged},
+}
+
+// openStatuses adalah status pinjaman yang bukunya masih di tangan peminjam (dihitung ke batas pinjam)
+var openStatuses = []string{LoanBorrowed, LoanOverdue, LoanClaimedReturned}
+
+// returnableStatuses adalah status pinjaman yang bisa dikembalikan ke rak oleh staf
+var returnableStatuses = []string{LoanBorrowed, LoanOverdue, LoanClaimedReturned, LoanLost}
+
+// patronReturnableStatuses adalah status pinjaman yang boleh dikembalikan sendiri oleh peminjam
+// (aplikasi atau kiosk). Buku hilang atau diklaim dikembalikan harus diterima staf karena
+// pengembaliannya menambah stok dan membebaskan biaya penggantian.
+var patronReturnableStatuses = []string{LoanBorrowed, LoanOverdue}
+
+var errStaffReturnRequired = errors.New("pinjaman ini harus dikembalikan di meja pustakawan")
+
+func canTransition(from, to string) bool {
+	for _, allowed := range loanTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func patronCanReturn(status string) bool {
+	for _, allowed := range patronReturnableStatuses {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// onShelf mengecek apakah buku dengan status pinjaman ini dihitung di stok.
+// Buku rusak ditarik dari sirkulasi sehingga tidak menambah stok.
+func onShelf(status string) bool {
+	return status == LoanReturned
+}
+
+// stockDelta adalah perubahan stok buku saat pinjaman berpindah dari status from ke to
+func stockDelta(from, to string) int {
+	switch {
+	case onShelf(to) && !onShelf(from):
+		return 1
+	case onShelf(from) && !onShelf(to):
+		return -1
+	}
+	return 0
+}
+
+// recordStatus menyimpan perpindahan status ke loan_status_history
+func recordStatus(tx *gorm.DB, loanID uint, from, to string, origin loanOrigin, note string) error {
+	change := LoanStatusChange{
+		LoanID:     loanID,
+		FromStatus: from,
+		ToStatus:   to,
+		KioskID:    origin.KioskID,
+		Note:       note,
+		CreatedAt:  time.Now(),
+	}
+	if origin.ActorID != 0 {
+		change.ActorID = &origin.ActorID
+	}
+	return tx.Create(&change).Error
+}
+
+// transitionTx memindahkan status pinjaman di dalam transaksi: mengecek aturan perpindahan,
+// menyesuaikan stok buku dan mencatat history. updates berisi kolom lain yang ikut diubah.
+func transitionTx(tx *gorm.DB, loan *Loan, to string, origin loanOrigin, note string, updates map[string]interface{}) error {
+	from := loan.Status
+	if !canTransition(from, to) {
+		return fmt.Errorf("%w (%s ke %s)", ErrInvalidTransition, from, to)
+	}
+
+	columns := map[string]interface{}{"status": to}
+	for column, value := range updates {
+		columns[column] = value
+	}
+	// Kondisi status mencegah perpindahan ganda oleh request bersamaan
+	result := tx.Model(&Loan{}).Where("id = ? AND status = ?", loan.ID, from).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w (status pinjaman sudah berubah)", ErrInvalidTransition)
+	}
+
+	switch stockDelta(from, to) {
+	case 1:
+		if err := tx.Model(&books.Book{}).Where("id = ?", loan.BookID).
+			Update("stock", gorm.Expr("stock + ?", 1)).Error; err != nil {
+			return err
+		}
+	case -1:
+		// Sama seperti borrowTx, stok tidak boleh minus. Stok 0 berarti eksemplar lain
+		// sudah dipinjamkan lagi; stok dibiarkan dan dicatat di history untuk dicek staf.
+		result := tx.Model(&books.Book{}).Where("id = ? AND stock > 0", loan.BookID).
+			Update("stock", gorm.Expr("stock - ?", 1))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			note = strings.TrimSpace(note + " (stok buku sudah 0, tidak dikurangi)")
+		}
+	}
+
+	if err := recordStatus(tx, loan.ID, from, to, origin, note); err != nil {
+		return err
+	}
+	loan.Status = to
+	return nil
+}
+
+// MarkOverdue memindahkan pinjaman yang melewati tanggal kembali ke status overdue.
+// Mengembalikan jumlah pinjaman yang ditandai.
+func MarkOverdue(db *gorm.DB, now time.Time) (int, error) {
+	var due []Loan
+	if err := db.Where("status = ? AND return_date < ?", LoanBorrowed, now).
+		Order("id").Limit(overdueBatchSize).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	marked := 0
+	for _, loan := range due {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return transitionTx(tx, &loan, LoanOverdue, loanOrigin{}, "", nil)
+		})
+		if errors.Is(err, ErrInvalidTransition) {
+			// Sudah dikembalikan atau diubah instance lain
+			continue
+		}
+		if err != nil {
+			return marked, err
+		}
+		marked++
+	}
+	return marked, nil
+}
+
+// chargeFine membuat denda untuk peminjam. amount nil berarti biaya penggantian buku.
+func chargeFine(tx *gorm.DB, loan *Loan, kind string, amount *int64, origin loanOrigin, note string) (*LoanFine, error) {
+	value := int64(0)
+	if amount != nil {
+		value = *amount
+	} else {
+		var book books.Book
+		if err := tx.Unscoped().Select("id", "replacement_cost").First(&book, loan.BookID).Error; err != nil {
+			return nil, err
+		}
+		value = book.ReplacementCost
+	}
+	if value == 0 {
+		return nil, nil
+	}
+
+	fine := LoanFine{
+		LoanID: loan.ID,
+		UserID: loan.UserID,
+		Kind:   kind,
+		Amount: value,
+		Status: FineUnpaid,
+		Note:   note,
+	}
+	if origin.ActorID != 0 {
+		fine.CreatedBy = &origin.ActorID
+	}
+	if err := tx.Create(&fine).Error; err != nil {
+		return nil, err
+	}
+	return &fine, nil
+}
+
+// lateFeeTx mengenakan denda keterlambatan saat buku yang masih dipinjam (from borrowed/overdue)
+// kembali setelah tanggal harus kembali. Hari yang belum genap dihitung satu hari.
+func lateFeeTx(tx *gorm.DB, loan *Loan, from string, origin loanOrigin) error {
+	now := time.Now()
+	if loan.LateFeePerDay == 0 || !patronCanReturn(from) || !now.After(loan.ReturnDate) {
+		return nil
+	}
+	days := int64(math.Ceil(now.Sub(loan.ReturnDate).Hours() / 24))
+	amount := days * loan.LateFeePerDay
+	_, err := chargeFine(tx, loan, FineLate, &amount, origin, fmt.Sprintf("terlambat %d hari", days))
+	return err
+}
+
+// markLoan memindahkan pinjaman ke status hilang, rusak atau diklaim dikembalikan oleh staf
+func (s *loanService) markLoan(id string, staffID uint, to string, input *MarkLoanRequest) (*Loan, error) {
+	var loan Loan
+	if err := s.db.First(&loan, id).Error; err != nil {
+		return nil, errors.New("loan not found")
+	}
+
+	origin := loanOrigin{ActorID: staffID, StaffID: &staffID}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if to == LoanDamaged {
+			return damageTx(tx, &loan, origin, input.Amount, input.Note, nil)
+		}
+		if err := transitionTx(tx, &loan, to, origin, input.Note, nil); err != nil {
+			return err
+		}
+		if to == LoanLost {
+			_, err := chargeFine(tx, &loan, FineReplacement, input.Amount, origin, input.Note)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.broadcastStats()
+
+	var fullLoan Loan
+	if err := s.db.Preload("User").Preload("Book").First(&fullLoan, loan.ID).Error; err != nil {
+		return nil, err
+	}
+	return &fullLoan, nil
+}
+
+// MarkLost menandai buku hilang. Stok tidak kembali dan peminjam dikenakan biaya penggantian.
+func (s *loanService) MarkLost(id string, staffID uint, input *MarkLoanRequest) (*Loan, error) {
+	return s.markLoan(id, staffID, LoanLost, input)
+}
+
+// MarkDamaged menandai buku rusak. Buku ditarik dari sirkulasi dan peminjam dikenakan biaya kerusakan.
+func (s *loanService) MarkDamaged(id string, staffID uint, input *MarkLoanRequest) (*Loan, error) {
+	return s.markLoan(id, staffID, LoanDamaged, input)
+}
+
+// MarkClaimedReturned mencatat klaim peminjam bahwa buku sudah dikembalikan sambil buku dicari
+func (s *loanService) MarkClaimedReturned(id string, staffID uint, input *MarkLoanRequest) (*Loan, error) {
+	return s.markLoan(id, staffID, LoanClaimedReturned, input)
+}
+
+// GetHistory mengembalikan riwayat status satu pinjaman, terlama lebih dulu
+func (s *loanService) GetHistory(id string) ([]LoanStatusChange, error) {
+	var loan Loan
+	if err := s.db.Select("id").First(&loan, id).Error; err != nil {
+		return nil, errors.New("loan not found")
+	}
+
+	var history []LoanStatusChange
+	if err := s.db.Where("loan_id = ?", loan.ID).Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetFines mengembalikan denda, bisa difilter per user dan status
+func (s *loanService) GetFines(userID uint, status string) ([]LoanFine, error) {
+	query := s.db.Order("created_at DESC")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var fines []LoanFine
+	if err := query.Find(&fines).Error; err != nil {
+		return nil, err
+	}
+	return fines, nil
+}
+
+// SettleFine menandai denda sudah dibayar atau dibebaskan
+func (s *loanService) SettleFine(id string, staffID uint, input *SettleFineRequest) (*LoanFine, error) {
+	var fine LoanFine
+	if err := s.db.First(&fine, id).Error; err != nil {
+		return nil, errors.New("fine not found")
+	}
+	if fine.Status != FineUnpaid {
+		return nil, errors.New("denda sudah diselesaikan")
+	}
+
+	now := time.Now()
+	fine.Status = input.Status
+	fine.SettledBy = &staffID
+	fine.SettledAt = &now
+	if input.Note != "" {
+		fine.Note = input.Note
+	}
+	result := s.db.Model(&fine).Where("status = ?", FineUnpaid).
+		Select("status", "settled_by", "settled_at", "note").Updates(&fine)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("denda sudah diselesaikan")
+	}
+	return &fine, nil
+}
+
+// damageTx menandai pinjaman rusak dan mengenakan biaya kerusakan. Buku hilang yang ditemukan
+// dalam kondisi rusak tidak lagi dikenakan biaya penggantian agar peminjam tidak membayar dua kali.
+func damageTx(tx *gorm.DB, loan *Loan, origin loanOrigin, amount *int64, note string, updates map[string]interface{}) error {
+	from := loan.Status
+	if err := transitionTx(tx, loan, LoanDamaged, origin, note, updates); err != nil {
+		return err
+	}
+	if from == LoanLost {
+		if err := waiveReplacementFines(tx, loan.ID, origin); err != nil {
+			return err
+		}
+	}
+	_, err := chargeFine(tx, loan, FineDamage, amount, origin, note)
+	return err
+}
+
+// waiveReplacementFines membebaskan biaya penggantian yang belum dibayar saat buku hilang ditemukan
+func waiveReplacementFines(tx *gorm.DB, loanID uint, origin loanOrigin) error {
+	updates := map[string]interface{}{"status": FineWaived, "settled_at": time.Now(), "note": "buku ditemukan"}
+	if origin.ActorID != 0 {
+		updates["settled_by"] = origin.ActorID
+	}
+	return tx.Model(&LoanFine{}).Where("loan_id = ? AND kind = ? AND status = ?", loanID, FineReplacement, FineUnpaid).
+		Updates(updates).Error
+}
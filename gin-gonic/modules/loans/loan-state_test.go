@@ -0,0 +1,64 @@
+package loans
+
+import "testing"
+
+func TestLoanTransitions(t *testing.T) {
+	statuses := []string{LoanBorrowed, LoanOverdue, LoanReturned, LoanLost, LoanDamaged, LoanClaimedReturned}
+	allowed := map[string]bool{
+		LoanBorrowed + ">" + LoanOverdue:         true,
+		LoanBorrowed + ">" + LoanReturned:        true,
+		LoanBorrowed + ">" + LoanLost:            true,
+		LoanBorrowed + ">" + LoanDamaged:         true,
+		LoanBorrowed + ">" + LoanClaimedReturned: true,
+		LoanOverdue + ">" + LoanReturned:         true,
+		LoanOverdue + ">" + LoanLost:             true,
+		LoanOverdue + ">" + LoanDamaged:          true,
+		LoanOverdue + ">" + LoanClaimedReturned:  true,
+		LoanClaimedReturned + ">" + LoanReturned: true,
+		LoanClaimedReturned + ">" + LoanLost:     true,
+		LoanLost + ">" + LoanReturned:            true,
+		LoanLost + ">" + LoanDamaged:             true,
+		LoanReturned + ">" + LoanDamaged:         true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[from+">"+to]
+			if got := canTransition(from, to); got != want {
+				t.Errorf("canTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestStockDelta(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     int
+	}{
+		{LoanBorrowed, LoanReturned, 1},
+		{LoanOverdue, LoanReturned, 1},
+		{LoanClaimedReturned, LoanReturned, 1},
+		{LoanLost, LoanReturned, 1},
+		{LoanReturned, LoanDamaged, -1},
+		{LoanBorrowed, LoanOverdue, 0},
+		{LoanBorrowed, LoanLost, 0},
+		{LoanBorrowed, LoanDamaged, 0},
+		{LoanLost, LoanDamaged, 0},
+		{LoanBorrowed, LoanClaimedReturned, 0},
+	}
+	for _, tc := range cases {
+		if got := stockDelta(tc.from, tc.to); got != tc.want {
+			t.Errorf("stockDelta(%s, %s) = %d, want %d", tc.from, tc.to, got, tc.want)
+		}
+	}
+
+	// Setiap perpindahan yang diizinkan hanya boleh mengubah stok satu eksemplar
+	for from, targets := range loanTransitions {
+		for _, to := range targets {
+			if d := stockDelta(from, to); d < -1 || d > 1 {
+				t.Errorf("stockDelta(%s, %s) = %d", from, to, d)
+			}
+		}
+	}
+}
@@ -7,23 +7,245 @@ import (
 	"gin-gonic/modules/users"
 )
 
+// Status pinjaman. Perpindahan yang diizinkan ada di loanTransitions (loan-state.go).
+const (
+	LoanBorrowed        = "borrowed"
+	LoanOverdue         = "overdue"
+	LoanReturned        = "returned"
+	LoanLost            = "lost"
+	LoanDamaged         = "damaged"
+	LoanClaimedReturned = "claimed_returned" // Peminjam mengaku sudah mengembalikan, buku belum ditemukan
+)
+
+// Jenis dan status denda pinjaman
+const (
+	FineReplacement = "replacement"
+	FineDamage      = "damage"
+	FineLate        = "late"
+
+	FineUnpaid = "unpaid"
+	FinePaid   = "paid"
+	FineWaived = "waived"
+)
+
+// Kondisi buku yang dinilai staf saat check-in
+const (
+	ConditionGood    = "good"
+	ConditionWorn    = "worn"
+	ConditionDamaged = "damaged"
+)
+
 type Loan struct {
 	ID         uint       `json:"id" gorm:"primaryKey"`
-	UserID     uint       `json:"user_id"`                        // ID Peminjam
-	User       users.User `json:"user" gorm:"foreignKey:UserID"`  // Relasi ke User
-	BookID     uint       `json:"book_id"`                        // ID Buku
-	Book       books.Book `json:"book" gorm:"foreignKey:BookID"`  // Relasi ke Book
-	LoanDate   time.Time  `json:"loan_date"`                      // Tanggal Pinjam
-	ReturnDate time.Time  `json:"return_date"`                    // Tanggal Harus Kembali
-	Status     string     `json:"status" gorm:"default:borrowed"` // Status: borrowed/returned
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	UserID     uint       `json:"user_id"`                              // ID Peminjam
+	User       users.User `json:"user" gorm:"foreignKey:UserID"`        // Relasi ke User
+	BookID     uint       `json:"book_id"`                              // ID Buku
+	Book       books.Book `json:"book" gorm:"foreignKey:BookID"`        // Relasi ke Book
+	LoanDate   time.Time  `json:"loan_date"`                            // Tanggal Pinjam
+	ReturnDate time.Time  `json:"return_date"`                          // Tanggal Harus Kembali
+	Status     string     `json:"status" gorm:"index;default:borrowed"` // Lihat konstanta Loan* di atas
+	// Waktu buku benar-benar dikembalikan. Pinjaman lama (sebelum kolom ini ada) bernilai nil
+	// dan return_date-nya sudah tertimpa waktu kembali.
+	ReturnedAt *time.Time `json:"returned_at"`
+	// Waktu pemberitahuan keterlambatan dikirim, nil jika belum
+	OverdueNotifiedAt *time.Time `json:"overdue_notified_at"`
+	// Percobaan kirim pemberitahuan keterlambatan dan waktu paling cepat untuk mencoba lagi,
+	// lihat helper.MailClaimLease
+	OverdueNoticeAttempts int        `json:"-" gorm:"not null;default:0"`
+	OverdueNoticeNextAt   *time.Time `json:"-"`
+	// Perangkat kiosk yang memproses pinjam/kembali, nil jika lewat aplikasi atau meja pustakawan
+	CheckoutKioskID *uint `json:"checkout_kiosk_id"`
+	ReturnKioskID   *uint `json:"return_kiosk_id"`
+	// Staf yang memproses pinjam/kembali atas nama peminjam di meja pustakawan
+	CheckoutStaffID *uint `json:"checkout_staff_id"`
+	ReturnStaffID   *uint `json:"return_staff_id"`
+	// Berapa kali pinjaman sudah diperpanjang, dibatasi MaxRenewals plan keanggotaan
+	Renewals int `json:"renewals" gorm:"not null;default:0"`
+	// Denda keterlambatan per hari, diambil dari plan keanggotaan saat meminjam
+	LateFeePerDay int64 `json:"late_fee_per_day" gorm:"not null;default:0"`
+	// Kondisi buku saat dikembalikan (lihat konstanta Condition*), kosong jika belum dinilai
+	ReturnCondition string    `json:"return_condition"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 func (Loan) TableName() string {
 	return "loans"
 }
 
+// LoanStatusChange mencatat setiap perpindahan status pinjaman
+type LoanStatusChange struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	LoanID     uint      `json:"loan_id" gorm:"index;not null"`
+	FromStatus string    `json:"from_status"` // Kosong untuk pinjaman baru
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	ActorID    *uint     `json:"actor_id"` // Nil jika diubah oleh sistem (misalnya pengecekan keterlambatan)
+	KioskID    *uint     `json:"kiosk_id"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (LoanStatusChange) TableName() string {
+	return "loan_status_history"
+}
+
+// LoanFine adalah denda yang dikenakan ke peminjam, misalnya biaya penggantian buku hilang atau rusak
+type LoanFine struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	LoanID    uint       `json:"loan_id" gorm:"index;not null"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	Kind      string     `json:"kind" gorm:"not null"`
+	Amount    int64      `json:"amount" gorm:"not null"` // Rupiah
+	Status    string     `json:"status" gorm:"index;not null;default:unpaid"`
+	Note      string     `json:"note"`
+	CreatedBy *uint      `json:"created_by"`
+	SettledBy *uint      `json:"settled_by"`
+	SettledAt *time.Time `json:"settled_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (LoanFine) TableName() string {
+	return "loan_fines"
+}
+
 type LoanRequest struct {
 	BookID uint `json:"book_id" binding:"required"`
 }
+
+// loanOrigin mencatat perangkat atau staf yang memproses peminjaman atau pengembalian atas nama peminjam
+type loanOrigin struct {
+	ActorID uint // User yang melakukan aksi (peminjam atau staf), 0 untuk sistem
+	KioskID *uint
+	StaffID *uint
+}
+
+// DTO untuk menandai pinjaman hilang, rusak atau diklaim sudah dikembalikan.
+// Amount kosong berarti biaya penggantian buku (hanya untuk hilang dan rusak).
+type MarkLoanRequest struct {
+	Amount *int64 `json:"amount" binding:"omitempty,min=0"`
+	Note   string `json:"note" binding:"omitempty,max=500"`
+}
+
+// DTO untuk menyelesaikan denda (dibayar atau dibebaskan)
+type SettleFineRequest struct {
+	Status string `json:"status" binding:"required,oneof=paid waived"`
+	Note   string `json:"note" binding:"omitempty,max=500"`
+}
+
+// LoanCondition adalah penilaian kondisi buku oleh staf saat check-in, satu per pinjaman.
+// BookID ikut disimpan agar riwayat kondisi per judul bisa dilihat tanpa join ke loans.
+type LoanCondition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	LoanID     uint      `json:"loan_id" gorm:"uniqueIndex;not null"`
+	BookID     uint      `json:"book_id" gorm:"index;not null"`
+	UserID     uint      `json:"user_id" gorm:"index;not null"`
+	Condition  string    `json:"condition" gorm:"index;not null"`
+	Notes      string    `json:"notes"`
+	Photos     []string  `json:"photos" gorm:"type:text;serializer:json"` // URL foto kondisi buku
+	AssessedBy uint      `json:"assessed_by" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (LoanCondition) TableName() string {
+	return "loan_conditions"
+}
+
+// DTO untuk check-in dengan penilaian kondisi buku. Amount hanya dipakai untuk kondisi rusak,
+// nil berarti biaya penggantian buku dan 0 berarti tanpa denda.
+type CheckInRequest struct {
+	Condition string `json:"condition" binding:"required,oneof=good worn damaged"`
+	Notes     string `json:"notes" binding:"omitempty,max=1000"`
+	Amount    *int64 `json:"amount" binding:"omitempty,min=0"`
+}
+
+// Baris laporan kerusakan, dikelompokkan per patron atau per judul buku
+type DamageReportRow struct {
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	Damaged        int64     `json:"damaged"`
+	Worn           int64     `json:"worn"`
+	LastAssessedAt time.Time `json:"last_assessed_at"`
+}
+
+// Response ketersediaan buku beserta perkiraan kapan tersedia lagi. Belum ada fitur reservasi,
+// sehingga tidak ada antrean hold dan perkiraan hanya berdasarkan pinjaman aktif.
+type BookAvailability struct {
+	BookID      uint      `json:"book_id"`
+	Stock       int       `json:"stock"`
+	Available   bool      `json:"available"`
+	ActiveLoans []LoanDue `json:"active_loans"`
+	// Median keterlambatan pengembalian dalam hari (negatif jika biasanya kembali lebih awal)
+	MedianLateDays float64 `json:"median_late_days"`
+	// Nil jika stok habis dan tidak ada pinjaman aktif (misalnya semua eksemplar hilang)
+	EstimatedAvailableAt *time.Time `json:"estimated_available_at"`
+}
+
+// Tanggal kembali satu pinjaman aktif, tanpa data peminjam
+type LoanDue struct {
+	DueDate time.Time `json:"due_date"`
+	Overdue bool      `json:"overdue"`
+}
+
+// DTO untuk peminjaman di meja pustakawan. Patron dipilih lewat user_id atau card_number,
+// buku lewat book_ids dan/atau barcodes. Semua buku dipinjam dalam satu transaksi.
+type DeskCheckoutRequest struct {
+	UserID     uint     `json:"user_id"`
+	CardNumber string   `json:"card_number" binding:"omitempty,max=20"`
+	BookIDs    []uint   `json:"book_ids" binding:"omitempty,max=20"`
+	Barcodes   []string `json:"barcodes" binding:"omitempty,max=20,dive,max=64"`
+}
+
+// DTO untuk pengembalian di meja pustakawan, lewat loan_ids atau patron beserta buku yang dikembalikan.
+// Semua pinjaman dikembalikan dalam satu transaksi.
+type DeskReturnRequest struct {
+	LoanIDs    []uint   `json:"loan_ids" binding:"omitempty,max=20"`
+	UserID     uint     `json:"user_id"`
+	CardNumber string   `json:"card_number" binding:"omitempty,max=20"`
+	BookIDs    []uint   `json:"book_ids" binding:"omitempty,max=20"`
+	Barcodes   []string `json:"barcodes" binding:"omitempty,max=20,dive,max=64"`
+}
+
+// AgeOverride adalah izin admin agar user meminjam satu buku yang dibatasi umur.
+// Berlaku untuk satu kali peminjaman, LoanID terisi setelah dipakai.
+type AgeOverride struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	BookID    uint       `json:"book_id" gorm:"index;not null"`
+	GrantedBy uint       `json:"granted_by" gorm:"not null"`
+	Reason    string     `json:"reason" gorm:"not null"`
+	LoanID    *uint      `json:"loan_id"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (AgeOverride) TableName() string {
+	return "loan_age_overrides"
+}
+
+// DTO untuk request izin pinjam buku dengan batas umur
+type AgeOverrideRequest struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	BookID uint   `json:"book_id" binding:"required"`
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// GuardianApproval adalah persetujuan wali agar anak meminjam satu buku dari kategori
+// yang wajib disetujui. Berlaku untuk satu kali peminjaman, LoanID terisi setelah dipakai.
+type GuardianApproval struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	ChildID    uint       `json:"child_id" gorm:"index;not null"`
+	BookID     uint       `json:"book_id" gorm:"index;not null"`
+	GuardianID uint       `json:"guardian_id" gorm:"not null"`
+	LoanID     *uint      `json:"loan_id"`
+	UsedAt     *time.Time `json:"used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (GuardianApproval) TableName() string {
+	return "loan_guardian_approvals"
+}
+
+// DTO untuk persetujuan wali atas buku yang akan dipinjam anak
+type GuardianApprovalRequest struct {
+	BookID uint `json:"book_id" binding:"required"`
+}
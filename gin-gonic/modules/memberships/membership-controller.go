@@ -0,0 +1,166 @@
+package memberships
+
+import (
+	"net/http"
+	"strconv"
+
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MembershipController interface {
+	GetPlans(ctx *gin.Context)
+	GetAllPlans(ctx *gin.Context)
+	CreatePlan(ctx *gin.Context)
+	UpdatePlan(ctx *gin.Context)
+	GetMy(ctx *gin.Context)
+	GetByUser(ctx *gin.Context)
+	Renew(ctx *gin.Context)
+	ChangePlan(ctx *gin.Context)
+}
+
+type membershipController struct {
+	service MembershipService
+}
+
+func NewMembershipController(service MembershipService) MembershipController {
+	return &membershipController{service: service}
+}
+
+func auditMeta(ctx *gin.Context) users.AuditMeta {
+	meta := users.AuditMeta{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	if principal, ok := middlewares.CurrentPrincipal(ctx); ok {
+		meta.ActorID = principal.UserID
+	}
+	return meta
+}
+
+func userParam(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID tidak valid"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetPlans menampilkan plan yang aktif (publik)
+func (c *membershipController) GetPlans(ctx *gin.Context) {
+	plans, err := c.service.GetPlans(false)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": plans})
+}
+
+// GetAllPlans menampilkan semua plan termasuk yang nonaktif (admin)
+func (c *membershipController) GetAllPlans(ctx *gin.Context) {
+	plans, err := c.service.GetPlans(true)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": plans})
+}
+
+func (c *membershipController) CreatePlan(ctx *gin.Context) {
+	var input CreatePlanRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	plan, err := c.service.CreatePlan(&input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, plan)
+}
+
+func (c *membershipController) UpdatePlan(ctx *gin.Context) {
+	var input UpdatePlanRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	plan, err := c.service.UpdatePlan(ctx.Param("id"), &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal memperbarui data: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, plan)
+}
+
+func (c *membershipController) GetMy(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	membership, err := c.service.GetByUser(principal.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, membership)
+}
+
+func (c *membershipController) GetByUser(ctx *gin.Context) {
+	userID, ok := userParam(ctx)
+	if !ok {
+		return
+	}
+
+	membership, err := c.service.GetByUser(userID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, membership)
+}
+
+func (c *membershipController) Renew(ctx *gin.Context) {
+	userID, ok := userParam(ctx)
+	if !ok {
+		return
+	}
+
+	var input RenewMembershipRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	membership, err := c.service.Renew(userID, &input, auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, membership)
+}
+
+func (c *membershipController) ChangePlan(ctx *gin.Context) {
+	userID, ok := userParam(ctx)
+	if !ok {
+		return
+	}
+
+	var input ChangePlanRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	membership, err := c.service.ChangePlan(userID, &input, auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, membership)
+}
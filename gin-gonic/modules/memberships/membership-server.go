@@ -0,0 +1,70 @@
+package memberships
+
+import (
+	"log"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MembershipServer struct {
+	router  *gin.RouterGroup
+	db      *gorm.DB
+	version string
+}
+
+func NewMembershipServer(router *gin.RouterGroup, db *gorm.DB, version string) *MembershipServer {
+	return &MembershipServer{router: router, db: db, version: version}
+}
+
+func (s *MembershipServer) Init() {
+	config, err := helper.LoadConfig(".")
+	if err != nil {
+		log.Fatal("Cannot load config:", err)
+	}
+
+	if config.AUTO_MIGRATE == "Y" {
+		if err := s.db.AutoMigrate(&MembershipPlan{}, &Membership{}); err != nil {
+			log.Printf("Failed to auto migrate Membership: %v", err)
+		}
+	}
+
+	if config.MembershipWarningDays > 0 {
+		ExpiryWarningWindow = time.Duration(config.MembershipWarningDays) * 24 * time.Hour
+	}
+
+	service := NewMembershipService(s.db)
+	controller := NewMembershipController(service)
+
+	if err := service.SeedDefaults(); err != nil {
+		log.Printf("Failed to seed default membership plan: %v", err)
+	}
+
+	mailer, err := helper.NewMailer(config)
+	if err != nil {
+		log.Fatal("Cannot create mailer:", err)
+	}
+	// Pengingat keanggotaan yang akan berakhir
+	StartExpiryWarnings(s.db, mailer)
+
+	router := middlewares.NewRouter(s.router)
+	canManage := middlewares.RequirePermission(roles.PermMembershipsManage)
+
+	router.GET("/"+s.version+"/membership-plans", middlewares.Public(), controller.GetPlans)
+	router.GET("/"+s.version+"/users/me/membership", middlewares.Authenticated(), controller.GetMy)
+
+	adminPlans := router.Group("/" + s.version + "/admin/membership-plans")
+	adminPlans.GET("", canManage, controller.GetAllPlans)
+	adminPlans.POST("", canManage, controller.CreatePlan)
+	adminPlans.PUT("/:id", canManage, controller.UpdatePlan)
+
+	adminUsers := router.Group("/" + s.version + "/admin/users")
+	adminUsers.GET("/:id/membership", canManage, controller.GetByUser)
+	adminUsers.POST("/:id/membership/renew", canManage, controller.Renew)
+	adminUsers.PUT("/:id/membership/plan", canManage, controller.ChangePlan)
+}
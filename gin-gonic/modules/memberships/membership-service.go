@@ -0,0 +1,334 @@
+package memberships
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-gonic/modules/users"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMembershipExpired dikembalikan jika masa keanggotaan user sudah berakhir
+var ErrMembershipExpired = errors.New("keanggotaan Anda sudah berakhir, silakan perpanjang di perpustakaan")
+
+// checkFee memastikan biaya keanggotaan sudah dibayar sebelum periode baru diberikan
+func checkFee(fee int64, periods int, paid int64) error {
+	if due := fee * int64(periods); paid < due {
+		return fmt.Errorf("biaya keanggotaan belum lunas: Rp%d dari Rp%d", paid, due)
+	}
+	return nil
+}
+
+// defaultPlan dibuat saat startup jika belum ada plan default.
+// Nilainya sama dengan aturan pinjam sebelum ada plan (7 hari).
+var defaultPlan = MembershipPlan{
+	Name:         "Basic",
+	Description:  "Keanggotaan standar",
+	MaxLoans:     3,
+	LoanDays:     7,
+	MaxRenewals:  1,
+	DurationDays: 365,
+	IsDefault:    true,
+	Active:       true,
+}
+
+type MembershipService interface {
+	SeedDefaults() error
+	GetPlans(includeInactive bool) ([]MembershipPlan, error)
+	CreatePlan(input *CreatePlanRequest) (*MembershipPlan, error)
+	UpdatePlan(id string, input *UpdatePlanRequest) (*MembershipPlan, error)
+	GetByUser(userID uint) (*Membership, error)
+	Renew(userID uint, input *RenewMembershipRequest, meta users.AuditMeta) (*Membership, error)
+	ChangePlan(userID uint, input *ChangePlanRequest, meta users.AuditMeta) (*Membership, error)
+}
+
+type membershipService struct {
+	db *gorm.DB
+}
+
+func NewMembershipService(db *gorm.DB) MembershipService {
+	return &membershipService{db: db}
+}
+
+// Current mengembalikan keanggotaan user beserta plan-nya. User yang belum memiliki
+// keanggotaan didaftarkan ke plan default dengan periode yang dimulai sekarang.
+func Current(db *gorm.DB, userID uint, now time.Time) (*Membership, error) {
+	var membership Membership
+	err := db.Preload("Plan").Where("user_id = ?", userID).First(&membership).Error
+	if err == nil {
+		return &membership, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var plan MembershipPlan
+	if err := db.Where("is_default = ?", true).First(&plan).Error; err != nil {
+		return nil, errors.New("plan keanggotaan default belum diatur")
+	}
+
+	// Request bersamaan untuk user yang sama tidak membuat dua keanggotaan
+	membership = Membership{
+		UserID:    userID,
+		PlanID:    plan.ID,
+		StartsAt:  now,
+		ExpiresAt: now.AddDate(0, 0, plan.DurationDays),
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&membership).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Preload("Plan").Where("user_id = ?", userID).First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// SeedDefaults membuat plan default jika belum ada
+func (s *membershipService) SeedDefaults() error {
+	var count int64
+	if err := s.db.Model(&MembershipPlan{}).Where("is_default = ?", true).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	plan := defaultPlan
+	return s.db.Where(MembershipPlan{Name: plan.Name}).Attrs(plan).FirstOrCreate(&plan).Error
+}
+
+func (s *membershipService) GetPlans(includeInactive bool) ([]MembershipPlan, error) {
+	query := s.db.Order("id")
+	if !includeInactive {
+		query = query.Where("active = ?", true)
+	}
+
+	var plans []MembershipPlan
+	if err := query.Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// clearDefault melepas status default dari plan lain agar hanya ada satu plan default
+func clearDefault(tx *gorm.DB, exceptID uint) error {
+	return tx.Model(&MembershipPlan{}).Where("is_default = ? AND id <> ?", true, exceptID).
+		Update("is_default", false).Error
+}
+
+func (s *membershipService) CreatePlan(input *CreatePlanRequest) (*MembershipPlan, error) {
+	var existing int64
+	if err := s.db.Model(&MembershipPlan{}).Where("name = ?", input.Name).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, errors.New("nama plan sudah digunakan")
+	}
+
+	plan := MembershipPlan{
+		Name:          input.Name,
+		Description:   input.Description,
+		MaxLoans:      input.MaxLoans,
+		LoanDays:      input.LoanDays,
+		MaxRenewals:   input.MaxRenewals,
+		DurationDays:  input.DurationDays,
+		Fee:           input.Fee,
+		LateFeePerDay: input.LateFeePerDay,
+		IsDefault:     input.IsDefault,
+		Active:        true,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&plan).Error; err != nil {
+			return err
+		}
+		if plan.IsDefault {
+			return clearDefault(tx, plan.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (s *membershipService) UpdatePlan(id string, input *UpdatePlanRequest) (*MembershipPlan, error) {
+	var plan MembershipPlan
+	if err := s.db.First(&plan, id).Error; err != nil {
+		return nil, errors.New("plan not found")
+	}
+
+	if input.Description != nil {
+		plan.Description = *input.Description
+	}
+	if input.MaxLoans != nil {
+		plan.MaxLoans = *input.MaxLoans
+	}
+	if input.LoanDays != nil {
+		plan.LoanDays = *input.LoanDays
+	}
+	if input.MaxRenewals != nil {
+		plan.MaxRenewals = *input.MaxRenewals
+	}
+	if input.DurationDays != nil {
+		plan.DurationDays = *input.DurationDays
+	}
+	if input.Fee != nil {
+		plan.Fee = *input.Fee
+	}
+	if input.LateFeePerDay != nil {
+		plan.LateFeePerDay = *input.LateFeePerDay
+	}
+	if input.Active != nil {
+		plan.Active = *input.Active
+	}
+	if input.IsDefault != nil {
+		if plan.IsDefault && !*input.IsDefault {
+			return nil, errors.New("pilih plan default lain terlebih dahulu")
+		}
+		plan.IsDefault = *input.IsDefault
+	}
+	if plan.IsDefault && !plan.Active {
+		return nil, errors.New("plan default tidak dapat dinonaktifkan")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&plan).Error; err != nil {
+			return err
+		}
+		if plan.IsDefault {
+			return clearDefault(tx, plan.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (s *membershipService) GetByUser(userID uint) (*Membership, error) {
+	var user users.User
+	if err := s.db.Select("id").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	return Current(s.db, userID, time.Now())
+}
+
+// audit mencatat perubahan keanggotaan di audit log user
+func audit(tx *gorm.DB, meta users.AuditMeta, userID uint, action, reason, detail string) error {
+	return tx.Create(&users.UserAuditLog{
+		ActorID:   meta.ActorID,
+		UserID:    userID,
+		Action:    action,
+		Reason:    reason,
+		Detail:    detail,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// Renew memperpanjang keanggotaan sejumlah periode plan. Keanggotaan yang masih aktif
+// diperpanjang dari tanggal berakhirnya, yang sudah berakhir dimulai ulang dari sekarang.
+func (s *membershipService) Renew(userID uint, input *RenewMembershipRequest, meta users.AuditMeta) (*Membership, error) {
+	current, err := s.GetByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	periods := input.Periods
+	if periods < 1 {
+		periods = 1
+	}
+
+	var membership Membership
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Dikunci agar dua perpanjangan bersamaan tidak menghitung dari tanggal yang sama
+		if err := lockMembership(tx, current.ID, &membership); err != nil {
+			return err
+		}
+		if err := checkFee(membership.Plan.Fee, periods, input.AmountPaid); err != nil {
+			return err
+		}
+		now := time.Now()
+		if membership.Expired(now) {
+			membership.StartsAt = now
+			membership.ExpiresAt = now
+		}
+		membership.ExpiresAt = membership.ExpiresAt.AddDate(0, 0, membership.Plan.DurationDays*periods)
+		membership.ExpiryWarnedAt = nil
+		membership.ExpiryWarnAttempts = 0
+		membership.ExpiryWarnNextAt = nil
+
+		if err := tx.Model(&membership).Select("starts_at", "expires_at", "expiry_warned_at",
+			"expiry_warn_attempts", "expiry_warn_next_at").Updates(&membership).Error; err != nil {
+			return err
+		}
+		return audit(tx, meta, userID, users.AuditMembershipRenew, input.Reason,
+			fmt.Sprintf("plan=%s periods=%d paid=%d expires_at=%s", membership.Plan.Name, periods,
+				input.AmountPaid, membership.ExpiresAt.Format(time.RFC3339)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ChangePlan memindahkan user ke plan lain (upgrade/downgrade) dengan periode baru mulai sekarang
+func (s *membershipService) ChangePlan(userID uint, input *ChangePlanRequest, meta users.AuditMeta) (*Membership, error) {
+	current, err := s.GetByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan MembershipPlan
+	if err := s.db.Where("id = ? AND active = ?", input.PlanID, true).First(&plan).Error; err != nil {
+		return nil, errors.New("plan not found")
+	}
+	if err := checkFee(plan.Fee, 1, input.AmountPaid); err != nil {
+		return nil, err
+	}
+
+	var membership Membership
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockMembership(tx, current.ID, &membership); err != nil {
+			return err
+		}
+		if plan.ID == membership.PlanID {
+			return errors.New("user sudah memakai plan ini, gunakan perpanjangan")
+		}
+
+		previous := membership.Plan.Name
+		now := time.Now()
+		membership.PlanID = plan.ID
+		membership.Plan = plan
+		membership.StartsAt = now
+		membership.ExpiresAt = now.AddDate(0, 0, plan.DurationDays)
+		membership.ExpiryWarnedAt = nil
+		membership.ExpiryWarnAttempts = 0
+		membership.ExpiryWarnNextAt = nil
+
+		if err := tx.Model(&membership).Select("plan_id", "starts_at", "expires_at", "expiry_warned_at",
+			"expiry_warn_attempts", "expiry_warn_next_at").Updates(&membership).Error; err != nil {
+			return err
+		}
+		return audit(tx, meta, userID, users.AuditMembershipChange, input.Reason,
+			fmt.Sprintf("plan=%s->%s paid=%d expires_at=%s", previous, plan.Name, input.AmountPaid,
+				membership.ExpiresAt.Format(time.RFC3339)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// lockMembership membaca ulang keanggotaan dengan SELECT ... FOR UPDATE di dalam transaksi
+func lockMembership(tx *gorm.DB, membershipID uint, membership *Membership) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(membership, membershipID).Error; err != nil {
+		return err
+	}
+	return tx.First(&membership.Plan, membership.PlanID).Error
+}
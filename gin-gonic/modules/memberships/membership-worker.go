@@ -0,0 +1,132 @@
+package memberships
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/modules/users"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ExpiryWarningWindow adalah jarak waktu sebelum keanggotaan berakhir untuk mengirim pengingat
+	ExpiryWarningWindow = 14 * 24 * time.Hour
+	// ExpiryCheckInterval adalah jeda pengecekan keanggotaan yang akan berakhir
+	ExpiryCheckInterval = 12 * time.Hour
+	// expiryBatchSize membatasi jumlah pengingat per pengecekan
+	expiryBatchSize = 100
+)
+
+// StartExpiryWarnings menjalankan SendExpiryWarnings secara berkala di background
+func StartExpiryWarnings(db *gorm.DB, mailer helper.Mailer) {
+	go func() {
+		ticker := time.NewTicker(ExpiryCheckInterval)
+		defer ticker.Stop()
+		for {
+			sent, err := SendExpiryWarnings(db, mailer, time.Now())
+			if err != nil {
+				log.Printf("Failed to send membership expiry warnings: %v", err)
+			} else if sent > 0 {
+				log.Printf("Sent %d membership expiry warnings", sent)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// SendExpiryWarnings mengirim email pengingat satu kali per periode ke anggota yang
+// keanggotaannya berakhir dalam ExpiryWarningWindow. Setiap keanggotaan diklaim sebelum
+// dikirim dan dicoba lagi jika gagal (lihat helper.MailClaimLease). Mengembalikan jumlah
+// pengingat terkirim.
+func SendExpiryWarnings(db *gorm.DB, mailer helper.Mailer, now time.Time) (int, error) {
+	var expiring []Membership
+	if err := db.Preload("Plan").
+		Where("expires_at > ? AND expires_at <= ? AND expiry_warned_at IS NULL", now, now.Add(ExpiryWarningWindow)).
+		Where("expiry_warn_attempts < ? AND (expiry_warn_next_at IS NULL OR expiry_warn_next_at <= ?)",
+			helper.MailMaxAttempts, now).
+		Order("expires_at").Limit(expiryBatchSize).Find(&expiring).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, membership := range expiring {
+		claimed, err := claimWarning(db, &membership, now)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			// Sudah diklaim instance lain
+			continue
+		}
+
+		var user users.User
+		err = db.Select("id", "name", "email").First(&user, membership.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// User sudah dihapus, tidak ada yang perlu diingatkan
+			if err := markWarned(db, membership.ID, now); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		if err := mailer.Send(helper.Mail{
+			To:      user.Email,
+			Subject: "Keanggotaan perpustakaan akan berakhir",
+			Body: fmt.Sprintf("Halo %s,\n\nKeanggotaan %s Anda berakhir pada %s. "+
+				"Setelah tanggal tersebut Anda tidak dapat meminjam buku sampai keanggotaan diperpanjang.\n\n"+
+				"Silakan hubungi pustakawan untuk memperpanjang keanggotaan.\n",
+				user.Name, membership.Plan.Name, membership.ExpiresAt.In(users.LibraryLocation).Format("2006-01-02")),
+		}); err != nil {
+			log.Printf("Failed to send expiry warning for membership %d (attempt %d): %v",
+				membership.ID, membership.ExpiryWarnAttempts, err)
+			if err := retryWarning(db, &membership, now); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := markWarned(db, membership.ID, now); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// claimWarning menaikkan jumlah percobaan jika belum berubah sejak dibaca, sehingga hanya
+// satu instance yang mengirim pengingat. Klaim berlaku sampai helper.MailClaimLease.
+func claimWarning(db *gorm.DB, membership *Membership, now time.Time) (bool, error) {
+	result := db.Model(&Membership{}).
+		Where("id = ? AND expiry_warned_at IS NULL AND expiry_warn_attempts = ?", membership.ID, membership.ExpiryWarnAttempts).
+		Updates(map[string]interface{}{
+			"expiry_warn_attempts": gorm.Expr("expiry_warn_attempts + 1"),
+			"expiry_warn_next_at":  now.Add(helper.MailClaimLease),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	membership.ExpiryWarnAttempts++
+	return result.RowsAffected == 1, nil
+}
+
+// retryWarning melepas klaim setelah gagal kirim dan menjadwalkan percobaan berikutnya
+func retryWarning(db *gorm.DB, membership *Membership, now time.Time) error {
+	if membership.ExpiryWarnAttempts >= helper.MailMaxAttempts {
+		log.Printf("Giving up expiry warning for membership %d after %d attempts", membership.ID, membership.ExpiryWarnAttempts)
+	}
+	return db.Model(&Membership{}).
+		Where("id = ? AND expiry_warned_at IS NULL AND expiry_warn_attempts = ?", membership.ID, membership.ExpiryWarnAttempts).
+		Update("expiry_warn_next_at", now.Add(helper.MailRetryDelay(membership.ExpiryWarnAttempts))).Error
+}
+
+// markWarned mencatat pengingat periode ini sudah terkirim
+func markWarned(db *gorm.DB, membershipID uint, now time.Time) error {
+	return db.Model(&Membership{}).Where("id = ? AND expiry_warned_at IS NULL", membershipID).
+		Updates(map[string]interface{}{"expiry_warned_at": now, "expiry_warn_next_at": nil}).Error
+}
@@ -0,0 +1,90 @@
+package memberships
+
+import "time"
+
+// MembershipPlan menentukan hak pinjam anggota: jumlah buku, lama pinjam, perpanjangan dan biaya
+type MembershipPlan struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name          string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description   string    `json:"description"`
+	MaxLoans      int       `json:"max_loans" gorm:"not null;default:3"`       // Maksimal buku dipinjam bersamaan
+	LoanDays      int       `json:"loan_days" gorm:"not null;default:7"`       // Lama peminjaman per buku
+	MaxRenewals   int       `json:"max_renewals" gorm:"not null;default:0"`    // Berapa kali satu peminjaman boleh diperpanjang
+	DurationDays  int       `json:"duration_days" gorm:"not null;default:365"` // Masa berlaku satu periode keanggotaan
+	Fee           int64     `json:"fee" gorm:"not null;default:0"`             // Biaya per periode (rupiah)
+	LateFeePerDay int64     `json:"late_fee_per_day" gorm:"not null;default:0"`
+	IsDefault     bool      `json:"is_default" gorm:"not null;default:false"` // Plan untuk user yang belum memiliki keanggotaan
+	Active        bool      `json:"active" gorm:"not null;default:true"`      // Plan nonaktif tidak bisa dipilih untuk upgrade
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (MembershipPlan) TableName() string {
+	return "membership_plans"
+}
+
+// Membership menghubungkan user dengan plan dan masa berlakunya. Satu user satu keanggotaan.
+type Membership struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	UserID         uint           `json:"user_id" gorm:"uniqueIndex;not null"`
+	PlanID         uint           `json:"plan_id" gorm:"index;not null"`
+	Plan           MembershipPlan `json:"plan" gorm:"foreignKey:PlanID"`
+	StartsAt       time.Time      `json:"starts_at"`
+	ExpiresAt      time.Time      `json:"expires_at" gorm:"index"`
+	ExpiryWarnedAt *time.Time     `json:"expiry_warned_at"` // Waktu email pengingat dikirim untuk periode ini
+	// Percobaan kirim pengingat periode ini dan waktu paling cepat untuk mencoba lagi,
+	// lihat helper.MailClaimLease
+	ExpiryWarnAttempts int        `json:"-" gorm:"not null;default:0"`
+	ExpiryWarnNextAt   *time.Time `json:"-"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func (Membership) TableName() string {
+	return "memberships"
+}
+
+// Expired mengecek apakah keanggotaan sudah berakhir pada waktu now
+func (m *Membership) Expired(now time.Time) bool {
+	return !now.Before(m.ExpiresAt)
+}
+
+// DTO untuk request Create Plan
+type CreatePlanRequest struct {
+	Name          string `json:"name" binding:"required,min=2,max=50"`
+	Description   string `json:"description" binding:"max=255"`
+	MaxLoans      int    `json:"max_loans" binding:"required,min=1,max=100"`
+	LoanDays      int    `json:"loan_days" binding:"required,min=1,max=365"`
+	MaxRenewals   int    `json:"max_renewals" binding:"min=0,max=20"`
+	DurationDays  int    `json:"duration_days" binding:"required,min=1,max=3650"`
+	Fee           int64  `json:"fee" binding:"min=0"`
+	LateFeePerDay int64  `json:"late_fee_per_day" binding:"min=0"`
+	IsDefault     bool   `json:"is_default"`
+}
+
+// DTO untuk request Update Plan. Field kosong tidak diubah.
+type UpdatePlanRequest struct {
+	Description   *string `json:"description" binding:"omitempty,max=255"`
+	MaxLoans      *int    `json:"max_loans" binding:"omitempty,min=1,max=100"`
+	LoanDays      *int    `json:"loan_days" binding:"omitempty,min=1,max=365"`
+	MaxRenewals   *int    `json:"max_renewals" binding:"omitempty,min=0,max=20"`
+	DurationDays  *int    `json:"duration_days" binding:"omitempty,min=1,max=3650"`
+	Fee           *int64  `json:"fee" binding:"omitempty,min=0"`
+	LateFeePerDay *int64  `json:"late_fee_per_day" binding:"omitempty,min=0"`
+	IsDefault     *bool   `json:"is_default"`
+	Active        *bool   `json:"active"`
+}
+
+// DTO untuk perpanjangan keanggotaan
+type RenewMembershipRequest struct {
+	Periods    int    `json:"periods" binding:"omitempty,min=1,max=10"` // Jumlah periode, default 1
+	AmountPaid int64  `json:"amount_paid" binding:"min=0"`              // Pembayaran yang diterima staf, minimal Fee x periode
+	Reason     string `json:"reason" binding:"max=255"`
+}
+
+// DTO untuk upgrade/downgrade plan keanggotaan
+type ChangePlanRequest struct {
+	PlanID     uint   `json:"plan_id" binding:"required"`
+	AmountPaid int64  `json:"amount_paid" binding:"min=0"` // Pembayaran yang diterima staf, minimal Fee plan baru
+	Reason     string `json:"reason" binding:"max=255"`
+}
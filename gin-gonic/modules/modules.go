@@ -2,8 +2,14 @@ package modules
 
 import (
 	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/apikeys"
 	"gin-gonic/modules/books"
+	"gin-gonic/modules/kiosks"
 	"gin-gonic/modules/loans"
+	"gin-gonic/modules/memberships"
+	"gin-gonic/modules/privacy"
+	"gin-gonic/modules/roles"
 	"gin-gonic/modules/users"
 
 	"github.com/gin-gonic/gin"
@@ -34,12 +40,34 @@ func NewVersion(config helper.Config, router *gin.Engine, db *gorm.DB, nc *nats.
 func (s *versions) Run() {
 	apiRoutes := s.mainServer.Group("/")
 
+	// Status user terbaru dipakai untuk mencabut token (logout, hapus user, ganti role)
+	middlewares.SetSessionStore(users.NewSessionStore(s.db))
+
+	// Role dan permission harus ada sebelum user dimigrasikan ke user_roles
+	roleServer := roles.NewRoleServer(apiRoutes, s.db, s.version)
+	roleServer.Init()
+
 	userServer := users.NewUserServer(apiRoutes, s.db, s.version)
 	userServer.Init()
 
+	apiKeyServer := apikeys.NewAPIKeyServer(apiRoutes, s.db, s.version)
+	apiKeyServer.Init()
+
 	bookServer := books.NewBookServer(apiRoutes, s.db, s.version)
 	bookServer.Init()
 
+	// Plan keanggotaan dipakai loans untuk batas pinjam
+	membershipServer := memberships.NewMembershipServer(apiRoutes, s.db, s.version)
+	membershipServer.Init()
+
 	loanServer := loans.NewLoanServer(apiRoutes, s.db, s.nc, s.version)
 	loanServer.Init()
+
+	// Perangkat self-checkout memakai layanan pinjam/kembali dari loans
+	kioskServer := kiosks.NewKioskServer(apiRoutes, s.db, s.nc, s.version)
+	kioskServer.Init()
+
+	// Export data dan hapus akun membutuhkan data dari users, loans dan apikeys
+	privacyServer := privacy.NewPrivacyServer(apiRoutes, s.db, s.version)
+	privacyServer.Init()
 }
@@ -0,0 +1,125 @@
+package privacy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrivacyController interface {
+	Export(ctx *gin.Context)
+	RequestDeletion(ctx *gin.Context)
+	CancelDeletion(ctx *gin.Context)
+	ConfirmDeletion(ctx *gin.Context)
+	GetDeletionRequests(ctx *gin.Context)
+}
+
+type privacyController struct {
+	service PrivacyService
+}
+
+func NewPrivacyController(service PrivacyService) PrivacyController {
+	return &privacyController{service: service}
+}
+
+func (c *privacyController) Export(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	data, err := c.service.Export(principal.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat export data: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("data-export-%d-%s.zip", principal.UserID, time.Now().Format("20060102"))
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "application/zip", data)
+}
+
+func (c *privacyController) RequestDeletion(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input DeletionRequestInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	err := c.service.RequestDeletion(principal.UserID, &input)
+	if errors.Is(err, ErrOpenLoans) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Link konfirmasi hapus akun telah dikirim ke email Anda"})
+}
+
+func (c *privacyController) CancelDeletion(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := c.service.CancelDeletion(principal.UserID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Permintaan hapus akun dibatalkan"})
+}
+
+func (c *privacyController) ConfirmDeletion(ctx *gin.Context) {
+	var input ConfirmDeletionRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	err := c.service.ConfirmDeletion(&input)
+	if errors.Is(err, ErrOpenLoans) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Akun Anda telah dihapus"})
+}
+
+func (c *privacyController) GetDeletionRequests(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+
+	requests, total, err := c.service.GetDeletionRequests(page, limit, ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":      requests,
+		"total_row": total,
+	})
+}
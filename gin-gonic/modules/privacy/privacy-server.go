@@ -0,0 +1,57 @@
+package privacy
+
+import (
+	"log"
+
+	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PrivacyServer struct {
+	router  *gin.RouterGroup
+	db      *gorm.DB
+	version string
+}
+
+func NewPrivacyServer(router *gin.RouterGroup, db *gorm.DB, version string) *PrivacyServer {
+	return &PrivacyServer{router: router, db: db, version: version}
+}
+
+func (s *PrivacyServer) Init() {
+	config, err := helper.LoadConfig(".")
+	if err != nil {
+		log.Fatal("Cannot load config:", err)
+	}
+
+	if config.AUTO_MIGRATE == "Y" {
+		if err := s.db.AutoMigrate(&DeletionRequest{}); err != nil {
+			log.Printf("Failed to auto migrate DeletionRequest: %v", err)
+		}
+	}
+
+	mailer, err := helper.NewMailer(config)
+	if err != nil {
+		log.Fatal("Cannot create mailer:", err)
+	}
+	service := NewPrivacyService(s.db, mailer, config)
+	controller := NewPrivacyController(service)
+
+	router := middlewares.NewRouter(s.router)
+	// Export dan hapus akun hanya oleh user itu sendiri, bukan admin yang impersonate
+	selfOnly := middlewares.Authenticated().WithoutImpersonation()
+
+	userRoutes := router.Group("/" + s.version + "/users")
+	userRoutes.GET("/me/export", selfOnly, controller.Export)
+	userRoutes.POST("/me/deletion", selfOnly, controller.RequestDeletion)
+	userRoutes.DELETE("/me/deletion", selfOnly, controller.CancelDeletion)
+
+	auth := router.Group("/" + s.version + "/auth")
+	auth.POST("/confirm-deletion", middlewares.Public(), controller.ConfirmDeletion)
+
+	admin := router.Group("/" + s.version + "/admin")
+	admin.GET("/deletion-requests", middlewares.RequirePermission(roles.PermUsersRead), controller.GetDeletionRequests)
+}
@@ -0,0 +1,345 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/modules/apikeys"
+	"gin-gonic/modules/loans"
+	"gin-gonic/modules/users"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+// DeletionConfirmTTL adalah masa berlaku link konfirmasi hapus akun
+var DeletionConfirmTTL = 24 * time.Hour
+
+var (
+	// ErrOpenLoans dikembalikan jika user masih meminjam buku
+	ErrOpenLoans = errors.New("akun tidak dapat dihapus selama masih ada buku yang belum dikembalikan")
+
+	errInvalidDeletionToken = errors.New("invalid or expired deletion token")
+)
+
+type PrivacyService interface {
+	Export(userID uint) ([]byte, error)
+	RequestDeletion(userID uint, input *DeletionRequestInput) error
+	CancelDeletion(userID uint) error
+	ConfirmDeletion(input *ConfirmDeletionRequest) error
+	GetDeletionRequests(page, limit int, status string) ([]DeletionRequest, int64, error)
+}
+
+type privacyService struct {
+	db     *gorm.DB
+	mailer helper.Mailer
+	config helper.Config
+}
+
+func NewPrivacyService(db *gorm.DB, mailer helper.Mailer, config helper.Config) PrivacyService {
+	return &privacyService{db: db, mailer: mailer, config: config}
+}
+
+// Export membuat file ZIP berisi semua data pribadi user dalam format JSON:
+// profile.json, loans.json, loan_logs.json, notifications.json dan activity.json
+func (s *privacyService) Export(userID uint) ([]byte, error) {
+	var user users.User
+	if err := s.db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+
+	loanData, err := s.exportLoans(userID)
+	if err != nil {
+		return nil, err
+	}
+	loanLogs, err := s.exportLoanLogs(userID)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := s.exportNotifications(userID)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := s.exportActivity(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"loans.json", loanData},
+		{"loan_logs.json", loanLogs},
+		{"notifications.json", notifications},
+		{"activity.json", activity},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *privacyService) exportLoans(userID uint) ([]LoanExport, error) {
+	var loanData []loans.Loan
+	// Buku yang sudah dihapus tetap ditampilkan judulnya
+	if err := s.db.Preload("Book", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("user_id = ?", userID).Order("loan_date").Find(&loanData).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]LoanExport, 0, len(loanData))
+	for _, loan := range loanData {
+		result = append(result, LoanExport{
+			ID:         loan.ID,
+			BookID:     loan.BookID,
+			BookTitle:  loan.Book.Title,
+			BookAuthor: loan.Book.Author,
+			LoanDate:   loan.LoanDate,
+			ReturnDate: loan.ReturnDate,
+			ReturnedAt: loan.ReturnedAt,
+			Status:     loan.Status,
+			CreatedAt:  loan.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// exportLoanLogs mengambil log pinjam/kembali user. Kosong jika nats-subscriber belum pernah membuat tabelnya.
+func (s *privacyService) exportLoanLogs(userID uint) ([]LoanLogExport, error) {
+	logs := make([]LoanLogExport, 0)
+	if !s.db.Migrator().HasTable(&LoanLogExport{}) {
+		return logs, nil
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// exportNotifications mengumpulkan email yang pernah dikirim ke user. Isi email tidak disimpan,
+// yang tersedia hanya jenis dan waktunya.
+func (s *privacyService) exportNotifications(userID uint) ([]NotificationExport, error) {
+	result := make([]NotificationExport, 0)
+
+	var verifications []users.EmailVerificationToken
+	if err := s.db.Where("user_id = ?", userID).Find(&verifications).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range verifications {
+		result = append(result, NotificationExport{Type: "email_verification", SentAt: t.CreatedAt, ExpiresAt: t.ExpiresAt, UsedAt: t.UsedAt})
+	}
+
+	var resets []users.PasswordResetToken
+	if err := s.db.Where("user_id = ?", userID).Find(&resets).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range resets {
+		result = append(result, NotificationExport{Type: "password_reset", SentAt: t.CreatedAt, ExpiresAt: t.ExpiresAt, UsedAt: t.UsedAt})
+	}
+
+	var deletions []DeletionRequest
+	if err := s.db.Where("user_id = ?", userID).Find(&deletions).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range deletions {
+		result = append(result, NotificationExport{Type: "account_deletion", SentAt: d.CreatedAt, ExpiresAt: d.ExpiresAt, UsedAt: d.CompletedAt})
+	}
+	return result, nil
+}
+
+func (s *privacyService) exportActivity(user *users.User) (map[string]interface{}, error) {
+	var logins []users.LoginEvent
+	if err := s.db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&logins).Error; err != nil {
+		return nil, err
+	}
+	var adminActions []users.UserAuditLog
+	if err := s.db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&adminActions).Error; err != nil {
+		return nil, err
+	}
+	var identities []users.UserIdentity
+	if err := s.db.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	var keys []apikeys.APIKey
+	if err := s.db.Where("user_id = ?", user.ID).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	var recoveryCodes int64
+	if err := s.db.Model(&users.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&recoveryCodes).Error; err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"logins":          logins,
+		"admin_actions":   adminActions,
+		"linked_accounts": identities,
+		"api_keys":        keys,
+		"two_factor": map[string]interface{}{
+			"enabled":                  user.TOTPEnabled,
+			"recovery_codes_remaining": recoveryCodes,
+		},
+	}, nil
+}
+
+// RequestDeletion memulai proses hapus akun: password dicek, lalu link konfirmasi dikirim ke email.
+// Ditolak jika user masih meminjam buku.
+func (s *privacyService) RequestDeletion(userID uint, input *DeletionRequestInput) error {
+	var user users.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return errors.New("data tidak ditemukan")
+	}
+	if !utils.CheckPassword(input.Password, user.Password) {
+		return errors.New("password is incorrect")
+	}
+
+	open, err := loans.HasOpenLoans(s.db, userID)
+	if err != nil {
+		return err
+	}
+	if open {
+		return ErrOpenLoans
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Hanya permintaan terakhir yang berlaku
+		if err := tx.Model(&DeletionRequest{}).Where("user_id = ? AND status = ?", userID, DeletionPending).
+			Updates(map[string]interface{}{"status": DeletionCancelled, "cancelled_at": now}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&DeletionRequest{
+			UserID:    userID,
+			TokenHash: utils.HashToken(token),
+			Status:    DeletionPending,
+			ExpiresAt: now.Add(DeletionConfirmTTL),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := token
+	if s.config.AccountDeletionURL != "" {
+		link = s.config.AccountDeletionURL + "?token=" + token
+	}
+	return s.mailer.Send(helper.Mail{
+		To:      user.Email,
+		Subject: "Konfirmasi hapus akun",
+		Body: fmt.Sprintf("Halo %s,\n\nKami menerima permintaan untuk menghapus akun Anda. "+
+			"Gunakan link berikut untuk mengonfirmasi:\n%s\n\n"+
+			"Setelah dikonfirmasi, data pribadi Anda dihapus dan tidak dapat dikembalikan. "+
+			"Link berlaku selama %s.\nAbaikan email ini jika Anda tidak meminta penghapusan akun.\n",
+			user.Name, link, DeletionConfirmTTL),
+	})
+}
+
+// CancelDeletion membatalkan permintaan hapus akun yang belum dikonfirmasi
+func (s *privacyService) CancelDeletion(userID uint) error {
+	result := s.db.Model(&DeletionRequest{}).Where("user_id = ? AND status = ?", userID, DeletionPending).
+		Updates(map[string]interface{}{"status": DeletionCancelled, "cancelled_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("tidak ada permintaan hapus akun yang aktif")
+	}
+	return nil
+}
+
+// ConfirmDeletion menganonimkan akun. Loan tetap disimpan dengan user_id yang sama
+// sehingga statistik peminjaman tidak berubah, sedangkan loan_logs milik user dihapus.
+func (s *privacyService) ConfirmDeletion(input *ConfirmDeletionRequest) error {
+	var request DeletionRequest
+	if err := s.db.Where("token_hash = ?", utils.HashToken(input.Token)).First(&request).Error; err != nil {
+		return errInvalidDeletionToken
+	}
+	now := time.Now()
+	if request.Status != DeletionPending || now.After(request.ExpiresAt) {
+		return errInvalidDeletionToken
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Dicek ulang: user bisa meminjam buku setelah permintaan dibuat
+		open, err := loans.HasOpenLoans(tx, request.UserID)
+		if err != nil {
+			return err
+		}
+		if open {
+			return ErrOpenLoans
+		}
+
+		// Kondisi status pending mencegah token dipakai dua kali secara bersamaan
+		result := tx.Model(&DeletionRequest{}).Where("id = ? AND status = ?", request.ID, DeletionPending).
+			Updates(map[string]interface{}{"status": DeletionCompleted, "completed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidDeletionToken
+		}
+
+		if err := users.Anonymize(tx, request.UserID, now); err != nil {
+			return err
+		}
+		if tx.Migrator().HasTable(&LoanLogExport{}) {
+			if err := tx.Where("user_id = ?", request.UserID).Delete(&LoanLogExport{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ?", request.UserID).Delete(&apikeys.APIKey{}).Error
+	})
+}
+
+// GetDeletionRequests mengembalikan daftar permintaan hapus akun untuk admin
+func (s *privacyService) GetDeletionRequests(page, limit int, status string) ([]DeletionRequest, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := s.db.Model(&DeletionRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var requests []DeletionRequest
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, total, nil
+}
@@ -0,0 +1,73 @@
+package privacy
+
+import "time"
+
+// Status permintaan hapus akun
+const (
+	DeletionPending   = "pending"
+	DeletionCancelled = "cancelled"
+	DeletionCompleted = "completed"
+)
+
+// DeletionRequest adalah permintaan hapus akun. Akun baru dianonimkan setelah
+// user mengonfirmasi lewat link di email. Tidak menyimpan data pribadi.
+type DeletionRequest struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex;not null"`
+	Status      string     `json:"status" gorm:"index;not null;default:pending"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CancelledAt *time.Time `json:"cancelled_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (DeletionRequest) TableName() string {
+	return "deletion_requests"
+}
+
+// DTO untuk request hapus akun, password wajib untuk konfirmasi
+type DeletionRequestInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// DTO untuk konfirmasi hapus akun dari link email
+type ConfirmDeletionRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// LoanExport adalah data loan di file export, dengan judul buku
+type LoanExport struct {
+	ID         uint       `json:"id"`
+	BookID     uint       `json:"book_id"`
+	BookTitle  string     `json:"book_title"`
+	BookAuthor string     `json:"book_author"`
+	LoanDate   time.Time  `json:"loan_date"`
+	ReturnDate time.Time  `json:"return_date"`
+	ReturnedAt *time.Time `json:"returned_at"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// LoanLogExport adalah baris loan_logs yang ditulis nats-subscriber saat pinjam/kembali buku.
+// Tabelnya dimigrasi oleh nats-subscriber, di sini hanya dibaca dan dihapus.
+type LoanLogExport struct {
+	ID        uint      `json:"id"`
+	LoanID    uint      `json:"loan_id"`
+	BookID    uint      `json:"book_id"`
+	UserID    uint      `json:"user_id"`
+	Action    string    `json:"action"` // BORROW atau RETURN
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (LoanLogExport) TableName() string {
+	return "loan_logs"
+}
+
+// NotificationExport adalah email yang pernah dikirim ke user
+type NotificationExport struct {
+	Type      string     `json:"type"` // email_verification, password_reset, account_deletion
+	SentAt    time.Time  `json:"sent_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
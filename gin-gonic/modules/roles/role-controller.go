@@ -0,0 +1,89 @@
+package roles
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController interface {
+	GetList(ctx *gin.Context)
+	GetByID(ctx *gin.Context)
+	Create(ctx *gin.Context)
+	Update(ctx *gin.Context)
+	Delete(ctx *gin.Context)
+	GetPermissions(ctx *gin.Context)
+}
+
+type roleController struct {
+	service RoleService
+}
+
+func NewRoleController(service RoleService) RoleController {
+	return &roleController{service: service}
+}
+
+func (c *roleController) GetList(ctx *gin.Context) {
+	rolesData, err := c.service.GetList()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": rolesData})
+}
+
+func (c *roleController) GetByID(ctx *gin.Context) {
+	role, err := c.service.GetByID(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, role)
+}
+
+func (c *roleController) Create(ctx *gin.Context) {
+	var input CreateRoleRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	role, err := c.service.Create(&input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, role)
+}
+
+func (c *roleController) Update(ctx *gin.Context) {
+	var input UpdateRoleRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	role, err := c.service.Update(ctx.Param("id"), &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal memperbarui data: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, role)
+}
+
+func (c *roleController) Delete(ctx *gin.Context) {
+	if err := c.service.Delete(ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal menghapus data: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Data berhasil dihapus"})
+}
+
+func (c *roleController) GetPermissions(ctx *gin.Context) {
+	perms, err := c.service.GetPermissions()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": perms})
+}
@@ -0,0 +1,59 @@
+package roles
+
+import (
+	"log"
+
+	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleServer struct {
+	router  *gin.RouterGroup
+	db      *gorm.DB
+	version string
+}
+
+func NewRoleServer(router *gin.RouterGroup, db *gorm.DB, version string) *RoleServer {
+	return &RoleServer{router: router, db: db, version: version}
+}
+
+func (s *RoleServer) Init() {
+	config, err := helper.LoadConfig(".")
+	if err != nil {
+		log.Fatal("Cannot load config:", err)
+	}
+
+	// Tabel relasi memakai model eksplisit agar nama tabel tidak diberi prefix schema
+	if err := s.db.SetupJoinTable(&Role{}, "Permissions", &RolePermission{}); err != nil {
+		log.Fatal("Failed to setup role_permissions join table:", err)
+	}
+
+	if config.AUTO_MIGRATE == "Y" {
+		if err := s.db.AutoMigrate(&Permission{}, &Role{}, &RolePermission{}, &DefaultPermissionGrant{}); err != nil {
+			log.Printf("Failed to auto migrate Role: %v", err)
+		}
+	}
+
+	service := NewRoleService(s.db)
+	controller := NewRoleController(service)
+
+	if err := service.SeedDefaults(); err != nil {
+		log.Printf("Failed to seed default roles: %v", err)
+	}
+
+	router := middlewares.NewRouter(s.router)
+	canRead := middlewares.RequirePermission(PermRolesRead)
+	canManage := middlewares.RequirePermission(PermRolesManage)
+
+	adminRoles := router.Group("/" + s.version + "/admin/roles")
+	adminRoles.GET("", canRead, controller.GetList)
+	adminRoles.GET("/:id", canRead, controller.GetByID)
+	adminRoles.POST("", canManage, controller.Create)
+	adminRoles.PUT("/:id", canManage, controller.Update)
+	adminRoles.DELETE("/:id", canManage, controller.Delete)
+
+	router.GET("/"+s.version+"/admin/permissions", canRead, controller.GetPermissions)
+}
@@ -0,0 +1,279 @@
+package roles
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// defaultPermissions adalah semua permission yang dikenal aplikasi
+var defaultPermissions = []Permission{
+	{Code: PermBooksWrite, Description: "Menambah, mengubah dan menghapus buku"},
+	{Code: PermLoansRead, Description: "Melihat semua peminjaman"},
+	{Code: PermLoansCheckout, Description: "Memproses peminjaman dan pengembalian buku milik user lain"},
+	{Code: PermLoansOverride, Description: "Mengizinkan peminjaman buku yang dibatasi umur (tercatat di audit log)"},
+	{Code: PermUsersRead, Description: "Melihat data user"},
+	{Code: PermUsersWrite, Description: "Mengubah dan menghapus user"},
+	{Code: PermStatsRead, Description: "Melihat statistik"},
+	{Code: PermRolesRead, Description: "Melihat role dan permission"},
+	{Code: PermRolesManage, Description: "Mengelola role dan menetapkan role ke user"},
+	{Code: PermAPIKeysManage, Description: "Membuat, melihat dan mencabut API key"},
+	{Code: PermUsersImpersonate, Description: "Login sebagai user lain untuk keperluan support (tercatat di audit log)"},
+	{Code: PermMembershipsManage, Description: "Mengelola plan keanggotaan, perpanjangan dan upgrade anggota"},
+	{Code: PermKiosksManage, Description: "Mendaftarkan dan mencabut perangkat kiosk serta melihat log aktivitasnya"},
+}
+
+type defaultRole struct {
+	Description string
+	Permissions []string
+}
+
+// defaultRoles adalah role bawaan. Permission admin selalu disinkronkan ke semua permission,
+// role lain hanya diisi saat pertama kali dibuat agar perubahan dari admin tidak tertimpa.
+// Permission baru untuk role yang sudah ada didaftarkan juga di addedDefaultPermissions.
+var defaultRoles = map[string]defaultRole{
+	RoleAdmin: {Description: "Administrator dengan akses penuh"},
+	RoleLibrarian: {
+		Description: "Pustakawan: mengelola buku dan sirkulasi, tanpa akses manajemen user",
+		Permissions: []string{PermBooksWrite, PermLoansRead, PermLoansCheckout, PermStatsRead, PermMembershipsManage},
+	},
+	RoleAuditor: {
+		Description: "Auditor: akses baca saja",
+		Permissions: []string{PermLoansRead, PermUsersRead, PermStatsRead, PermRolesRead},
+	},
+	RoleUser: {Description: "Anggota perpustakaan"},
+}
+
+// addedDefaultPermissions adalah permission yang ditambahkan ke defaultRoles setelah role-nya
+// mungkin sudah dibuat. SeedDefaults memberikannya satu kali ke role yang sudah ada dan mencatatnya
+// di default_permission_grants, sehingga permission yang kemudian dicabut admin tidak diberikan lagi.
+// Tambahkan entri di sini setiap kali defaultRoles mendapat permission baru.
+var addedDefaultPermissions = []struct {
+	Role       string
+	Permission string
+}{
+	{RoleLibrarian, PermMembershipsManage},
+}
+
+type RoleService interface {
+	SeedDefaults() error
+	GetList() ([]Role, error)
+	GetByID(id string) (*Role, error)
+	Create(input *CreateRoleRequest) (*Role, error)
+	Update(id string, input *UpdateRoleRequest) (*Role, error)
+	Delete(id string) error
+	GetPermissions() ([]Permission, error)
+}
+
+type roleService struct {
+	db *gorm.DB
+}
+
+func NewRoleService(db *gorm.DB) RoleService {
+	return &roleService{db: db}
+}
+
+// SeedDefaults membuat permission dan role bawaan jika belum ada
+func (s *roleService) SeedDefaults() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var all []Permission
+		for _, p := range defaultPermissions {
+			perm := Permission{}
+			if err := tx.Where(Permission{Code: p.Code}).Attrs(Permission{Description: p.Description}).
+				FirstOrCreate(&perm).Error; err != nil {
+				return err
+			}
+			all = append(all, perm)
+		}
+
+		for name, def := range defaultRoles {
+			var role Role
+			result := tx.Where(Role{Name: name}).Attrs(Role{Description: def.Description, System: true}).
+				FirstOrCreate(&role)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			switch {
+			case name == RoleAdmin:
+				if err := tx.Model(&role).Association("Permissions").Replace(all); err != nil {
+					return err
+				}
+			case result.RowsAffected > 0 && len(def.Permissions) > 0:
+				perms, err := findPermissions(tx, def.Permissions)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&role).Association("Permissions").Replace(perms); err != nil {
+					return err
+				}
+			}
+		}
+
+		return grantAddedPermissions(tx)
+	})
+}
+
+// grantAddedPermissions memberikan addedDefaultPermissions yang belum pernah diberikan.
+// Role yang baru dibuat sudah mendapatkannya dari defaultRoles, grant tetap dicatat.
+func grantAddedPermissions(tx *gorm.DB) error {
+	for _, added := range addedDefaultPermissions {
+		grant := DefaultPermissionGrant{Role: added.Role, Permission: added.Permission}
+		result := tx.Where(grant).FirstOrCreate(&grant)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		var role Role
+		if err := tx.Where("name = ?", added.Role).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		perms, err := findPermissions(tx, []string{added.Permission})
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Append(perms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findPermissions mengambil permission berdasarkan kode dan menolak kode yang tidak dikenal
+func findPermissions(db *gorm.DB, codes []string) ([]Permission, error) {
+	perms := []Permission{}
+	if len(codes) == 0 {
+		return perms, nil
+	}
+	if err := db.Where("code IN ?", codes).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		found[p.Code] = true
+	}
+	for _, code := range codes {
+		if !found[code] {
+			return nil, fmt.Errorf("unknown permission %q", code)
+		}
+	}
+	return perms, nil
+}
+
+func (s *roleService) GetList() ([]Role, error) {
+	var rolesData []Role
+	if err := s.db.Preload("Permissions").Order("id ASC").Find(&rolesData).Error; err != nil {
+		return nil, err
+	}
+	return rolesData, nil
+}
+
+func (s *roleService) GetByID(id string) (*Role, error) {
+	var role Role
+	if err := s.db.Preload("Permissions").Where("id = ?", id).First(&role).Error; err != nil {
+		return nil, errors.New("role not found")
+	}
+	return &role, nil
+}
+
+func (s *roleService) Create(input *CreateRoleRequest) (*Role, error) {
+	name := strings.ToLower(strings.TrimSpace(input.Name))
+
+	var existing Role
+	if err := s.db.Where("name = ?", name).First(&existing).Error; err == nil {
+		return nil, errors.New("role already exists")
+	}
+
+	perms, err := findPermissions(s.db, input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &Role{
+		Name:        name,
+		Description: input.Description,
+		Permissions: perms,
+	}
+	if err := s.db.Create(role).Error; err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (s *roleService) Update(id string, input *UpdateRoleRequest) (*Role, error) {
+	role, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == RoleAdmin && input.Permissions != nil {
+		return nil, errors.New("permissions of the admin role cannot be changed")
+	}
+
+	if input.Description != "" {
+		role.Description = input.Description
+		if err := s.db.Model(role).Update("description", input.Description).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Permissions nil berarti tidak diubah, slice kosong berarti dikosongkan
+	if input.Permissions != nil {
+		perms, err := findPermissions(s.db, input.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.db.Model(role).Association("Permissions").Replace(perms); err != nil {
+			return nil, err
+		}
+		role.Permissions = perms
+	}
+
+	return role, nil
+}
+
+func (s *roleService) Delete(id string) error {
+	role, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if role.System {
+		return errors.New("system role cannot be deleted")
+	}
+
+	var assigned int64
+	if err := s.db.Model(&UserRole{}).Where("role_id = ?", role.ID).Count(&assigned).Error; err != nil {
+		return err
+	}
+	if assigned > 0 {
+		return fmt.Errorf("role is still assigned to %d user(s)", assigned)
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(role).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (s *roleService) GetPermissions() ([]Permission, error) {
+	var perms []Permission
+	if err := s.db.Order("code ASC").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
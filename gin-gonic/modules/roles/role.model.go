@@ -0,0 +1,98 @@
+package roles
+
+import "time"
+
+// Kode permission bawaan. Format "resource:aksi".
+const (
+	PermBooksWrite        = "books:write"
+	PermLoansRead         = "loans:read"
+	PermLoansCheckout     = "loans:checkout"
+	PermLoansOverride     = "loans:override"
+	PermUsersRead         = "users:read"
+	PermUsersWrite        = "users:write"
+	PermUsersImpersonate  = "users:impersonate"
+	PermStatsRead         = "stats:read"
+	PermRolesRead         = "roles:read"
+	PermRolesManage       = "roles:manage"
+	PermAPIKeysManage     = "apikeys:manage"
+	PermMembershipsManage = "memberships:manage"
+	PermKiosksManage      = "kiosks:manage"
+)
+
+// Nama role bawaan
+const (
+	RoleAdmin     = "admin"
+	RoleLibrarian = "librarian"
+	RoleAuditor   = "auditor"
+	RoleUser      = "user"
+)
+
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null"`
+	Description string       `json:"description"`
+	System      bool         `json:"system" gorm:"default:false"` // Role bawaan tidak bisa dihapus
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Code        string `json:"code" gorm:"uniqueIndex;not null"`
+	Description string `json:"description"`
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+// RolePermission adalah tabel relasi many-to-many Role <-> Permission
+type RolePermission struct {
+	RoleID       uint `gorm:"primaryKey"`
+	PermissionID uint `gorm:"primaryKey"`
+}
+
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// DefaultPermissionGrant mencatat permission bawaan yang sudah diberikan ke role yang sudah ada
+// (lihat addedDefaultPermissions), sehingga setiap grant hanya dijalankan satu kali
+type DefaultPermissionGrant struct {
+	ID         uint   `gorm:"primaryKey"`
+	Role       string `gorm:"uniqueIndex:idx_default_grant;not null"`
+	Permission string `gorm:"uniqueIndex:idx_default_grant;not null"`
+	CreatedAt  time.Time
+}
+
+func (DefaultPermissionGrant) TableName() string {
+	return "default_permission_grants"
+}
+
+// UserRole adalah tabel relasi many-to-many User <-> Role
+type UserRole struct {
+	UserID uint `gorm:"primaryKey"`
+	RoleID uint `gorm:"primaryKey"`
+}
+
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// DTO untuk request Create Role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=2,max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// DTO untuk request Update Role
+type UpdateRoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
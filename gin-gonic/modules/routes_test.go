@@ -0,0 +1,200 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gin-gonic/dashboard"
+	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// expectedPolicies adalah policy setiap route API. Route baru wajib ditambahkan di sini
+// agar perubahan akses selalu terlihat saat review.
+var expectedPolicies = map[string]string{
+	"GET /admin/dashboard":                                  "public",
+	"GET /admin/dashboard/assets/*filepath":                 "public",
+	"HEAD /admin/dashboard/assets/*filepath":                "public",
+	"GET /api/v1/admin/api-keys":                            "permission:apikeys:manage|no-impersonation",
+	"POST /api/v1/admin/api-keys":                           "permission:apikeys:manage|no-impersonation",
+	"DELETE /api/v1/admin/api-keys/:id":                     "permission:apikeys:manage|no-impersonation",
+	"POST /api/v1/admin/books":                              "permission:books:write",
+	"DELETE /api/v1/admin/books/:id":                        "permission:books:write",
+	"PUT /api/v1/admin/books/:id":                           "permission:books:write",
+	"GET /api/v1/admin/books/:id/conditions":                "permission:loans:read",
+	"PATCH /api/v1/admin/books/:id/image":                   "permission:books:write",
+	"DELETE /api/v1/admin/books/bulk-delete":                "permission:books:write",
+	"GET /api/v1/admin/books/stats":                         "permission:stats:read",
+	"GET /api/v1/admin/deletion-requests":                   "permission:users:read",
+	"POST /api/v1/admin/desk/checkout":                      "permission:loans:checkout",
+	"POST /api/v1/admin/desk/return":                        "permission:loans:checkout",
+	"GET /api/v1/admin/fines":                               "permission:loans:read",
+	"POST /api/v1/admin/fines/:id/settle":                   "permission:loans:checkout",
+	"GET /api/v1/admin/kiosks":                              "permission:kiosks:manage|no-impersonation",
+	"POST /api/v1/admin/kiosks":                             "permission:kiosks:manage|no-impersonation",
+	"DELETE /api/v1/admin/kiosks/:id":                       "permission:kiosks:manage|no-impersonation",
+	"GET /api/v1/admin/kiosks/:id/activity":                 "permission:kiosks:manage|no-impersonation",
+	"GET /api/v1/admin/loans":                               "permission:loans:read",
+	"POST /api/v1/admin/loans/:id/checkin":                  "permission:loans:checkout",
+	"POST /api/v1/admin/loans/:id/claimed-returned":         "permission:loans:checkout",
+	"POST /api/v1/admin/loans/:id/condition/photos":         "permission:loans:checkout",
+	"POST /api/v1/admin/loans/:id/damaged":                  "permission:loans:checkout",
+	"GET /api/v1/admin/loans/:id/history":                   "permission:loans:read",
+	"POST /api/v1/admin/loans/:id/lost":                     "permission:loans:checkout",
+	"POST /api/v1/admin/loans/age-overrides":                "permission:loans:override",
+	"GET /api/v1/admin/membership-plans":                    "permission:memberships:manage",
+	"POST /api/v1/admin/membership-plans":                   "permission:memberships:manage",
+	"PUT /api/v1/admin/membership-plans/:id":                "permission:memberships:manage",
+	"GET /api/v1/admin/permissions":                         "permission:roles:read",
+	"GET /api/v1/admin/reports/damage":                      "permission:loans:read",
+	"GET /api/v1/admin/roles":                               "permission:roles:read",
+	"POST /api/v1/admin/roles":                              "permission:roles:manage",
+	"DELETE /api/v1/admin/roles/:id":                        "permission:roles:manage",
+	"GET /api/v1/admin/roles/:id":                           "permission:roles:read",
+	"PUT /api/v1/admin/roles/:id":                           "permission:roles:manage",
+	"DELETE /api/v1/admin/users/:id":                        "permission:users:write",
+	"GET /api/v1/admin/users/:id":                           "permission:users:read",
+	"POST /api/v1/admin/users/:id/card":                     "permission:users:write",
+	"POST /api/v1/admin/users/:id/impersonate":              "permission:users:impersonate|no-impersonation",
+	"GET /api/v1/admin/users/:id/logins":                    "permission:users:read",
+	"POST /api/v1/admin/users/:id/logout":                   "permission:users:write",
+	"GET /api/v1/admin/users/:id/membership":                "permission:memberships:manage",
+	"PUT /api/v1/admin/users/:id/membership/plan":           "permission:memberships:manage",
+	"POST /api/v1/admin/users/:id/membership/renew":         "permission:memberships:manage",
+	"POST /api/v1/admin/users/:id/reactivate":               "permission:users:write",
+	"PUT /api/v1/admin/users/:id/roles":                     "permission:roles:manage",
+	"POST /api/v1/admin/users/:id/suspend":                  "permission:users:write",
+	"POST /api/v1/admin/users/:id/unlock":                   "permission:users:write",
+	"GET /api/v1/admin/users/all":                           "permission:users:read",
+	"GET /api/v1/admin/users/audit":                         "permission:users:read",
+	"GET /api/v1/admin/users/by-card/:number":               "permission:users:read|loans:checkout",
+	"GET /api/v1/admin/users/logins":                        "permission:users:read",
+	"GET /api/v1/admin/users/search":                        "permission:users:read",
+	"GET /api/v1/admin/users/stats":                         "permission:stats:read",
+	"GET /api/v1/admin/users/users":                         "permission:users:read",
+	"POST /api/v1/auth/2fa":                                 "public",
+	"POST /api/v1/auth/2fa/setup":                           "public",
+	"POST /api/v1/auth/confirm-deletion":                    "public",
+	"POST /api/v1/auth/forgot-password":                     "public",
+	"POST /api/v1/auth/login":                               "public",
+	"POST /api/v1/auth/logout":                              "authenticated|no-impersonation",
+	"GET /api/v1/auth/oidc/callback":                        "public",
+	"GET /api/v1/auth/oidc/login":                           "public",
+	"GET /api/v1/auth/oidc/providers":                       "public",
+	"POST /api/v1/auth/refresh":                             "public",
+	"POST /api/v1/auth/register":                            "public",
+	"POST /api/v1/auth/resend-verification":                 "public",
+	"POST /api/v1/auth/reset-password":                      "public",
+	"GET /api/v1/auth/verify":                               "public",
+	"GET /api/v1/books":                                     "public",
+	"GET /api/v1/books/:id":                                 "public",
+	"GET /api/v1/books/:id/availability":                    "public",
+	"GET /api/v1/books/all":                                 "public",
+	"GET /api/v1/books/search":                              "public",
+	"POST /api/v1/kiosk/checkin":                            "authenticated|scope:kiosk",
+	"POST /api/v1/kiosk/checkout":                           "authenticated|scope:kiosk",
+	"POST /api/v1/kiosk/session":                            "public",
+	"POST /api/v1/loans/":                                   "authenticated",
+	"GET /api/v1/loans/fav":                                 "authenticated",
+	"GET /api/v1/loans/fines":                               "authenticated|scope:kiosk",
+	"GET /api/v1/loans/my":                                  "authenticated|scope:kiosk",
+	"POST /api/v1/loans/renew/:id":                          "owner|permission:loans:checkout",
+	"POST /api/v1/loans/return/:id":                         "owner|permission:loans:checkout",
+	"GET /api/v1/membership-plans":                          "public",
+	"PUT /api/v1/users/:id":                                 "owner|permission:users:write",
+	"POST /api/v1/users/me/2fa/disable":                     "authenticated|no-impersonation",
+	"POST /api/v1/users/me/2fa/enroll":                      "authenticated|no-impersonation",
+	"GET /api/v1/users/me/2fa/qr.png":                       "authenticated|no-impersonation",
+	"POST /api/v1/users/me/2fa/recovery-codes":              "authenticated|no-impersonation",
+	"POST /api/v1/users/me/2fa/verify":                      "authenticated|no-impersonation",
+	"GET /api/v1/users/me/card":                             "authenticated|scope:kiosk",
+	"GET /api/v1/users/me/card/barcode.png":                 "authenticated",
+	"POST /api/v1/users/me/card/pin":                        "authenticated|no-impersonation",
+	"GET /api/v1/users/me/card/qr.png":                      "authenticated",
+	"GET /api/v1/users/me/children":                         "authenticated",
+	"DELETE /api/v1/users/me/children/:id":                  "authenticated|no-impersonation",
+	"PUT /api/v1/users/me/children/:id/approval-categories": "authenticated|no-impersonation",
+	"POST /api/v1/users/me/children/:id/approvals":          "authenticated|no-impersonation",
+	"GET /api/v1/users/me/children/:id/loans":               "authenticated",
+	"GET /api/v1/users/me/children/:id/fines":               "authenticated",
+	"DELETE /api/v1/users/me/guardians/:id":                 "authenticated|no-impersonation",
+	"POST /api/v1/users/me/children/invite":                 "authenticated|no-impersonation",
+	"DELETE /api/v1/users/me/deletion":                      "authenticated|no-impersonation",
+	"POST /api/v1/users/me/deletion":                        "authenticated|no-impersonation",
+	"GET /api/v1/users/me/export":                           "authenticated|no-impersonation",
+	"GET /api/v1/users/me/guardians":                        "authenticated",
+	"POST /api/v1/users/me/guardians/accept":                "authenticated|no-impersonation",
+	"GET /api/v1/users/me/logins":                           "authenticated",
+	"GET /api/v1/users/me/membership":                       "authenticated",
+	"POST /api/v1/users/me/password":                        "authenticated|no-impersonation",
+	"GET /api/v1/users/profile":                             "authenticated|scope:kiosk",
+}
+
+// routeTestEngine mendaftarkan semua route module tanpa koneksi database (DryRun)
+func routeTestEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// Setiap server membaca .env dari working directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("AUTO_MIGRATE=N\nMAIL_DRIVER=memory\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := gin.New()
+	dashboard.Register(middlewares.NewRouter(&app.RouterGroup), "api/v1")
+	NewVersion(helper.Config{}, app, db, nil, "api/v1").Run()
+	return app
+}
+
+func TestEveryRouteHasExpectedPolicy(t *testing.T) {
+	app := routeTestEngine(t)
+
+	if err := middlewares.VerifyRoutes(app.Routes()); err != nil {
+		t.Fatal(err)
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range app.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+
+		want, ok := expectedPolicies[key]
+		if !ok {
+			t.Errorf("%s: route tidak ada di expectedPolicies", key)
+			continue
+		}
+		policy, ok := middlewares.RoutePolicy(route.Method, route.Path)
+		if !ok {
+			t.Errorf("%s: route tanpa policy", key)
+			continue
+		}
+		if policy.Name != want {
+			t.Errorf("%s: policy %q, want %q", key, policy.Name, want)
+		}
+	}
+
+	var missing []string
+	for key := range expectedPolicies {
+		if !registered[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		t.Errorf("%s: ada di expectedPolicies tetapi tidak terdaftar", key)
+	}
+}
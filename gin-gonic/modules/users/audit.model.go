@@ -0,0 +1,41 @@
+package users
+
+import "time"
+
+// Aksi admin terhadap akun user yang dicatat di audit log
+const (
+	AuditSuspend     = "suspend"
+	AuditReactivate  = "reactivate"
+	AuditSetRoles    = "set_roles"
+	AuditForceLogout = "force_logout"
+	AuditImpersonate = "impersonate"
+	AuditAgeOverride = "age_override"
+	AuditCardReissue = "card_reissue"
+
+	AuditMembershipRenew  = "membership_renew"
+	AuditMembershipChange = "membership_change"
+)
+
+// UserAuditLog mencatat aksi admin terhadap akun user (suspend, ganti role, impersonate, ...)
+type UserAuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ActorID   uint      `json:"actor_id" gorm:"index;not null"` // Admin yang melakukan aksi
+	UserID    uint      `json:"user_id" gorm:"index;not null"`  // User yang terkena aksi
+	Action    string    `json:"action" gorm:"index;not null"`
+	Reason    string    `json:"reason,omitempty"`
+	Detail    string    `json:"detail,omitempty"` // Contoh: daftar role baru, masa berlaku token impersonate
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (UserAuditLog) TableName() string {
+	return "user_audit_logs"
+}
+
+// AuditMeta adalah admin dan client yang melakukan aksi
+type AuditMeta struct {
+	ActorID   uint
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,69 @@
+package users
+
+import (
+	"strings"
+	"time"
+)
+
+// Status hubungan wali dan anak
+const (
+	GuardianPending = "pending" // Undangan terkirim, menunggu persetujuan anak
+	GuardianActive  = "active"
+	GuardianRevoked = "revoked"
+)
+
+// Guardianship menghubungkan akun wali dengan akun anak (user di bawah AgeOfMajority).
+// Wali dapat melihat peminjaman anak, menyetujui kategori buku tertentu dan menerima
+// pemberitahuan keterlambatan. Hubungan aktif setelah anak memberikan persetujuan.
+type Guardianship struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	GuardianID uint   `json:"guardian_id" gorm:"index;not null"`
+	ChildID    uint   `json:"child_id" gorm:"index;not null"`
+	Status     string `json:"status" gorm:"index;not null;default:pending"`
+	// Kategori buku yang wajib disetujui wali sebelum anak meminjam
+	ApprovalCategories []string   `json:"approval_categories" gorm:"type:text;serializer:json"`
+	TokenHash          string     `json:"-" gorm:"index"` // Token undangan, dikosongkan setelah dipakai
+	ExpiresAt          time.Time  `json:"expires_at"`
+	ConsentedAt        *time.Time `json:"consented_at"` // Waktu anak menyetujui hubungan
+	ConsentIP          string     `json:"consent_ip,omitempty"`
+	ConsentUserAgent   string     `json:"consent_user_agent,omitempty"`
+	RevokedAt          *time.Time `json:"revoked_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func (Guardianship) TableName() string {
+	return "guardianships"
+}
+
+// RequiresApproval mengecek apakah kategori buku wajib disetujui wali
+func (g *Guardianship) RequiresApproval(category string) bool {
+	for _, c := range g.ApprovalCategories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// DTO untuk mengundang akun anak
+type InviteChildRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// DTO untuk persetujuan anak atas undangan wali
+type AcceptGuardianRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// DTO untuk mengatur kategori buku yang wajib disetujui wali
+type ApprovalCategoriesRequest struct {
+	Categories []string `json:"categories" binding:"max=50,dive,min=1,max=50"`
+}
+
+// FamilyMember adalah hubungan wali/anak beserta nama dan email akun di sisi lain
+type FamilyMember struct {
+	Guardianship
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
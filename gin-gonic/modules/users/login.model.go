@@ -0,0 +1,40 @@
+package users
+
+import (
+	"time"
+
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+// LoginEvent mencatat setiap percobaan login, berhasil maupun gagal
+type LoginEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     *uint     `json:"user_id" gorm:"index"` // Nil jika email tidak terdaftar
+	Email      string    `json:"email" gorm:"type:text;serializer:encrypted"`
+	EmailIndex string    `json:"-" gorm:"index"` // Blind index email untuk filter, diisi BeforeSave
+	IP         string    `json:"ip" gorm:"index"`
+	UserAgent  string    `json:"user_agent"`
+	Success    bool      `json:"success"`
+	Reason     string    `json:"reason,omitempty"` // Alasan gagal: invalid_password, locked, ip_throttled, ...
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+func (LoginEvent) TableName() string {
+	return "login_events"
+}
+
+// BeforeSave mengisi blind index email karena kolom email terenkripsi
+func (e *LoginEvent) BeforeSave(tx *gorm.DB) error {
+	if e.Email != "" {
+		e.EmailIndex = utils.BlindIndex(e.Email)
+	}
+	return nil
+}
+
+// LoginMeta adalah informasi client yang melakukan login
+type LoginMeta struct {
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,57 @@
+package users
+
+import (
+	"time"
+
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity menghubungkan akun lokal dengan subject dari provider OIDC
+type UserIdentity struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"index;not null"`
+	Provider   string    `json:"provider" gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Subject    string    `json:"subject" gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Email      string    `json:"email" gorm:"type:text;serializer:encrypted"`
+	EmailIndex string    `json:"-" gorm:"index"` // Blind index email, diisi BeforeSave
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// BeforeSave mengisi blind index email karena kolom email terenkripsi
+func (i *UserIdentity) BeforeSave(tx *gorm.DB) error {
+	if i.Email != "" {
+		i.EmailIndex = utils.BlindIndex(i.Email)
+	}
+	return nil
+}
+
+// OIDCState menyimpan state, nonce dan PKCE verifier antara redirect login dan callback
+type OIDCState struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;not null"`
+	Provider     string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
+
+// OIDCProviderConfig adalah konfigurasi satu provider OIDC (dibaca dari file OIDC_CONFIG)
+type OIDCProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"` // URL /auth/oidc/callback milik aplikasi ini
+	Scopes       []string `json:"scopes"`       // Default: openid, email, profile
+}
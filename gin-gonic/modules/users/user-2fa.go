@@ -0,0 +1,467 @@
+package users
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+var (
+	// LoginChallengeTTL adalah masa berlaku challenge token 2FA
+	LoginChallengeTTL = 5 * time.Minute
+	// loginChallengeMaxAttempts membatasi tebakan kode per challenge
+	loginChallengeMaxAttempts = 5
+	// recoveryCodeCount adalah jumlah recovery code yang dibuat sekaligus
+	recoveryCodeCount = 10
+)
+
+const (
+	totpPeriod     = 30
+	totpQRSize     = 256
+	loginReason2FA = "invalid_2fa"
+)
+
+var (
+	errInvalidChallenge   = errors.New("invalid or expired challenge token")
+	errInvalid2FACode     = errors.New("invalid two-factor code")
+	err2FANotEnrolled     = errors.New("two-factor authentication has not been enrolled")
+	err2FAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	err2FARequiredByRole  = errors.New("two-factor authentication is mandatory for this role")
+	err2FARequiredRefresh = errors.New("two-factor authentication is required, please login again")
+)
+
+// requires2FA mengecek apakah 2FA wajib untuk user (ADMIN_REQUIRE_2FA=Y dan user punya role admin)
+func (s *userService) requires2FA(user *User) (bool, error) {
+	if s.config.Admin2FARequired != "Y" {
+		return false, nil
+	}
+	if user.Role == roles.RoleAdmin {
+		return true, nil
+	}
+
+	var count int64
+	err := s.db.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND roles.name = ?", user.ID, roles.RoleAdmin).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// newChallenge membuat challenge token untuk langkah kedua login
+func (s *userService) newChallenge(user *User, setupRequired bool) (*TwoFactorChallenge, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.db.Create(&LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(LoginChallengeTTL),
+		CreatedAt: now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{
+		TwoFactorRequired: true,
+		SetupRequired:     setupRequired,
+		ChallengeToken:    token,
+		ExpiresIn:         int(LoginChallengeTTL.Seconds()),
+	}, nil
+}
+
+// findChallenge mengambil challenge yang masih berlaku beserta user-nya
+func (s *userService) findChallenge(token string) (*LoginChallenge, *User, error) {
+	var challenge LoginChallenge
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&challenge).Error; err != nil {
+		return nil, nil, errInvalidChallenge
+	}
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) ||
+		challenge.Attempts >= loginChallengeMaxAttempts {
+		return nil, nil, errInvalidChallenge
+	}
+
+	var user User
+	if err := s.db.First(&user, challenge.UserID).Error; err != nil {
+		return nil, nil, errInvalidChallenge
+	}
+	return &challenge, &user, nil
+}
+
+// totpKey membuat otp.Key untuk user. secret nil berarti buat secret acak baru.
+func (s *userService) totpKey(user *User, secret []byte) (*otp.Key, error) {
+	issuer := s.config.TOTPIssuer
+	if issuer == "" {
+		issuer = "Gin Library"
+	}
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Secret:      secret,
+	})
+}
+
+// generateTOTP membuat secret baru untuk user beserta URI otpauth dan QR code
+func (s *userService) generateTOTP(user *User) (*TwoFactorEnrollResponse, error) {
+	key, err := s.totpKey(user, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	qr, err := totpQRCode(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Secret baru menggantikan enrollment lama yang belum diverifikasi.
+	// Update lewat struct agar serializer enkripsi dijalankan.
+	user.TOTPSecret = key.Secret()
+	user.TOTPLastStep = 0
+	if err := s.db.Model(user).Select("totp_secret", "totp_last_step").Updates(user).Error; err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollResponse{
+		Secret:     key.Secret(),
+		OTPAuthURL: key.URL(),
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr),
+	}, nil
+}
+
+// totpQRCode merender URI otpauth sebagai PNG
+func totpQRCode(key *otp.Key) ([]byte, error) {
+	img, err := key.Image(totpQRSize, totpQRSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyTOTP memvalidasi kode dengan toleransi satu time step dan menolak
+// kode dari time step yang sudah pernah dipakai (replay).
+func (s *userService) verifyTOTP(user *User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+	code = strings.TrimSpace(code)
+
+	now := time.Now()
+	current := now.Unix() / totpPeriod
+	for _, offset := range []int64{-1, 0, 1} {
+		step := current + offset
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(user.TOTPSecret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		// Update bersyarat agar kode yang sama tidak bisa dipakai dua request bersamaan
+		result := s.db.Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+		user.TOTPLastStep = step
+		return true, nil
+	}
+	return false, nil
+}
+
+// useRecoveryCode memakai satu recovery code (sekali pakai)
+func (s *userService) useRecoveryCode(userID uint, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	result := s.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// regenerateRecoveryCodes mengganti semua recovery code milik user
+func regenerateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]RecoveryCode, 0, recoveryCodeCount)
+	now := time.Now()
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.RandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		records = append(records, RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code), CreatedAt: now})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// enableTOTP mengaktifkan 2FA dan membuat recovery code baru
+func (s *userService) enableTOTP(user *User) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = regenerateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	return codes, nil
+}
+
+// =================================================================
+// Login langkah kedua
+// =================================================================
+
+// SetupTwoFactorLogin membuat secret TOTP untuk user yang wajib 2FA tapi belum enroll.
+// Hanya bisa dipakai dengan challenge token dari Login.
+func (s *userService) SetupTwoFactorLogin(input *TwoFactorSetupRequest) (*TwoFactorEnrollResponse, error) {
+	_, user, err := s.findChallenge(input.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, err2FAAlreadyEnabled
+	}
+	return s.generateTOTP(user)
+}
+
+// LoginTwoFactor memverifikasi kode TOTP atau recovery code lalu menerbitkan token.
+// Jika 2FA belum aktif (setup saat login), kode pertama yang valid sekaligus mengaktifkannya.
+func (s *userService) LoginTwoFactor(input *TwoFactorLoginRequest, meta LoginMeta) (*LoginResponse, error) {
+	challenge, user, err := s.findChallenge(input.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		s.recordLogin(user, user.Email, meta, false, loginReasonLocked)
+		return nil, &LoginThrottledError{RetryAfter: time.Until(*user.LockedUntil)}
+	}
+
+	valid, err := s.verifyTOTP(user, input.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid && user.TOTPEnabled {
+		if valid, err = s.useRecoveryCode(user.ID, input.Code); err != nil {
+			return nil, err
+		}
+	}
+	if !valid {
+		s.db.Model(&LoginChallenge{}).Where("id = ?", challenge.ID).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		s.recordLogin(user, user.Email, meta, false, loginReason2FA)
+		// Kode salah dihitung ke lockout akun yang sama dengan password salah
+		if err := s.registerFailedLogin(user); err != nil {
+			return nil, err
+		}
+		return nil, errInvalid2FACode
+	}
+
+	// Challenge hanya bisa dipakai sekali
+	result := s.db.Model(&LoginChallenge{}).Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidChallenge
+	}
+
+	var recoveryCodes []string
+	if !user.TOTPEnabled {
+		if recoveryCodes, err = s.enableTOTP(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.resetFailedLogins(user); err != nil {
+		return nil, err
+	}
+	s.recordLogin(user, user.Email, meta, true, "")
+	response, err := s.issueTokens(user, "")
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = recoveryCodes
+	return response, nil
+}
+
+// =================================================================
+// Manajemen 2FA oleh user yang sedang login
+// =================================================================
+
+// EnrollTwoFactor membuat secret TOTP baru. 2FA aktif setelah VerifyTwoFactor.
+func (s *userService) EnrollTwoFactor(userID uint) (*TwoFactorEnrollResponse, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.TOTPEnabled {
+		return nil, err2FAAlreadyEnabled
+	}
+	return s.generateTOTP(&user)
+}
+
+// TwoFactorQRCode mengembalikan QR code PNG untuk enrollment yang belum diverifikasi
+func (s *userService) TwoFactorQRCode(userID uint) ([]byte, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.TOTPEnabled {
+		return nil, err2FAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, err2FANotEnrolled
+	}
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.totpKey(&user, secret)
+	if err != nil {
+		return nil, err
+	}
+	return totpQRCode(key)
+}
+
+// VerifyTwoFactor mengaktifkan 2FA setelah user memasukkan kode pertama dari aplikasi authenticator
+func (s *userService) VerifyTwoFactor(userID uint, input *TwoFactorCodeRequest) ([]string, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.TOTPEnabled {
+		return nil, err2FAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, err2FANotEnrolled
+	}
+
+	valid, err := s.verifyTOTP(&user, input.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errInvalid2FACode
+	}
+	return s.enableTOTP(&user)
+}
+
+// RegenerateRecoveryCodes membuat recovery code baru, kode lama tidak berlaku lagi
+func (s *userService) RegenerateRecoveryCodes(userID uint, input *TwoFactorCodeRequest) ([]string, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if !user.TOTPEnabled {
+		return nil, err2FANotEnrolled
+	}
+
+	valid, err := s.verifyTOTP(&user, input.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errInvalid2FACode
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = regenerateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTwoFactor menonaktifkan 2FA. Ditolak jika role user mewajibkan 2FA.
+func (s *userService) DisableTwoFactor(userID uint, input *TwoFactorDisableRequest) error {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return errors.New("data tidak ditemukan")
+	}
+	if !user.TOTPEnabled {
+		return err2FANotEnrolled
+	}
+
+	required, err := s.requires2FA(&user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return err2FARequiredByRole
+	}
+
+	if !utils.CheckPassword(input.Password, user.Password) {
+		return errors.New("password is incorrect")
+	}
+	valid, err := s.verifyTOTP(&user, input.Code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		if valid, err = s.useRecoveryCode(user.ID, input.Code); err != nil {
+			return err
+		}
+	}
+	if !valid {
+		return errInvalid2FACode
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+	})
+}
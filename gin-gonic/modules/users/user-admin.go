@@ -0,0 +1,208 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+// ImpersonationTTL adalah masa berlaku token impersonate (bisa diubah dari config)
+var ImpersonationTTL = 15 * time.Minute
+
+var errAccountSuspended = errors.New("account is suspended")
+
+// audit menyimpan aksi admin ke user_audit_logs
+func audit(tx *gorm.DB, meta AuditMeta, userID uint, action, reason, detail string) error {
+	return tx.Create(&UserAuditLog{
+		ActorID:   meta.ActorID,
+		UserID:    userID,
+		Action:    action,
+		Reason:    reason,
+		Detail:    detail,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// Suspend menonaktifkan akun dan mencabut semua sesinya.
+// User yang di-suspend tidak bisa login, refresh token, maupun membuka WebSocket.
+func (s *userService) Suspend(id string, input *SuspendUserRequest, meta AuditMeta) (*User, error) {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.ID == meta.ActorID {
+		return nil, errors.New("tidak dapat men-suspend akun sendiri")
+	}
+	if user.SuspendedAt != nil {
+		return nil, errors.New("akun sudah di-suspend")
+	}
+
+	// Jangan sampai tidak ada admin aktif sama sekali
+	if user.Role == roles.RoleAdmin {
+		var admins int64
+		if err := s.db.Model(&User{}).Where("role = ? AND id <> ? AND suspended_at IS NULL", roles.RoleAdmin, user.ID).
+			Count(&admins).Error; err != nil {
+			return nil, err
+		}
+		if admins == 0 {
+			return nil, errors.New("tidak dapat men-suspend admin aktif terakhir")
+		}
+	}
+
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"suspended_at":   now,
+			"suspend_reason": input.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		if err := revokeAllSessions(tx, user.ID, now); err != nil {
+			return err
+		}
+		return audit(tx, meta, user.ID, AuditSuspend, input.Reason, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(id)
+}
+
+// Reactivate mengaktifkan kembali akun yang di-suspend
+func (s *userService) Reactivate(id string, meta AuditMeta) (*User, error) {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.SuspendedAt == nil {
+		return nil, errors.New("akun tidak dalam status suspend")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"suspended_at":   nil,
+			"suspend_reason": "",
+		}).Error; err != nil {
+			return err
+		}
+		return audit(tx, meta, user.ID, AuditReactivate, "", "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(id)
+}
+
+// ForceLogout mencabut semua refresh token dan access token user
+func (s *userService) ForceLogout(id string, meta AuditMeta) error {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return errors.New("data tidak ditemukan")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeAllSessions(tx, user.ID, time.Now()); err != nil {
+			return err
+		}
+		return audit(tx, meta, user.ID, AuditForceLogout, "", "")
+	})
+}
+
+// Impersonate membuat access token berumur pendek atas nama user untuk keperluan support.
+// Token memuat ID admin (claim "act"), tidak memiliki refresh token, dan tercatat di audit log.
+// Admin hanya bisa impersonate user yang permission-nya tidak melebihi permission admin itu sendiri.
+func (s *userService) Impersonate(id string, input *ImpersonateRequest, meta AuditMeta) (*ImpersonationResponse, error) {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.ID == meta.ActorID {
+		return nil, errors.New("tidak dapat impersonate akun sendiri")
+	}
+	if user.SuspendedAt != nil {
+		return nil, errAccountSuspended
+	}
+
+	targetPermissions, err := userPermissions(s.db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	actorPermissions, err := userPermissions(s.db, meta.ActorID)
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[string]bool, len(actorPermissions))
+	for _, code := range actorPermissions {
+		granted[code] = true
+	}
+	for _, code := range targetPermissions {
+		if code == roles.PermUsersImpersonate || !granted[code] {
+			return nil, errors.New("tidak dapat impersonate user dengan akses setara atau lebih tinggi")
+		}
+	}
+
+	// Audit dicatat sebelum token dibuat: tanpa audit log tidak ada token
+	ttl := ImpersonationTTL
+	if err := audit(s.db, meta, user.ID, AuditImpersonate, input.Reason, "ttl="+ttl.String()); err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateImpersonationJWT(user.ID, user.Email, user.Name, user.Role, user.TokenVersion, meta.ActorID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImpersonationResponse{
+		Token:          token,
+		ExpiresIn:      int(ttl.Seconds()),
+		User:           user,
+		ImpersonatedBy: meta.ActorID,
+	}, nil
+}
+
+// GetAuditLogs mengembalikan audit log aksi admin, bisa difilter per user atau aksi
+func (s *userService) GetAuditLogs(page, limit int, userID uint, action string) ([]UserAuditLog, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := s.db.Model(&UserAuditLog{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []UserAuditLog
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+func roleNames(list []roles.Role) string {
+	names := make([]string, 0, len(list))
+	for _, role := range list {
+		names = append(names, role.Name)
+	}
+	return fmt.Sprintf("roles=%s", strings.Join(names, ","))
+}
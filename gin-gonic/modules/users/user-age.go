@@ -0,0 +1,46 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LibraryLocation adalah zona waktu perpustakaan untuk menghitung umur (bisa diubah dari config)
+var LibraryLocation = time.UTC
+
+// errBornDateLocked dikembalikan Update jika user biasa mencoba mengubah tanggal lahirnya sendiri
+var errBornDateLocked = errors.New("tanggal lahir hanya dapat diubah oleh petugas perpustakaan")
+
+// AgeAt menghitung umur user (tahun penuh) pada waktu now menurut tanggal di zona waktu perpustakaan.
+// Mengembalikan false jika tanggal lahir tidak diketahui.
+func (u *User) AgeAt(now time.Time) (int, bool) {
+	if u.BornDate.IsZero() {
+		return 0, false
+	}
+
+	// Tanggal lahir disimpan sebagai tanggal kalender, tanpa konversi zona waktu
+	by, bm, bd := u.BornDate.Date()
+	ty, tm, td := now.In(LibraryLocation).Date()
+
+	age := ty - by
+	if tm < bm || (tm == bm && td < bd) {
+		age--
+	}
+	if age < 0 {
+		age = 0
+	}
+	return age, true
+}
+
+// AgeOf memuat tanggal lahir user dan menghitung umurnya saat ini.
+// born_date terenkripsi sehingga umur tidak bisa dihitung di SQL.
+func AgeOf(db *gorm.DB, userID uint) (int, bool, error) {
+	var user User
+	if err := db.Select("id", "born_date").First(&user, userID).Error; err != nil {
+		return 0, false, err
+	}
+	age, known := user.AgeAt(time.Now())
+	return age, known, nil
+}
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"net/http"
+
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (c *userController) GetCard(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	card, err := c.service.GetCard(principal.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, card)
+}
+
+func (c *userController) CardBarcode(ctx *gin.Context) {
+	c.cardImage(ctx, "barcode")
+}
+
+func (c *userController) CardQRCode(ctx *gin.Context) {
+	c.cardImage(ctx, "qr")
+}
+
+func (c *userController) cardImage(ctx *gin.Context, format string) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	image, err := c.service.CardImage(principal.UserID, format)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "image/png", image)
+}
+
+func (c *userController) SetCardPIN(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input SetCardPINRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	if err := c.service.SetCardPIN(principal.UserID, &input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "PIN kartu anggota berhasil diatur"})
+}
+func (c *userController) GetByCard(ctx *gin.Context) {
+	user, err := c.service.GetByCard(ctx.Param("number"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (c *userController) ReissueCard(ctx *gin.Context) {
+	user, err := c.service.ReissueCard(ctx.Param("id"), auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal mengganti kartu anggota: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,307 @@
+package users
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"image/png"
+	"math/big"
+	"strings"
+	"time"
+
+	"gin-gonic/middlewares"
+	"gin-gonic/utils"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"gorm.io/gorm"
+)
+
+var (
+	// KioskTokenTTL adalah masa berlaku token kiosk (bisa diubah dari config)
+	KioskTokenTTL = 5 * time.Minute
+
+	// PIN diblokir setelah kioskMaxPINFailures kali salah berturut-turut,
+	// user harus mengatur PIN baru dari akunnya
+	kioskMaxPINFailures = 5
+)
+
+const (
+	// Nomor kartu: prefix + digit acak + check digit Luhn (total cardNumberLength digit)
+	cardNumberPrefix   = "29"
+	cardNumberLength   = 12
+	cardNumberAttempts = 5
+
+	loginReasonUnknownCard = "unknown_card"
+	loginReasonInvalidPIN  = "invalid_pin"
+	loginReasonPINLocked   = "pin_locked"
+	loginReasonKiosk       = "kiosk"
+)
+
+var (
+	errInvalidCardLogin = errors.New("nomor kartu atau PIN salah")
+	// ErrCardPINLocked dikembalikan login kiosk jika PIN belum diatur atau sudah diblokir
+	ErrCardPINLocked = errors.New("PIN belum diatur atau diblokir, atur PIN baru dari akun Anda")
+	errCardNotFound  = errors.New("kartu anggota tidak ditemukan")
+)
+
+// BeforeCreate memberi nomor kartu anggota untuk user baru
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.CardNumber != "" {
+		return nil
+	}
+	number, err := newCardNumber(tx.Session(&gorm.Session{NewDB: true}))
+	if err != nil {
+		return err
+	}
+	u.CardNumber = number
+	return nil
+}
+
+// luhnDigit menghitung check digit Luhn agar salah ketik nomor kartu langsung ketahuan
+func luhnDigit(digits string) byte {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// validCardNumber mengecek panjang, karakter dan check digit nomor kartu
+func validCardNumber(number string) bool {
+	if len(number) != cardNumberLength {
+		return false
+	}
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+	}
+	return luhnDigit(number[:len(number)-1]) == number[len(number)-1]
+}
+
+// normalizeCardNumber menghapus spasi dan tanda hubung dari hasil ketik manual
+func normalizeCardNumber(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number))
+}
+
+// newCardNumber membuat nomor kartu acak yang belum dipakai user lain
+func newCardNumber(db *gorm.DB) (string, error) {
+	random := cardNumberLength - len(cardNumberPrefix) - 1
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(random)), nil)
+
+	for i := 0; i < cardNumberAttempts; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		body := fmt.Sprintf("%s%0*d", cardNumberPrefix, random, n)
+		number := body + string(luhnDigit(body))
+
+		var count int64
+		if err := db.Unscoped().Model(&User{}).Where("card_number = ?", number).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return number, nil
+		}
+	}
+	return "", errors.New("gagal membuat nomor kartu anggota, coba lagi")
+}
+
+// assignCardNumbers memberi nomor kartu untuk user lama yang dibuat sebelum ada kartu anggota
+func assignCardNumbers(db *gorm.DB) (int, error) {
+	var ids []uint
+	if err := db.Unscoped().Model(&User{}).Where("card_number IS NULL OR card_number = ''").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+	for _, id := range ids {
+		number, err := newCardNumber(db)
+		if err != nil {
+			return assigned, err
+		}
+		result := db.Unscoped().Model(&User{}).Where("id = ? AND (card_number IS NULL OR card_number = '')", id).
+			Update("card_number", number)
+		if result.Error != nil {
+			return assigned, result.Error
+		}
+		assigned += int(result.RowsAffected)
+	}
+	return assigned, nil
+}
+
+// GetCard mengembalikan data kartu anggota user
+func (s *userService) GetCard(userID uint) (*CardResponse, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	return &CardResponse{CardNumber: user.CardNumber, Name: user.Name, PINSet: user.CardPIN != ""}, nil
+}
+
+// CardImage merender nomor kartu anggota sebagai PNG, format "barcode" (Code128) atau "qr"
+func (s *userService) CardImage(userID uint, format string) ([]byte, error) {
+	var user User
+	if err := s.db.Select("id", "card_number").First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+	if user.CardNumber == "" {
+		return nil, errCardNotFound
+	}
+
+	var code barcode.Barcode
+	var err error
+	switch format {
+	case "barcode":
+		code, err = code128.Encode(user.CardNumber)
+		if err == nil {
+			code, err = barcode.Scale(code, code.Bounds().Dx()*3, 120)
+		}
+	case "qr":
+		code, err = qr.Encode(user.CardNumber, qr.M, qr.Auto)
+		if err == nil {
+			code, err = barcode.Scale(code, 256, 256)
+		}
+	default:
+		return nil, errors.New("format kartu tidak dikenal")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SetCardPIN mengatur PIN kiosk setelah password dikonfirmasi dan membuka blokir PIN
+func (s *userService) SetCardPIN(userID uint, input *SetCardPINRequest) error {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return errors.New("data tidak ditemukan")
+	}
+	if !utils.CheckPassword(input.Password, user.Password) {
+		return errors.New("password salah")
+	}
+
+	hashed, err := utils.HashPassword(input.PIN)
+	if err != nil {
+		return err
+	}
+	user.CardPIN = hashed
+	user.CardPINFailed = 0
+	return s.db.Model(&user).Select("card_pin", "card_pin_failed").Updates(&user).Error
+}
+
+// KioskSession menukar nomor kartu anggota dan PIN dengan token ber-scope kiosk yang terikat ke
+// perangkat kiosk kioskID. Hanya dipanggil lewat perangkat terdaftar (module kiosks).
+// Token tidak bisa di-refresh dan berhenti berlaku jika perangkatnya dicabut.
+func KioskSession(db *gorm.DB, kioskID uint, input *KioskLoginRequest, meta LoginMeta) (*KioskLoginResponse, error) {
+	s := &userService{db: db}
+	if err := s.checkIPThrottle(meta.IP); err != nil {
+		s.recordLogin(nil, "", meta, false, loginReasonIPThrottled)
+		return nil, err
+	}
+
+	number := normalizeCardNumber(input.CardNumber)
+	var user User
+	if !validCardNumber(number) || s.db.Where("card_number = ?", number).First(&user).Error != nil {
+		s.recordLogin(nil, "", meta, false, loginReasonUnknownCard)
+		return nil, errInvalidCardLogin
+	}
+
+	if user.CardPIN == "" || user.CardPINFailed >= kioskMaxPINFailures {
+		s.recordLogin(&user, user.Email, meta, false, loginReasonPINLocked)
+		return nil, ErrCardPINLocked
+	}
+	if !utils.CheckPassword(input.PIN, user.CardPIN) {
+		s.recordLogin(&user, user.Email, meta, false, loginReasonInvalidPIN)
+		if err := s.db.Model(&user).Update("card_pin_failed", gorm.Expr("card_pin_failed + 1")).Error; err != nil {
+			return nil, err
+		}
+		return nil, errInvalidCardLogin
+	}
+
+	if user.SuspendedAt != nil {
+		s.recordLogin(&user, user.Email, meta, false, loginReasonSuspended)
+		return nil, errAccountSuspended
+	}
+
+	if user.CardPINFailed > 0 {
+		if err := s.db.Model(&user).Update("card_pin_failed", 0).Error; err != nil {
+			return nil, err
+		}
+		user.CardPINFailed = 0
+	}
+
+	ttl := KioskTokenTTL
+	token, err := utils.GenerateScopedJWT(user.ID, user.Email, user.Name, user.Role, user.TokenVersion, middlewares.ScopeKiosk, kioskID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	s.recordLogin(&user, user.Email, meta, true, loginReasonKiosk)
+
+	return &KioskLoginResponse{Token: token, ExpiresIn: int(ttl.Seconds()), User: user}, nil
+}
+
+// GetByCard mencari anggota berdasarkan nomor kartu (hasil scan di meja pustakawan)
+func (s *userService) GetByCard(number string) (*User, error) {
+	return FindByCard(s.db.Preload("Roles"), number)
+}
+
+// FindByCard mencari user berdasarkan nomor kartu anggota, dipakai juga oleh modul lain
+func FindByCard(db *gorm.DB, number string) (*User, error) {
+	number = normalizeCardNumber(number)
+	if !validCardNumber(number) {
+		return nil, errors.New("nomor kartu tidak valid")
+	}
+
+	var user User
+	if err := db.Where("card_number = ?", number).First(&user).Error; err != nil {
+		return nil, errCardNotFound
+	}
+	return &user, nil
+}
+
+// ReissueCard mengganti nomor kartu yang hilang. Nomor lama dan PIN langsung tidak berlaku.
+func (s *userService) ReissueCard(id string, meta AuditMeta) (*User, error) {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+
+	previous := user.CardNumber
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		number, err := newCardNumber(tx)
+		if err != nil {
+			return err
+		}
+		user.CardNumber = number
+		user.CardPIN = ""
+		user.CardPINFailed = 0
+		if err := tx.Model(&user).Select("card_number", "card_pin", "card_pin_failed").Updates(&user).Error; err != nil {
+			return err
+		}
+		return audit(tx, meta, user.ID, AuditCardReissue, "", "previous="+previous)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -1,9 +1,13 @@
 package users
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,8 +20,48 @@ type UserController interface {
 	GetByID(ctx *gin.Context)
 	Search(ctx *gin.Context)
 	Login(ctx *gin.Context)
+	Refresh(ctx *gin.Context)
+	Logout(ctx *gin.Context)
 	GetProfile(ctx *gin.Context)
 	GetStats(ctx *gin.Context)
+	SetRoles(ctx *gin.Context)
+	ForgotPassword(ctx *gin.Context)
+	ResetPassword(ctx *gin.Context)
+	ChangePassword(ctx *gin.Context)
+	VerifyEmail(ctx *gin.Context)
+	ResendVerification(ctx *gin.Context)
+	LoginTwoFactor(ctx *gin.Context)
+	SetupTwoFactorLogin(ctx *gin.Context)
+	EnrollTwoFactor(ctx *gin.Context)
+	TwoFactorQRCode(ctx *gin.Context)
+	VerifyTwoFactor(ctx *gin.Context)
+	RegenerateRecoveryCodes(ctx *gin.Context)
+	DisableTwoFactor(ctx *gin.Context)
+	OIDCProviders(ctx *gin.Context)
+	OIDCLogin(ctx *gin.Context)
+	OIDCCallback(ctx *gin.Context)
+	GetMyLogins(ctx *gin.Context)
+	GetLoginEvents(ctx *gin.Context)
+	GetUserLogins(ctx *gin.Context)
+	Unlock(ctx *gin.Context)
+	Suspend(ctx *gin.Context)
+	Reactivate(ctx *gin.Context)
+	ForceLogout(ctx *gin.Context)
+	Impersonate(ctx *gin.Context)
+	GetAuditLogs(ctx *gin.Context)
+	InviteChild(ctx *gin.Context)
+	AcceptGuardian(ctx *gin.Context)
+	GetChildren(ctx *gin.Context)
+	GetGuardians(ctx *gin.Context)
+	RevokeGuardian(ctx *gin.Context)
+	UnlinkChild(ctx *gin.Context)
+	SetApprovalCategories(ctx *gin.Context)
+	GetCard(ctx *gin.Context)
+	CardBarcode(ctx *gin.Context)
+	CardQRCode(ctx *gin.Context)
+	SetCardPIN(ctx *gin.Context)
+	GetByCard(ctx *gin.Context)
+	ReissueCard(ctx *gin.Context)
 }
 
 type userController struct {
@@ -51,8 +95,18 @@ func (c *userController) Update(ctx *gin.Context) {
 		return
 	}
 
+	// Hanya staf yang boleh mengubah tanggal lahir
+	staff := false
+	if principal, ok := middlewares.CurrentPrincipal(ctx); ok {
+		staff = principal.HasPermission(roles.PermUsersWrite)
+	}
+
 	id := ctx.Param("id")
-	user, err := c.service.Update(id, &input)
+	user, err := c.service.Update(id, &input, staff)
+	if errors.Is(err, errBornDateLocked) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal memperbarui data: " + err.Error()})
 		return
@@ -148,29 +202,78 @@ func (c *userController) Login(ctx *gin.Context) {
 		return
 	}
 
-	result, err := c.service.Login(&input)
+	result, challenge, err := c.service.Login(&input, loginMeta(ctx))
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		ctx.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errAccountSuspended) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
+	if challenge != nil {
+		ctx.JSON(http.StatusOK, challenge)
+		return
+	}
 
 	ctx.JSON(http.StatusOK, result)
 }
 
-func (c *userController) GetProfile(ctx *gin.Context) {
-	userID, ok := ctx.Get("user_id")
+func loginMeta(ctx *gin.Context) LoginMeta {
+	return LoginMeta{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+}
+
+func (c *userController) Refresh(ctx *gin.Context) {
+	var input RefreshRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	result, err := c.service.Refresh(&input)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *userController) Logout(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
 	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	idFloat, ok := userID.(float64)
+	var input LogoutRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	if err := c.service.Logout(principal.UserID, &input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logout berhasil"})
+}
+
+func (c *userController) GetProfile(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
 	if !ok {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	user, err := c.service.GetProfile(uint(idFloat))
+	user, err := c.service.GetProfile(principal.UserID)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -188,3 +291,243 @@ func (c *userController) GetStats(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, stats)
 }
+
+func (c *userController) SetRoles(ctx *gin.Context) {
+	var input SetRolesRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	id := ctx.Param("id")
+	user, err := c.service.SetRoles(id, &input, auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal mengubah role: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (c *userController) ForgotPassword(ctx *gin.Context) {
+	var input ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	if err := c.service.ForgotPassword(&input); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim email reset password"})
+		return
+	}
+
+	// Response selalu sama, terdaftar atau tidak
+	ctx.JSON(http.StatusOK, gin.H{"message": "Jika email terdaftar, link reset password telah dikirim"})
+}
+
+func (c *userController) ResetPassword(ctx *gin.Context) {
+	var input ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	if err := c.service.ResetPassword(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password berhasil diubah, silakan login kembali"})
+}
+
+func (c *userController) ChangePassword(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	result, err := c.service.ChangePassword(principal.UserID, &input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *userController) VerifyEmail(ctx *gin.Context) {
+	if err := c.service.VerifyEmail(ctx.Query("token")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Email berhasil diverifikasi"})
+}
+
+func (c *userController) ResendVerification(ctx *gin.Context) {
+	var input ResendVerificationRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	if err := c.service.ResendVerification(&input); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim email verifikasi"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Jika email terdaftar dan belum diverifikasi, link verifikasi telah dikirim"})
+}
+
+func (c *userController) GetMyLogins(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	events, err := c.service.GetLoginHistory(principal.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": events})
+}
+
+func (c *userController) GetLoginEvents(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+
+	events, total, err := c.service.GetLoginEvents(page, limit, ctx.Query("email"), ctx.Query("ip"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":      events,
+		"total_row": total,
+	})
+}
+
+func (c *userController) GetUserLogins(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID tidak valid"})
+		return
+	}
+
+	events, err := c.service.GetLoginHistory(uint(id))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": events})
+}
+
+func (c *userController) Unlock(ctx *gin.Context) {
+	user, err := c.service.Unlock(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal membuka kunci akun: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// auditMeta mengambil admin yang sedang login dan info client untuk audit log
+func auditMeta(ctx *gin.Context) AuditMeta {
+	meta := AuditMeta{IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	if principal, ok := middlewares.CurrentPrincipal(ctx); ok {
+		meta.ActorID = principal.UserID
+	}
+	return meta
+}
+
+func (c *userController) Suspend(ctx *gin.Context) {
+	var input SuspendUserRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	user, err := c.service.Suspend(ctx.Param("id"), &input, auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal men-suspend akun: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (c *userController) Reactivate(ctx *gin.Context) {
+	user, err := c.service.Reactivate(ctx.Param("id"), auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal mengaktifkan akun: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (c *userController) ForceLogout(ctx *gin.Context) {
+	if err := c.service.ForceLogout(ctx.Param("id"), auditMeta(ctx)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal logout paksa: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Semua sesi user telah dicabut"})
+}
+
+func (c *userController) Impersonate(ctx *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	// Impersonate hanya untuk admin yang login langsung, bukan lewat API key
+	if principal.APIKeyID != 0 {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Impersonate tidak dapat dilakukan dengan API key"})
+		return
+	}
+
+	var input ImpersonateRequest
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Format data tidak valid: " + err.Error()})
+		return
+	}
+
+	result, err := c.service.Impersonate(ctx.Param("id"), &input, auditMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Gagal impersonate user: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *userController) GetAuditLogs(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	userID, _ := strconv.ParseUint(ctx.Query("user_id"), 10, 64)
+
+	logs, total, err := c.service.GetAuditLogs(page, limit, uint(userID), ctx.Query("action"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":      logs,
+		"total_row": total,
+	})
+}
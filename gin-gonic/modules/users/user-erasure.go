@@ -0,0 +1,93 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+// DeletedUserName adalah nama pengganti untuk akun yang sudah dihapus
+const DeletedUserName = "Deleted user"
+
+// Anonymize menghapus data pribadi user di dalam transaksi tx. Baris users tidak dihapus
+// permanen (hanya soft delete) sehingga loan dan statistik yang merujuk user_id tetap utuh.
+// Tahun lahir dipertahankan untuk statistik usia, tanggal dan bulan dihapus.
+func Anonymize(tx *gorm.DB, userID uint, now time.Time) error {
+	var user User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	// Password acak yang tidak pernah diketahui siapa pun
+	randomPassword, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return err
+	}
+
+	bornDate := user.BornDate
+	if !bornDate.IsZero() {
+		bornDate = time.Date(bornDate.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	originalEmail := user.Email
+	user.Name = DeletedUserName
+	user.Email = fmt.Sprintf("deleted-%d@invalid", user.ID)
+	user.Address = ""
+	user.BornDate = bornDate
+	user.Password = hashedPassword
+	user.VerifiedAt = nil
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.SuspendReason = ""
+	// Nomor kartu diganti agar kartu fisik lama tidak lagi terhubung ke akun
+	cardNumber, err := newCardNumber(tx)
+	if err != nil {
+		return err
+	}
+	user.CardNumber = cardNumber
+	user.CardPIN = ""
+	user.CardPINFailed = 0
+
+	// Update lewat struct (bukan map) agar serializer enkripsi dan hook blind index dijalankan
+	if err := tx.Model(&user).Select("name", "email", "email_index", "address", "born_date", "password",
+		"verified_at", "failed_logins", "locked_until", "totp_secret", "totp_enabled", "totp_last_step",
+		"suspend_reason", "card_number", "card_pin", "card_pin_failed").Updates(&user).Error; err != nil {
+		return err
+	}
+
+	if err := revokeAllSessions(tx, user.ID, now); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{
+		&RefreshToken{}, &PasswordResetToken{}, &EmailVerificationToken{},
+		&RecoveryCode{}, &LoginChallenge{}, &UserIdentity{}, &roles.UserRole{},
+	} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	// Hubungan wali dan anak dihapus dari kedua sisi
+	if err := tx.Where("guardian_id = ? OR child_id = ?", user.ID, user.ID).Delete(&Guardianship{}).Error; err != nil {
+		return err
+	}
+
+	// Login event tetap dihitung, tetapi tanpa email, IP dan user agent
+	if err := tx.Model(&LoginEvent{}).Where("user_id = ? OR email_index = ?", user.ID, utils.BlindIndex(originalEmail)).
+		Updates(map[string]interface{}{"email": "", "email_index": "", "ip": "", "user_agent": ""}).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&user).Error
+}
@@ -0,0 +1,315 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// AgeOfMajority adalah umur akun dewasa, user di bawahnya dianggap anak (bisa diubah dari config)
+	AgeOfMajority = 18
+	// GuardianInviteTTL adalah masa berlaku undangan wali
+	GuardianInviteTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrNotGuardian dikembalikan jika user bukan wali aktif dari akun anak
+	ErrNotGuardian = errors.New("anda bukan wali dari akun ini")
+
+	errInvalidGuardianToken = errors.New("invalid or expired guardian invitation")
+)
+
+// IsMinor mengecek apakah user di bawah AgeOfMajority. User tanpa tanggal lahir tidak dianggap anak.
+func (u *User) IsMinor(now time.Time) bool {
+	age, known := u.AgeAt(now)
+	return known && age < AgeOfMajority
+}
+
+// isMinorID memuat tanggal lahir user dan mengecek apakah masih di bawah umur
+func isMinorID(db *gorm.DB, userID uint) (bool, error) {
+	var user User
+	err := db.Select("id", "born_date").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.IsMinor(time.Now()), nil
+}
+
+// GuardianOf mengembalikan hubungan aktif antara wali dan anak. Hubungan tidak berlaku lagi
+// setelah anak mencapai AgeOfMajority.
+func GuardianOf(db *gorm.DB, guardianID, childID uint) (*Guardianship, error) {
+	var link Guardianship
+	err := db.Where("guardian_id = ? AND child_id = ? AND status = ?", guardianID, childID, GuardianActive).
+		First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotGuardian
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	minor, err := isMinorID(db, childID)
+	if err != nil {
+		return nil, err
+	}
+	if !minor {
+		return nil, ErrNotGuardian
+	}
+	return &link, nil
+}
+
+// ActiveGuardians mengembalikan hubungan wali yang aktif untuk anak.
+// Kosong jika user sudah dewasa atau tidak memiliki wali.
+func ActiveGuardians(db *gorm.DB, childID uint) ([]Guardianship, error) {
+	minor, err := isMinorID(db, childID)
+	if err != nil || !minor {
+		return nil, err
+	}
+
+	var links []Guardianship
+	if err := db.Where("child_id = ? AND status = ?", childID, GuardianActive).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// GuardianContacts mengembalikan akun wali aktif dari anak (nama dan email), untuk notifikasi
+func GuardianContacts(db *gorm.DB, childID uint) ([]User, error) {
+	links, err := ActiveGuardians(db, childID)
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.GuardianID)
+	}
+	var guardians []User
+	if err := db.Select("id", "name", "email").Where("id IN ?", ids).Find(&guardians).Error; err != nil {
+		return nil, err
+	}
+	return guardians, nil
+}
+
+// InviteChild mengirim undangan ke email akun anak. Hubungan baru aktif setelah anak
+// login dan menyetujui undangan (AcceptGuardian).
+// Email yang tidak terdaftar, bukan akun anak atau sudah terhubung tidak dibedakan dari
+// undangan yang terkirim, agar endpoint ini tidak bisa dipakai untuk mencari akun anak.
+func (s *userService) InviteChild(guardianID uint, input *InviteChildRequest) error {
+	var guardian User
+	if err := s.db.First(&guardian, guardianID).Error; err != nil {
+		return errors.New("data tidak ditemukan")
+	}
+	now := time.Now()
+	if age, known := guardian.AgeAt(now); !known || age < AgeOfMajority {
+		return fmt.Errorf("hanya akun berumur minimal %d tahun yang dapat menjadi wali", AgeOfMajority)
+	}
+
+	var child User
+	err := s.db.Where("email_index = ?", utils.BlindIndex(input.Email)).First(&child).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if child.ID == guardian.ID {
+		return errors.New("tidak dapat menjadi wali akun sendiri")
+	}
+	if !child.IsMinor(now) {
+		return nil
+	}
+
+	var link Guardianship
+	err = s.db.Where("guardian_id = ? AND child_id = ? AND status IN ?", guardian.ID, child.ID,
+		[]string{GuardianPending, GuardianActive}).First(&link).Error
+	if err == nil && link.Status == GuardianActive {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	// Undangan yang masih pending diperbarui dengan token baru
+	if link.ID == 0 {
+		link.ApprovalCategories = []string{}
+	}
+	link.GuardianID = guardian.ID
+	link.ChildID = child.ID
+	link.Status = GuardianPending
+	link.TokenHash = utils.HashToken(token)
+	link.ExpiresAt = now.Add(GuardianInviteTTL)
+	if err := s.db.Save(&link).Error; err != nil {
+		return err
+	}
+
+	url := token
+	if s.config.GuardianInviteURL != "" {
+		url = s.config.GuardianInviteURL + "?token=" + token
+	}
+	if err := s.mailer.Send(helper.Mail{
+		To:      child.Email,
+		Subject: "Undangan akun wali",
+		Body: fmt.Sprintf("Halo %s,\n\n%s ingin terhubung sebagai wali akun perpustakaan Anda. "+
+			"Wali dapat melihat peminjaman Anda, menyetujui peminjaman kategori buku tertentu "+
+			"dan menerima pemberitahuan keterlambatan.\n\n"+
+			"Login lalu buka link berikut untuk menyetujui:\n%s\n\n"+
+			"Link berlaku selama %s. Abaikan email ini jika Anda tidak mengenal pengirimnya.\n",
+			child.Name, guardian.Name, url, GuardianInviteTTL),
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AcceptGuardian menyetujui undangan wali. Persetujuan (waktu, IP, user agent) disimpan
+// sebagai bukti consent dari akun anak.
+func (s *userService) AcceptGuardian(childID uint, input *AcceptGuardianRequest, meta AuditMeta) (*Guardianship, error) {
+	var link Guardianship
+	if err := s.db.Where("token_hash = ? AND status = ?", utils.HashToken(input.Token), GuardianPending).
+		First(&link).Error; err != nil {
+		return nil, errInvalidGuardianToken
+	}
+	now := time.Now()
+	if link.ChildID != childID || now.After(link.ExpiresAt) {
+		return nil, errInvalidGuardianToken
+	}
+
+	result := s.db.Model(&Guardianship{}).Where("id = ? AND status = ?", link.ID, GuardianPending).
+		Updates(map[string]interface{}{
+			"status":             GuardianActive,
+			"token_hash":         "",
+			"consented_at":       now,
+			"consent_ip":         meta.IP,
+			"consent_user_agent": meta.UserAgent,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidGuardianToken
+	}
+
+	if err := s.db.First(&link, link.ID).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// familyMembers melengkapi hubungan wali dengan nama dan email akun di sisi lain.
+// Nama dan email hanya ditampilkan untuk hubungan yang sudah disetujui anak.
+func (s *userService) familyMembers(links []Guardianship, otherID func(Guardianship) uint) ([]FamilyMember, error) {
+	ids := make([]uint, 0, len(links))
+	for _, link := range links {
+		if link.Status == GuardianActive {
+			ids = append(ids, otherID(link))
+		}
+	}
+
+	var users []User
+	if len(ids) > 0 {
+		if err := s.db.Select("id", "name", "email").Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	members := make([]FamilyMember, 0, len(links))
+	for _, link := range links {
+		u := byID[otherID(link)]
+		members = append(members, FamilyMember{Guardianship: link, Name: u.Name, Email: u.Email})
+	}
+	return members, nil
+}
+
+// GetChildren mengembalikan akun anak yang terhubung atau masih diundang
+func (s *userService) GetChildren(guardianID uint) ([]FamilyMember, error) {
+	var links []Guardianship
+	if err := s.db.Where("guardian_id = ? AND status IN ?", guardianID, []string{GuardianPending, GuardianActive}).
+		Order("id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return s.familyMembers(links, func(g Guardianship) uint { return g.ChildID })
+}
+
+// GetGuardians mengembalikan wali dari akun anak, termasuk undangan yang belum disetujui
+func (s *userService) GetGuardians(childID uint) ([]FamilyMember, error) {
+	var links []Guardianship
+	if err := s.db.Where("child_id = ? AND status IN ?", childID, []string{GuardianPending, GuardianActive}).
+		Order("id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return s.familyMembers(links, func(g Guardianship) uint { return g.GuardianID })
+}
+
+// UnlinkChild memutus hubungan wali atau membatalkan undangan yang belum disetujui
+func (s *userService) UnlinkChild(guardianID, childID uint) error {
+	result := s.db.Model(&Guardianship{}).
+		Where("guardian_id = ? AND child_id = ? AND status IN ?", guardianID, childID, []string{GuardianPending, GuardianActive}).
+		Updates(map[string]interface{}{"status": GuardianRevoked, "token_hash": "", "revoked_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotGuardian
+	}
+	return nil
+}
+
+// RevokeGuardian dipakai akun anak untuk memutus hubungan dengan wali atau menolak undangan
+func (s *userService) RevokeGuardian(childID, guardianID uint) error {
+	result := s.db.Model(&Guardianship{}).
+		Where("guardian_id = ? AND child_id = ? AND status IN ?", guardianID, childID, []string{GuardianPending, GuardianActive}).
+		Updates(map[string]interface{}{"status": GuardianRevoked, "token_hash": "", "revoked_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotGuardian
+	}
+	return nil
+}
+
+// SetApprovalCategories mengatur kategori buku yang wajib disetujui wali sebelum anak meminjam
+func (s *userService) SetApprovalCategories(guardianID, childID uint, input *ApprovalCategoriesRequest) (*Guardianship, error) {
+	link, err := GuardianOf(s.db, guardianID, childID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	categories := make([]string, 0, len(input.Categories))
+	for _, c := range input.Categories {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[strings.ToLower(c)] {
+			continue
+		}
+		seen[strings.ToLower(c)] = true
+		categories = append(categories, c)
+	}
+
+	// Update lewat struct agar serializer json dijalankan
+	link.ApprovalCategories = categories
+	if err := s.db.Model(link).Select("approval_categories").Updates(link).Error; err != nil {
+		return nil, err
+	}
+	return link, nil
+}
@@ -0,0 +1,182 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// Setelah loginBackoffAfter kali gagal berturut-turut, akun dikunci selama
+	// 2^(gagal-loginBackoffAfter) detik, maksimal loginMaxLockout.
+	loginBackoffAfter = 3
+	loginMaxLockout   = 15 * time.Minute
+
+	// Batas percobaan gagal dari satu IP dalam loginIPWindow
+	loginIPMaxFailures = 20
+	loginIPWindow      = 15 * time.Minute
+
+	// Jumlah riwayat login yang ditampilkan
+	loginHistoryLimit = 20
+)
+
+const (
+	loginReasonInvalidPassword = "invalid_password"
+	loginReasonUnknownEmail    = "unknown_email"
+	loginReasonLocked          = "locked"
+	loginReasonIPThrottled     = "ip_throttled"
+	loginReasonSuspended       = "suspended"
+)
+
+// LoginThrottledError dikembalikan Login jika akun terkunci atau IP terlalu banyak gagal
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("terlalu banyak percobaan login, coba lagi dalam %d detik", int(e.RetryAfter.Seconds())+1)
+}
+
+// lockoutDuration menghitung lama penguncian (exponential backoff) setelah failed kali gagal
+func lockoutDuration(failed int) time.Duration {
+	if failed < loginBackoffAfter {
+		return 0
+	}
+	shift := failed - loginBackoffAfter
+	if shift > 10 {
+		return loginMaxLockout
+	}
+	d := time.Second << shift
+	if d > loginMaxLockout {
+		return loginMaxLockout
+	}
+	return d
+}
+
+// checkIPThrottle menolak login jika IP sudah terlalu banyak gagal dalam window terakhir
+func (s *userService) checkIPThrottle(ip string) error {
+	if ip == "" {
+		return nil
+	}
+
+	var failures int64
+	since := time.Now().Add(-loginIPWindow)
+	if err := s.db.Model(&LoginEvent{}).Where("ip = ? AND success = ? AND created_at > ?", ip, false, since).
+		Count(&failures).Error; err != nil {
+		return err
+	}
+	if failures < int64(loginIPMaxFailures) {
+		return nil
+	}
+
+	var oldest LoginEvent
+	if err := s.db.Where("ip = ? AND success = ? AND created_at > ?", ip, false, since).
+		Order("created_at DESC").Offset(loginIPMaxFailures - 1).First(&oldest).Error; err != nil {
+		return &LoginThrottledError{RetryAfter: loginIPWindow}
+	}
+	return &LoginThrottledError{RetryAfter: time.Until(oldest.CreatedAt.Add(loginIPWindow))}
+}
+
+// recordLogin menyimpan login event. Gagal menyimpan tidak menggagalkan login.
+func (s *userService) recordLogin(user *User, email string, meta LoginMeta, success bool, reason string) {
+	event := LoginEvent{
+		Email:     email,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		Success:   success,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record login event: %v", err)
+	}
+}
+
+// registerFailedLogin menaikkan jumlah gagal dan mengunci akun sesuai backoff
+func (s *userService) registerFailedLogin(user *User) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("failed_logins").First(user, user.ID).Error; err != nil {
+			return err
+		}
+		lockout := lockoutDuration(user.FailedLogins)
+		if lockout == 0 {
+			return nil
+		}
+		lockedUntil := time.Now().Add(lockout)
+		user.LockedUntil = &lockedUntil
+		return tx.Model(user).Update("locked_until", lockedUntil).Error
+	})
+}
+
+// resetFailedLogins dipanggil setelah login berhasil
+func (s *userService) resetFailedLogins(user *User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return s.db.Model(user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+}
+
+// GetLoginHistory mengembalikan login event terbaru milik user
+func (s *userService) GetLoginHistory(userID uint) ([]LoginEvent, error) {
+	var events []LoginEvent
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").
+		Limit(loginHistoryLimit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetLoginEvents mengembalikan login event untuk admin, bisa difilter per email atau IP
+func (s *userService) GetLoginEvents(page, limit int, email, ip string) ([]LoginEvent, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := s.db.Model(&LoginEvent{})
+	if email != "" {
+		query = query.Where("email_index = ?", utils.BlindIndex(email))
+	}
+	if ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []LoginEvent
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Unlock membuka kunci akun yang terkunci karena terlalu banyak gagal login
+func (s *userService) Unlock(id string) (*User, error) {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+
+	if err := s.db.Model(&user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error; err != nil {
+		return nil, err
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return &user, nil
+}
@@ -0,0 +1,51 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (c *userController) OIDCProviders(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"data": c.service.OIDCProviders()})
+}
+
+func (c *userController) OIDCLogin(ctx *gin.Context) {
+	url, err := c.service.OIDCLoginURL(ctx.Request.Context(), ctx.Query("provider"))
+	if err != nil {
+		if errors.Is(err, errUnknownProvider) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Gagal menghubungi provider SSO: " + err.Error()})
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, url)
+}
+
+func (c *userController) OIDCCallback(ctx *gin.Context) {
+	if errCode := ctx.Query("error"); errCode != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Login SSO dibatalkan: " + errCode, "description": ctx.Query("error_description")})
+		return
+	}
+
+	state, code := ctx.Query("state"), ctx.Query("code")
+	if state == "" || code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+		return
+	}
+
+	result, challenge, err := c.service.OIDCCallback(ctx.Request.Context(), state, code, loginMeta(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if challenge != nil {
+		ctx.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
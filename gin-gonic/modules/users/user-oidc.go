@@ -0,0 +1,325 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// OIDCStateTTL adalah batas waktu antara redirect ke provider dan callback
+var OIDCStateTTL = 10 * time.Minute
+
+var (
+	errUnknownProvider   = errors.New("unknown oidc provider")
+	errInvalidOIDCState  = errors.New("invalid or expired oidc state")
+	errOIDCEmailRequired = errors.New("provider did not return a verified email")
+)
+
+// oidcProvider melakukan discovery secara lazy agar aplikasi tetap bisa start
+// walaupun issuer belum bisa dihubungi
+type oidcProvider struct {
+	config   OIDCProviderConfig
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery %s: %w", p.config.Name, err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+	}
+}
+
+// loadOIDCProviders membaca daftar provider dari file JSON. Path kosong berarti OIDC tidak aktif.
+func loadOIDCProviders(path string) (map[string]*oidcProvider, error) {
+	providers := make(map[string]*oidcProvider)
+	if path == "" {
+		return providers, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []OIDCProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for _, cfg := range configs {
+		cfg.Name = strings.ToLower(strings.TrimSpace(cfg.Name))
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc provider %q: name, issuer, client_id and redirect_url are required", cfg.Name)
+		}
+		if _, exists := providers[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate oidc provider %q", cfg.Name)
+		}
+		providers[cfg.Name] = &oidcProvider{config: cfg}
+	}
+	return providers, nil
+}
+
+// findProvider mencari provider berdasarkan nama. Nama kosong dipakai jika hanya ada satu provider.
+func (s *userService) findProvider(name string) (*oidcProvider, error) {
+	name = strings.ToLower(name)
+	if name == "" && len(s.oidcProviders) == 1 {
+		for _, p := range s.oidcProviders {
+			return p, nil
+		}
+	}
+	p, ok := s.oidcProviders[name]
+	if !ok {
+		return nil, errUnknownProvider
+	}
+	return p, nil
+}
+
+// OIDCProviders mengembalikan nama provider yang tersedia
+func (s *userService) OIDCProviders() []string {
+	names := make([]string, 0, len(s.oidcProviders))
+	for name := range s.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OIDCLoginURL membuat URL authorize provider (dengan state, nonce dan PKCE)
+func (s *userService) OIDCLoginURL(ctx context.Context, providerName string) (string, error) {
+	p, err := s.findProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	// State kedaluwarsa tidak pernah dipakai lagi, bersihkan sekalian
+	s.db.Where("expires_at < ?", now).Delete(&OIDCState{})
+	if err := s.db.Create(&OIDCState{
+		StateHash:    utils.HashToken(state),
+		Provider:     p.config.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(OIDCStateTTL),
+		CreatedAt:    now,
+	}).Error; err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+type oidcClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // Beberapa provider mengirim string "true"
+	Name          string      `json:"name"`
+}
+
+func (c oidcClaims) verified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// OIDCCallback menukar authorization code, memverifikasi ID token, lalu login seperti Login biasa
+// (termasuk challenge 2FA jika akun memakai 2FA).
+func (s *userService) OIDCCallback(ctx context.Context, state, code string, meta LoginMeta) (*LoginResponse, *TwoFactorChallenge, error) {
+	var st OIDCState
+	if err := s.db.Where("state_hash = ?", utils.HashToken(state)).First(&st).Error; err != nil {
+		return nil, nil, errInvalidOIDCState
+	}
+	// State sekali pakai
+	result := s.db.Where("id = ?", st.ID).Delete(&OIDCState{})
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(st.ExpiresAt) {
+		return nil, nil, errInvalidOIDCState
+	}
+
+	p, err := s.findProvider(st.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(st.CodeVerifier))
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, errors.New("provider did not return an id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != st.Nonce {
+		return nil, nil, errors.New("invalid id_token nonce")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.resolveOIDCUser(p.config.Name, idToken.Subject, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	required, err := s.requires2FA(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.TOTPEnabled || required {
+		challenge, err := s.newChallenge(user, !user.TOTPEnabled)
+		return nil, challenge, err
+	}
+
+	s.recordLogin(user, user.Email, meta, true, "")
+	response, err := s.issueTokens(user, "")
+	return response, nil, err
+}
+
+// resolveOIDCUser mencari user dari identity (provider, subject). Jika belum ada,
+// akun dengan email yang sama dihubungkan, atau akun baru dibuat. Keduanya hanya
+// jika provider menyatakan email sudah terverifikasi.
+func (s *userService) resolveOIDCUser(provider, subject string, claims oidcClaims) (*User, error) {
+	var user User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var identity UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if claims.Email == "" || !claims.verified() {
+			return errOIDCEmailRequired
+		}
+		now := time.Now()
+
+		err = tx.Where("email_index = ?", utils.BlindIndex(claims.Email)).First(&user).Error
+		switch {
+		case err == nil:
+			if user.VerifiedAt == nil {
+				if err := tx.Model(&user).Update("verified_at", now).Error; err != nil {
+					return err
+				}
+				user.VerifiedAt = &now
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.createOIDCUser(tx, &user, claims, now); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&UserIdentity{
+			UserID:    user.ID,
+			Provider:  provider,
+			Subject:   subject,
+			Email:     claims.Email,
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createOIDCUser membuat akun baru untuk login SSO. Password diisi acak sehingga
+// akun hanya bisa login lewat SSO sampai user melakukan reset password.
+func (s *userService) createOIDCUser(tx *gorm.DB, user *User, claims oidcClaims, now time.Time) error {
+	randomPassword, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return err
+	}
+
+	var userRole roles.Role
+	if err := tx.Where("name = ?", roles.RoleUser).First(&userRole).Error; err != nil {
+		return fmt.Errorf("default role not found: %w", err)
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = strings.Split(claims.Email, "@")[0]
+	}
+
+	*user = User{
+		Name:       name,
+		Email:      claims.Email,
+		Password:   hashedPassword,
+		Role:       roles.RoleUser,
+		Roles:      []roles.Role{userRole},
+		VerifiedAt: &now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	return tx.Create(user).Error
+}
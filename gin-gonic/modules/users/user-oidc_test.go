@@ -0,0 +1,300 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	mockProvider = "mock"
+	mockClientID = "library-test"
+	mockKeyID    = "test-key"
+)
+
+// mockIssuer adalah provider OIDC palsu: discovery, JWKS dan token endpoint.
+// ID token yang diterbitkan memakai claims dan nonce yang diset oleh test.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+	claims jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": mockKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss":   m.server.URL,
+			"aud":   mockClientID,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+			"nonce": m.nonce,
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = mockKeyID
+		idToken, err := token.SignedString(m.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "mock-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// login menjalankan alur OIDCLoginURL lalu OIDCCallback dengan claims yang diberikan
+func (m *mockIssuer) login(t *testing.T, s *userService, claims jwt.MapClaims) (*LoginResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	loginURL, err := s.OIDCLoginURL(ctx, mockProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	m.nonce = query.Get("nonce")
+	m.claims = claims
+
+	response, challenge, err := s.OIDCCallback(ctx, query.Get("state"), "mock-code", LoginMeta{IP: "127.0.0.1"})
+	if challenge != nil {
+		t.Fatal("unexpected 2FA challenge")
+	}
+	return response, err
+}
+
+// testDB membuka database PostgreSQL dari TEST_DATABASE_URL dengan key development,
+// test dilewati jika TEST_DATABASE_URL kosong
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	fieldKeys, err := utils.LoadFieldKeyRing(utils.FieldKeyConfig{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetFieldKeyRing(fieldKeys)
+	keys, err := utils.LoadKeyManager(utils.KeyConfig{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetKeyManager(keys)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&roles.Permission{}, &roles.Role{}, &roles.RolePermission{}, &User{}, &roles.UserRole{},
+		&RefreshToken{}, &PasswordResetToken{}, &EmailVerificationToken{}, &LoginEvent{}, &LoginChallenge{},
+		&UserIdentity{}, &OIDCState{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where(roles.Role{Name: roles.RoleUser}).FirstOrCreate(&roles.Role{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testOIDCService membutuhkan database PostgreSQL dari TEST_DATABASE_URL
+func testOIDCService(t *testing.T, issuer *mockIssuer) *userService {
+	t.Helper()
+	db := testDB(t)
+
+	providers := map[string]*oidcProvider{mockProvider: {config: OIDCProviderConfig{
+		Name:        mockProvider,
+		Issuer:      issuer.server.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://localhost/api/v1/auth/oidc/callback",
+	}}}
+	return &userService{db: db, oidcProviders: providers}
+}
+
+// testAccount membuat email dan subject unik, dan menghapus datanya setelah test selesai
+func testAccount(t *testing.T, db *gorm.DB) (email, subject string) {
+	t.Helper()
+	suffix, err := utils.RandomToken(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email = "oidc-" + suffix + "@example.com"
+	subject = "sub-" + suffix
+	t.Cleanup(func() {
+		db.Where("provider = ? AND subject = ?", mockProvider, subject).Delete(&UserIdentity{})
+		var user User
+		if db.Unscoped().Where("email_index = ?", utils.BlindIndex(email)).First(&user).Error == nil {
+			db.Where("user_id = ?", user.ID).Delete(&RefreshToken{})
+			db.Where("user_id = ?", user.ID).Delete(&roles.UserRole{})
+			db.Unscoped().Delete(&user)
+		}
+	})
+	return email, subject
+}
+
+func findIdentity(t *testing.T, db *gorm.DB, subject string) (*UserIdentity, bool) {
+	t.Helper()
+	var identity UserIdentity
+	err := db.Where("provider = ? AND subject = ?", mockProvider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &identity, true
+}
+
+func TestOIDCCallbackCreatesNewUser(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := testOIDCService(t, issuer)
+	email, subject := testAccount(t, s.db)
+
+	response, err := issuer.login(t, s, jwt.MapClaims{
+		"sub": subject, "email": email, "email_verified": true, "name": "Budi Santoso",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Token == "" || response.RefreshToken == "" {
+		t.Error("callback did not issue tokens")
+	}
+	if response.User.Email != email || response.User.Name != "Budi Santoso" {
+		t.Errorf("created user %q <%s>, want Budi Santoso <%s>", response.User.Name, response.User.Email, email)
+	}
+	if response.User.VerifiedAt == nil {
+		t.Error("user created from a verified email is not marked verified")
+	}
+
+	identity, ok := findIdentity(t, s.db, subject)
+	if !ok {
+		t.Fatal("identity was not linked")
+	}
+	if identity.UserID != response.User.ID {
+		t.Errorf("identity linked to user %d, want %d", identity.UserID, response.User.ID)
+	}
+}
+
+func TestOIDCCallbackLinksUserByVerifiedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := testOIDCService(t, issuer)
+	email, subject := testAccount(t, s.db)
+
+	existing := User{Name: "Siti Aminah", Email: email, Password: "unused", Role: roles.RoleUser}
+	if err := s.db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := issuer.login(t, s, jwt.MapClaims{
+		"sub": subject, "email": email, "email_verified": "true", "name": "Siti A.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.User.ID != existing.ID {
+		t.Fatalf("logged in as user %d, want existing user %d", response.User.ID, existing.ID)
+	}
+
+	identity, ok := findIdentity(t, s.db, subject)
+	if !ok {
+		t.Fatal("identity was not linked")
+	}
+	if identity.UserID != existing.ID {
+		t.Errorf("identity linked to user %d, want %d", identity.UserID, existing.ID)
+	}
+
+	var reloaded User
+	if err := s.db.First(&reloaded, existing.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.VerifiedAt == nil {
+		t.Error("linked user is not marked verified")
+	}
+	if reloaded.Name != "Siti Aminah" {
+		t.Errorf("linking changed the name to %q", reloaded.Name)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s := testOIDCService(t, issuer)
+	email, subject := testAccount(t, s.db)
+
+	existing := User{Name: "Andi Wijaya", Email: email, Password: "unused", Role: roles.RoleUser}
+	if err := s.db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := issuer.login(t, s, jwt.MapClaims{
+		"sub": subject, "email": email, "email_verified": false,
+	})
+	if !errors.Is(err, errOIDCEmailRequired) {
+		t.Fatalf("error %v, want %v", err, errOIDCEmailRequired)
+	}
+	if _, ok := findIdentity(t, s.db, subject); ok {
+		t.Error("unverified email was linked to an existing account")
+	}
+}
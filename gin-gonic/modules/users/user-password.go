@@ -0,0 +1,161 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetTTL adalah masa berlaku token reset password
+var PasswordResetTTL = time.Hour
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ForgotPassword mengirim link reset password ke email user.
+// Tidak mengembalikan error jika email tidak terdaftar agar email user tidak bisa ditebak.
+func (s *userService) ForgotPassword(input *ForgotPasswordRequest) error {
+	var user User
+	if err := s.db.Where("email_index = ?", utils.BlindIndex(input.Email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Hanya token terakhir yang berlaku
+		if err := tx.Model(&PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(PasswordResetTTL),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := token
+	if s.config.PasswordResetURL != "" {
+		link = s.config.PasswordResetURL + "?token=" + token
+	}
+	return s.mailer.Send(helper.Mail{
+		To:      user.Email,
+		Subject: "Reset password",
+		Body: fmt.Sprintf("Halo %s,\n\nGunakan link berikut untuk mengatur ulang password Anda:\n%s\n\n"+
+			"Link berlaku selama %s dan hanya dapat dipakai sekali.\n"+
+			"Abaikan email ini jika Anda tidak meminta reset password.\n", user.Name, link, PasswordResetTTL),
+	})
+}
+
+// ResetPassword mengganti password dengan token reset, lalu mencabut semua sesi user
+func (s *userService) ResetPassword(input *ResetPasswordRequest) error {
+	var token PasswordResetToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(input.Token)).First(&token).Error; err != nil {
+		return errInvalidResetToken
+	}
+	now := time.Now()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return errInvalidResetToken
+	}
+
+	var user User
+	if err := s.db.Select("id", "email", "name").First(&user, token.UserID).Error; err != nil {
+		return errInvalidResetToken
+	}
+	if err := utils.ValidatePassword(input.NewPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Kondisi used_at IS NULL mencegah token dipakai dua kali secara bersamaan
+		result := tx.Model(&PasswordResetToken{}).Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+
+		// Reset lewat email juga membuka kunci akun
+		if err := tx.Model(&User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"failed_logins": 0,
+			"locked_until":  nil,
+		}).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, token.UserID, now)
+	})
+}
+
+// ChangePassword mengganti password user yang sedang login.
+// Semua sesi lain dicabut, sesi saat ini mendapat token baru.
+func (s *userService) ChangePassword(userID uint, input *ChangePasswordRequest) (*LoginResponse, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+
+	if !utils.CheckPassword(input.CurrentPassword, user.Password) {
+		return nil, errors.New("current password is incorrect")
+	}
+	if input.NewPassword == input.CurrentPassword {
+		return nil, errors.New("new password must be different from current password")
+	}
+	if err := utils.ValidatePassword(input.NewPassword, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, user.ID, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ambil token_version terbaru untuk token sesi saat ini
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return s.issueTokens(&user, "")
+}
+
+// revokeAllSessions mencabut semua refresh token dan access token milik user
+func revokeAllSessions(tx *gorm.DB, userID uint, now time.Time) error {
+	if err := tx.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+}
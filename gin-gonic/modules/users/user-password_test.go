@@ -0,0 +1,263 @@
+package users
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+const testPassword = "Rak#Buku2025!"
+
+var mailTokenPattern = regexp.MustCompile(`\?token=([0-9a-f]+)`)
+
+// testMailService membuat userService dengan MemoryMailer, membutuhkan TEST_DATABASE_URL
+func testMailService(t *testing.T) (*userService, *helper.MemoryMailer) {
+	t.Helper()
+	db := testDB(t)
+	mailer := helper.NewMemoryMailer()
+	return &userService{db: db, mailer: mailer, config: helper.Config{
+		PasswordResetURL: "http://localhost/reset-password",
+		EmailVerifyURL:   "http://localhost/api/v1/auth/verify",
+	}}, mailer
+}
+
+// testUser membuat user dengan email unik dan menghapus datanya setelah test selesai
+func testUser(t *testing.T, db *gorm.DB, verified bool) *User {
+	t.Helper()
+	suffix, err := utils.RandomToken(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed, err := utils.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{Name: "Dewi Lestari", Email: "mail-" + suffix + "@example.com", Password: hashed, Role: roles.RoleUser}
+	if verified {
+		now := time.Now()
+		user.VerifiedAt = &now
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, model := range []interface{}{&RefreshToken{}, &PasswordResetToken{}, &EmailVerificationToken{}} {
+			db.Where("user_id = ?", user.ID).Delete(model)
+		}
+		db.Unscoped().Delete(user)
+	})
+	return user
+}
+
+// lastMailToken mengambil token dari email terakhir yang dikirim ke alamat to
+func lastMailToken(t *testing.T, mailer *helper.MemoryMailer, to string) string {
+	t.Helper()
+	sent := mailer.Sent()
+	for i := len(sent) - 1; i >= 0; i-- {
+		if sent[i].To != to {
+			continue
+		}
+		match := mailTokenPattern.FindStringSubmatch(sent[i].Body)
+		if match == nil {
+			t.Fatalf("mail %q has no token link", sent[i].Subject)
+		}
+		return match[1]
+	}
+	t.Fatalf("no mail sent to %s", to)
+	return ""
+}
+
+func TestForgotPasswordSendsResetLink(t *testing.T) {
+	s, mailer := testMailService(t)
+	user := testUser(t, s.db, true)
+
+	if err := s.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	token := lastMailToken(t, mailer, user.Email)
+
+	var record PasswordResetToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&record).Error; err != nil {
+		t.Fatal("reset token from the mail is not stored:", err)
+	}
+	if record.UserID != user.ID {
+		t.Errorf("reset token belongs to user %d, want %d", record.UserID, user.ID)
+	}
+
+	// Email tidak terdaftar tidak mengirim apa pun dan tidak mengembalikan error
+	before := len(mailer.Sent())
+	if err := s.ForgotPassword(&ForgotPasswordRequest{Email: "unknown-" + user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.Sent()) != before {
+		t.Error("mail sent for an unknown email")
+	}
+}
+
+func TestResetPasswordIsSingleUse(t *testing.T) {
+	s, mailer := testMailService(t)
+	user := testUser(t, s.db, true)
+
+	if err := s.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	first := lastMailToken(t, mailer, user.Email)
+	if err := s.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	token := lastMailToken(t, mailer, user.Email)
+
+	// Hanya token terakhir yang berlaku
+	if err := s.ResetPassword(&ResetPasswordRequest{Token: first, NewPassword: "Baru#Sekali2025"}); !errors.Is(err, errInvalidResetToken) {
+		t.Errorf("superseded token: error %v, want %v", err, errInvalidResetToken)
+	}
+
+	if err := s.ResetPassword(&ResetPasswordRequest{Token: token, NewPassword: "Baru#Sekali2025"}); err != nil {
+		t.Fatal(err)
+	}
+	var reloaded User
+	if err := s.db.First(&reloaded, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !utils.CheckPassword("Baru#Sekali2025", reloaded.Password) {
+		t.Error("password was not changed")
+	}
+
+	if err := s.ResetPassword(&ResetPasswordRequest{Token: token, NewPassword: "Lagi#Sekali2025"}); !errors.Is(err, errInvalidResetToken) {
+		t.Errorf("second use: error %v, want %v", err, errInvalidResetToken)
+	}
+}
+
+func TestResetPasswordRejectsExpiredToken(t *testing.T) {
+	s, mailer := testMailService(t)
+	user := testUser(t, s.db, true)
+
+	if err := s.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	token := lastMailToken(t, mailer, user.Email)
+	if err := s.db.Model(&PasswordResetToken{}).Where("token_hash = ?", utils.HashToken(token)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ResetPassword(&ResetPasswordRequest{Token: token, NewPassword: "Baru#Sekali2025"}); !errors.Is(err, errInvalidResetToken) {
+		t.Errorf("expired token: error %v, want %v", err, errInvalidResetToken)
+	}
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	s, mailer := testMailService(t)
+	user := testUser(t, s.db, true)
+
+	for _, family := range []string{"laptop", "phone"} {
+		if err := s.db.Create(&RefreshToken{
+			UserID:    user.ID,
+			FamilyID:  family + "-" + user.Email,
+			TokenHash: utils.HashToken(family + user.Email),
+			ExpiresAt: time.Now().Add(time.Hour),
+			CreatedAt: time.Now(),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	lockedUntil := time.Now().Add(time.Hour)
+	if err := s.db.Model(user).Updates(map[string]interface{}{"failed_logins": 5, "locked_until": lockedUntil}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	token := lastMailToken(t, mailer, user.Email)
+	if err := s.ResetPassword(&ResetPasswordRequest{Token: token, NewPassword: "Baru#Sekali2025"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var active int64
+	if err := s.db.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Count(&active).Error; err != nil {
+		t.Fatal(err)
+	}
+	if active != 0 {
+		t.Errorf("%d refresh tokens still active after reset", active)
+	}
+
+	var reloaded User
+	if err := s.db.First(&reloaded, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.TokenVersion != user.TokenVersion+1 {
+		t.Errorf("token_version %d, want %d", reloaded.TokenVersion, user.TokenVersion+1)
+	}
+	if reloaded.FailedLogins != 0 || reloaded.LockedUntil != nil {
+		t.Error("reset did not unlock the account")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	s, mailer := testMailService(t)
+	user := testUser(t, s.db, false)
+
+	if err := s.ResendVerification(&ResendVerificationRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	token := lastMailToken(t, mailer, user.Email)
+
+	if err := s.VerifyEmail(token); err != nil {
+		t.Fatal(err)
+	}
+	var reloaded User
+	if err := s.db.First(&reloaded, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.VerifiedAt == nil {
+		t.Error("email is not marked verified")
+	}
+
+	if err := s.VerifyEmail(token); !errors.Is(err, errInvalidVerifyToken) {
+		t.Errorf("second use: error %v, want %v", err, errInvalidVerifyToken)
+	}
+
+	// Email yang sudah terverifikasi tidak dikirimi link lagi
+	before := len(mailer.Sent())
+	if err := s.ResendVerification(&ResendVerificationRequest{Email: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.Sent()) != before {
+		t.Error("verification mail sent to a verified email")
+	}
+}
+
+func TestVerifyEmailRejectsExpiredToken(t *testing.T) {
+	s, mailer := testMailService(t)
+	user := testUser(t, s.db, false)
+
+	if err := s.sendVerification(user); err != nil {
+		t.Fatal(err)
+	}
+	token := lastMailToken(t, mailer, user.Email)
+	if err := s.db.Model(&EmailVerificationToken{}).Where("token_hash = ?", utils.HashToken(token)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.VerifyEmail(token); !errors.Is(err, errInvalidVerifyToken) {
+		t.Errorf("expired token: error %v, want %v", err, errInvalidVerifyToken)
+	}
+	var reloaded User
+	if err := s.db.First(&reloaded, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.VerifiedAt != nil {
+		t.Error("expired token verified the email")
+	}
+}
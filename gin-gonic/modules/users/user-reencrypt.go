@@ -0,0 +1,161 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// encryptedColumns adalah kolom users yang memakai serializer "encrypted"
+var encryptedColumns = []string{"email", "address", "born_date", "totp_secret"}
+
+type rawUserRow struct {
+	ID         uint
+	Email      sql.NullString
+	Address    sql.NullString
+	BornDate   sql.NullString
+	TOTPSecret sql.NullString
+	EmailIndex sql.NullString
+}
+
+// ReencryptUsers mengenkripsi ulang kolom PII yang masih plaintext atau memakai key lama,
+// dan menghitung ulang blind index email. Diproses per batch berdasarkan ID sehingga aman
+// dijalankan saat aplikasi berjalan dan bisa diulang. Mengembalikan jumlah user yang diperbarui.
+func ReencryptUsers(db *gorm.DB, batchSize int) (int, error) {
+	if batchSize < 1 {
+		batchSize = 500
+	}
+	keys := utils.FieldKeys()
+
+	updated := 0
+	var lastID uint
+	for {
+		// Nilai mentah (belum didekripsi) untuk mengecek kid setiap kolom
+		var rows []rawUserRow
+		if err := db.Table("users").Select("id", "email::text AS email", "address::text AS address",
+			"born_date::text AS born_date", "totp_secret", "email_index").
+			Where("id > ?", lastID).Order("id").Limit(batchSize).Scan(&rows).Error; err != nil {
+			return updated, err
+		}
+		if len(rows) == 0 {
+			return updated, nil
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			if !keys.NeedsReencrypt(row.Email.String) && !keys.NeedsReencrypt(row.Address.String) &&
+				!keys.NeedsReencrypt(row.BornDate.String) && !keys.NeedsReencrypt(row.TOTPSecret.String) && row.EmailIndex.Valid && row.EmailIndex.String != "" {
+				continue
+			}
+
+			// Load lewat model (didekripsi), lalu simpan lagi dengan key aktif. Baris dikunci
+			// sampai update selesai agar perubahan user yang berjalan bersamaan tidak tertimpa.
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var user User
+				if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, row.ID).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Model(&user).Select(append(encryptedColumns, "email_index")).
+					Updates(&user).Error
+			})
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Dihapus permanen setelah batch dibaca
+				continue
+			}
+			if err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+}
+
+// needsReencryption mengecek apakah masih ada user yang belum memiliki blind index
+// (misalnya data lama sebelum kolom email dienkripsi) atau secret TOTP yang masih plaintext
+func needsReencryption(db *gorm.DB) (bool, error) {
+	var count int64
+	err := db.Table("users").Where("email_index IS NULL OR email_index = '' OR (totp_secret <> '' AND totp_secret NOT LIKE ?)",
+		"enc:%").Count(&count).Error
+	return count > 0, err
+}
+
+// emailTables adalah tabel selain users yang menyimpan email terenkripsi dengan blind index
+var emailTables = []string{"login_events", "user_identities"}
+
+type rawEmailRow struct {
+	ID         uint
+	Email      sql.NullString
+	EmailIndex sql.NullString
+}
+
+// ReencryptEmails mengenkripsi ulang kolom email di emailTables dengan key aktif dan
+// mengisi blind index yang belum ada. Update bersyarat pada nilai lama sehingga baris yang
+// berubah bersamaan (misalnya dihapus oleh erasure) tidak tertimpa.
+func ReencryptEmails(db *gorm.DB, batchSize int) (int, error) {
+	if batchSize < 1 {
+		batchSize = 500
+	}
+	keys := utils.FieldKeys()
+
+	updated := 0
+	for _, table := range emailTables {
+		var lastID uint
+		for {
+			var rows []rawEmailRow
+			if err := db.Table(table).Select("id", "email", "email_index").
+				Where("id > ?", lastID).Order("id").Limit(batchSize).Scan(&rows).Error; err != nil {
+				return updated, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, row := range rows {
+				lastID = row.ID
+				if row.Email.String == "" ||
+					(!keys.NeedsReencrypt(row.Email.String) && row.EmailIndex.String != "") {
+					continue
+				}
+
+				plaintext, err := keys.Decrypt(row.Email.String, "email")
+				if err != nil {
+					return updated, fmt.Errorf("%s %d: %w", table, row.ID, err)
+				}
+				encrypted, err := keys.Encrypt(plaintext, "email")
+				if err != nil {
+					return updated, err
+				}
+				result := db.Table(table).Where("id = ? AND email = ?", row.ID, row.Email.String).
+					UpdateColumns(map[string]interface{}{
+						"email":       encrypted,
+						"email_index": keys.BlindIndex(string(plaintext)),
+					})
+				if result.Error != nil {
+					return updated, result.Error
+				}
+				updated += int(result.RowsAffected)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// needsEmailReencryption mengecek apakah emailTables masih berisi email tanpa blind index
+func needsEmailReencryption(db *gorm.DB) (bool, error) {
+	for _, table := range emailTables {
+		var count int64
+		if err := db.Table(table).Where("email <> '' AND (email_index IS NULL OR email_index = '')").
+			Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -2,8 +2,12 @@ package users
 
 import (
 	"log"
+	"time"
 
 	"gin-gonic/helper"
+	"gin-gonic/middlewares"
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -25,31 +29,192 @@ func (s *UserServer) Init() {
 		log.Fatal("Cannot load config:", err)
 	}
 
+	if err := s.db.SetupJoinTable(&User{}, "Roles", &roles.UserRole{}); err != nil {
+		log.Fatal("Failed to setup user_roles join table:", err)
+	}
+
 	if config.AUTO_MIGRATE == "Y" {
-		if err := s.db.AutoMigrate(&User{}); err != nil {
+		// User lama dianggap sudah terverifikasi saat kolom verified_at pertama kali dibuat
+		hadVerifiedAt := s.db.Migrator().HasColumn(&User{}, "verified_at")
+		if err := s.db.AutoMigrate(&User{}, &RefreshToken{}, &PasswordResetToken{}, &EmailVerificationToken{}, &LoginEvent{}, &RecoveryCode{}, &LoginChallenge{}, &UserIdentity{}, &OIDCState{}, &UserAuditLog{}, &Guardianship{}, &roles.UserRole{}); err != nil {
 			log.Printf("Failed to auto migrate User: %v", err)
+		} else if !hadVerifiedAt {
+			if err := s.db.Exec("UPDATE users SET verified_at = created_at WHERE verified_at IS NULL").Error; err != nil {
+				log.Printf("Failed to mark existing users as verified: %v", err)
+			}
+		}
+		// Index plaintext lama, pencarian email sekarang lewat email_index
+		if s.db.Migrator().HasIndex(&LoginEvent{}, "idx_login_events_email") {
+			if err := s.db.Migrator().DropIndex(&LoginEvent{}, "idx_login_events_email"); err != nil {
+				log.Printf("Failed to drop plaintext login event email index: %v", err)
+			}
 		}
 	}
 
-	service := NewUserService(s.db)
+	if err := migrateUserRoles(s.db); err != nil {
+		log.Printf("Failed to migrate user roles: %v", err)
+	}
+
+	// Data lama tanpa blind index belum bisa login, enkripsi sekarang.
+	// Rotasi key berikutnya memakai command cmd/reencrypt.
+	if pending, err := needsReencryption(s.db); err != nil {
+		log.Printf("Failed to check user encryption: %v", err)
+	} else if pending {
+		updated, err := ReencryptUsers(s.db, 500)
+		if err != nil {
+			log.Printf("Failed to encrypt user data: %v", err)
+		}
+		log.Printf("Encrypted PII of %d users", updated)
+	}
+	if pending, err := needsEmailReencryption(s.db); err != nil {
+		log.Printf("Failed to check login event encryption: %v", err)
+	} else if pending {
+		updated, err := ReencryptEmails(s.db, 500)
+		if err != nil {
+			log.Printf("Failed to encrypt login event and identity emails: %v", err)
+		}
+		log.Printf("Encrypted email of %d login events and identities", updated)
+	}
+
+	if assigned, err := assignCardNumbers(s.db); err != nil {
+		log.Printf("Failed to assign library card numbers: %v", err)
+	} else if assigned > 0 {
+		log.Printf("Assigned library card numbers to %d users", assigned)
+	}
+
+	if config.AccessTokenTTL > 0 {
+		utils.AccessTokenTTL = config.AccessTokenTTL
+	}
+	if config.RefreshTokenTTL > 0 {
+		utils.RefreshTokenTTL = config.RefreshTokenTTL
+	}
+	if config.ImpersonationTTL > 0 {
+		ImpersonationTTL = config.ImpersonationTTL
+	}
+	if config.KioskTokenTTL > 0 {
+		KioskTokenTTL = config.KioskTokenTTL
+	}
+	if config.AgeOfMajority > 0 {
+		AgeOfMajority = config.AgeOfMajority
+	}
+	if config.LibraryTimezone != "" {
+		loc, err := time.LoadLocation(config.LibraryTimezone)
+		if err != nil {
+			log.Fatal("Invalid LIBRARY_TIMEZONE:", err)
+		}
+		LibraryLocation = loc
+	}
+
+	if err := utils.SetPasswordHasher(utils.PasswordHasherConfig{
+		Algorithm:     config.PasswordHashAlgo,
+		Argon2Memory:  config.Argon2Memory,
+		Argon2Time:    config.Argon2Time,
+		Argon2Threads: config.Argon2Threads,
+		BcryptCost:    config.BcryptCost,
+	}); err != nil {
+		log.Fatal("Invalid password hash config:", err)
+	}
+
+	policy := utils.DefaultPasswordPolicy
+	if config.PasswordMinLength > 0 {
+		policy.MinLength = config.PasswordMinLength
+	}
+	policy.RequireUpper = config.PasswordRequireUpper == "Y"
+	policy.RequireLower = config.PasswordRequireLower == "Y"
+	policy.RequireDigit = config.PasswordRequireDigit == "Y"
+	policy.RequireSymbol = config.PasswordRequireSymbol == "Y"
+	policy.RejectCommon = config.PasswordAllowCommon != "Y"
+	utils.SetPasswordPolicy(policy)
+
+	if config.EmailVerifyURL == "" {
+		config.EmailVerifyURL = "http://localhost" + config.AppPort + "/" + s.version + "/auth/verify"
+	}
+
+	mailer, err := helper.NewMailer(config)
+	if err != nil {
+		log.Fatal("Cannot create mailer:", err)
+	}
+	service := NewUserService(s.db, mailer, config)
 	controller := NewUserController(service)
 
+	router := middlewares.NewRouter(s.router)
+	canRead := middlewares.RequirePermission(roles.PermUsersRead)
+	canWrite := middlewares.RequirePermission(roles.PermUsersWrite)
+	// Aksi sensitif akun sendiri tidak boleh dilakukan dengan token impersonate
+	selfOnly := middlewares.Authenticated().WithoutImpersonation()
+
 	// Auth routes
-	auth := s.router.Group("/" + s.version + "/auth")
-	auth.POST("/register", controller.Create)
-	auth.POST("/login", controller.Login)
+	auth := router.Group("/" + s.version + "/auth")
+	auth.POST("/register", middlewares.Public(), controller.Create)
+	auth.POST("/login", middlewares.Public(), controller.Login)
+	auth.POST("/refresh", middlewares.Public(), controller.Refresh)
+	auth.POST("/logout", selfOnly, controller.Logout)
+	auth.POST("/forgot-password", middlewares.Public(), controller.ForgotPassword)
+	auth.POST("/reset-password", middlewares.Public(), controller.ResetPassword)
+	auth.POST("/2fa", middlewares.Public(), controller.LoginTwoFactor)
+	auth.POST("/2fa/setup", middlewares.Public(), controller.SetupTwoFactorLogin)
+	auth.GET("/verify", middlewares.Public(), controller.VerifyEmail)
+	auth.GET("/oidc/providers", middlewares.Public(), controller.OIDCProviders)
+	auth.GET("/oidc/login", middlewares.Public(), controller.OIDCLogin)
+	auth.GET("/oidc/callback", middlewares.Public(), controller.OIDCCallback)
+	auth.POST("/resend-verification", middlewares.Public(), controller.ResendVerification)
 
 	// Protected user routes
-	userRoutes := s.router.Group("/" + s.version + "/users")
-	userRoutes.GET("/profile", controller.GetProfile)
-	userRoutes.PUT("/:id", controller.Update)
+	userRoutes := router.Group("/" + s.version + "/users")
+	userRoutes.GET("/profile", middlewares.Authenticated().AllowScope(middlewares.ScopeKiosk), controller.GetProfile)
+	userRoutes.GET("/me/card", middlewares.Authenticated().AllowScope(middlewares.ScopeKiosk), controller.GetCard)
+	userRoutes.GET("/me/card/barcode.png", middlewares.Authenticated(), controller.CardBarcode)
+	userRoutes.GET("/me/card/qr.png", middlewares.Authenticated(), controller.CardQRCode)
+	userRoutes.POST("/me/card/pin", selfOnly, controller.SetCardPIN)
+	userRoutes.POST("/me/password", selfOnly, controller.ChangePassword)
+	userRoutes.GET("/me/logins", middlewares.Authenticated(), controller.GetMyLogins)
+	userRoutes.POST("/me/2fa/enroll", selfOnly, controller.EnrollTwoFactor)
+	userRoutes.GET("/me/2fa/qr.png", selfOnly, controller.TwoFactorQRCode)
+	userRoutes.POST("/me/2fa/verify", selfOnly, controller.VerifyTwoFactor)
+	userRoutes.POST("/me/2fa/recovery-codes", selfOnly, controller.RegenerateRecoveryCodes)
+	userRoutes.POST("/me/2fa/disable", selfOnly, controller.DisableTwoFactor)
+	userRoutes.GET("/me/children", middlewares.Authenticated(), controller.GetChildren)
+	userRoutes.POST("/me/children/invite", selfOnly, controller.InviteChild)
+	userRoutes.DELETE("/me/children/:id", selfOnly, controller.UnlinkChild)
+	userRoutes.PUT("/me/children/:id/approval-categories", selfOnly, controller.SetApprovalCategories)
+	userRoutes.GET("/me/guardians", middlewares.Authenticated(), controller.GetGuardians)
+	userRoutes.POST("/me/guardians/accept", selfOnly, controller.AcceptGuardian)
+	userRoutes.DELETE("/me/guardians/:id", selfOnly, controller.RevokeGuardian)
+	userRoutes.PUT("/:id", middlewares.OwnerOrPermission(middlewares.SelfParam("id"), roles.PermUsersWrite), controller.Update)
 
 	// Admin user management
-	adminUsers := s.router.Group("/" + s.version + "/admin/users")
-	adminUsers.GET("/users", controller.GetList)
-	adminUsers.GET("/all", controller.GetList2)
-	adminUsers.GET("/search", controller.Search)
-	adminUsers.GET("/:id", controller.GetByID)
-	adminUsers.DELETE("/:id", controller.Delete)
-	adminUsers.GET("/stats", controller.GetStats)
+	adminUsers := router.Group("/" + s.version + "/admin/users")
+	adminUsers.GET("/users", canRead, controller.GetList)
+	adminUsers.GET("/all", canRead, controller.GetList2)
+	adminUsers.GET("/search", canRead, controller.Search)
+	adminUsers.GET("/by-card/:number", middlewares.RequirePermission(roles.PermUsersRead, roles.PermLoansCheckout), controller.GetByCard)
+	adminUsers.GET("/:id", canRead, controller.GetByID)
+	adminUsers.DELETE("/:id", canWrite, controller.Delete)
+	adminUsers.GET("/stats", middlewares.RequirePermission(roles.PermStatsRead), controller.GetStats)
+	adminUsers.PUT("/:id/roles", middlewares.RequirePermission(roles.PermRolesManage), controller.SetRoles)
+	adminUsers.GET("/:id/logins", canRead, controller.GetUserLogins)
+	adminUsers.POST("/:id/unlock", canWrite, controller.Unlock)
+	adminUsers.GET("/logins", canRead, controller.GetLoginEvents)
+	adminUsers.GET("/audit", canRead, controller.GetAuditLogs)
+	adminUsers.POST("/:id/suspend", canWrite, controller.Suspend)
+	adminUsers.POST("/:id/reactivate", canWrite, controller.Reactivate)
+	adminUsers.POST("/:id/logout", canWrite, controller.ForceLogout)
+	adminUsers.POST("/:id/card", canWrite, controller.ReissueCard)
+	adminUsers.POST("/:id/impersonate", middlewares.RequirePermission(roles.PermUsersImpersonate).WithoutImpersonation(), controller.Impersonate)
+}
+
+// migrateUserRoles memetakan kolom users.role lama ke tabel user_roles.
+// Hanya user yang belum punya baris di user_roles yang diproses, sehingga aman dijalankan berulang.
+func migrateUserRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE users SET role = LOWER(TRIM(role)) WHERE role <> LOWER(TRIM(role))`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE users SET role = ? WHERE role IS NULL OR role = ''`, roles.RoleUser).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u JOIN roles r ON r.name = u.role
+			WHERE NOT EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id)`).Error
+	})
 }
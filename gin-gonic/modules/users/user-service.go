@@ -1,10 +1,15 @@
 package users
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"gin-gonic/helper"
+	"gin-gonic/modules/roles"
 	"gin-gonic/utils"
 
 	"gorm.io/gorm"
@@ -12,23 +17,69 @@ import (
 
 type UserService interface {
 	Create(input *CreateUserRequest) (*User, error)
-	Update(id string, input *UpdateUserRequest) (*User, error)
+	Update(id string, input *UpdateUserRequest, staff bool) (*User, error)
 	Delete(id string) error
 	GetList(page, limit int, sortBy, order string) ([]User, int64, error)
 	GetList2(page, limit int) ([]User, int64, error)
 	GetByID(id string) (*User, error)
 	Search(query string) ([]User, error)
-	Login(input *LoginRequest) (*LoginResponse, error)
+	Login(input *LoginRequest, meta LoginMeta) (*LoginResponse, *TwoFactorChallenge, error)
+	LoginTwoFactor(input *TwoFactorLoginRequest, meta LoginMeta) (*LoginResponse, error)
+	SetupTwoFactorLogin(input *TwoFactorSetupRequest) (*TwoFactorEnrollResponse, error)
+	Refresh(input *RefreshRequest) (*LoginResponse, error)
+	Logout(userID uint, input *LogoutRequest) error
 	GetProfile(userID uint) (*User, error)
 	GetStats() (*UserStats, error)
+	SetRoles(id string, input *SetRolesRequest, meta AuditMeta) (*User, error)
+	Suspend(id string, input *SuspendUserRequest, meta AuditMeta) (*User, error)
+	Reactivate(id string, meta AuditMeta) (*User, error)
+	ForceLogout(id string, meta AuditMeta) error
+	Impersonate(id string, input *ImpersonateRequest, meta AuditMeta) (*ImpersonationResponse, error)
+	GetAuditLogs(page, limit int, userID uint, action string) ([]UserAuditLog, int64, error)
+	ForgotPassword(input *ForgotPasswordRequest) error
+	ResetPassword(input *ResetPasswordRequest) error
+	ChangePassword(userID uint, input *ChangePasswordRequest) (*LoginResponse, error)
+	VerifyEmail(token string) error
+	ResendVerification(input *ResendVerificationRequest) error
+	GetLoginHistory(userID uint) ([]LoginEvent, error)
+	GetLoginEvents(page, limit int, email, ip string) ([]LoginEvent, int64, error)
+	Unlock(id string) (*User, error)
+	EnrollTwoFactor(userID uint) (*TwoFactorEnrollResponse, error)
+	TwoFactorQRCode(userID uint) ([]byte, error)
+	VerifyTwoFactor(userID uint, input *TwoFactorCodeRequest) ([]string, error)
+	RegenerateRecoveryCodes(userID uint, input *TwoFactorCodeRequest) ([]string, error)
+	DisableTwoFactor(userID uint, input *TwoFactorDisableRequest) error
+	OIDCProviders() []string
+	OIDCLoginURL(ctx context.Context, providerName string) (string, error)
+	OIDCCallback(ctx context.Context, state, code string, meta LoginMeta) (*LoginResponse, *TwoFactorChallenge, error)
+	InviteChild(guardianID uint, input *InviteChildRequest) error
+	AcceptGuardian(childID uint, input *AcceptGuardianRequest, meta AuditMeta) (*Guardianship, error)
+	GetChildren(guardianID uint) ([]FamilyMember, error)
+	GetGuardians(childID uint) ([]FamilyMember, error)
+	UnlinkChild(guardianID, childID uint) error
+	RevokeGuardian(childID, guardianID uint) error
+	SetApprovalCategories(guardianID, childID uint, input *ApprovalCategoriesRequest) (*Guardianship, error)
+	GetCard(userID uint) (*CardResponse, error)
+	CardImage(userID uint, format string) ([]byte, error)
+	SetCardPIN(userID uint, input *SetCardPINRequest) error
+	GetByCard(number string) (*User, error)
+	ReissueCard(id string, meta AuditMeta) (*User, error)
 }
 
 type userService struct {
-	db *gorm.DB
+	db            *gorm.DB
+	mailer        helper.Mailer
+	config        helper.Config
+	oidcProviders map[string]*oidcProvider
 }
 
-func NewUserService(db *gorm.DB) UserService {
-	return &userService{db: db}
+func NewUserService(db *gorm.DB, mailer helper.Mailer, config helper.Config) UserService {
+	providers, err := loadOIDCProviders(config.OIDCConfig)
+	if err != nil {
+		log.Printf("Failed to load OIDC providers, SSO disabled: %v", err)
+		providers = make(map[string]*oidcProvider)
+	}
+	return &userService{db: db, mailer: mailer, config: config, oidcProviders: providers}
 }
 
 func (s *userService) Create(input *CreateUserRequest) (*User, error) {
@@ -38,22 +89,32 @@ func (s *userService) Create(input *CreateUserRequest) (*User, error) {
 	}
 
 	var existing User
-	if err := s.db.Where("email = ?", input.Email).First(&existing).Error; err == nil {
+	if err := s.db.Where("email_index = ?", utils.BlindIndex(input.Email)).First(&existing).Error; err == nil {
 		return nil, errors.New("email already exists")
 	}
 
+	if err := utils.ValidatePassword(input.Password, input.Email, input.Name); err != nil {
+		return nil, err
+	}
+
 	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		return nil, err
 	}
 
+	var userRole roles.Role
+	if err := s.db.Where("name = ?", roles.RoleUser).First(&userRole).Error; err != nil {
+		return nil, fmt.Errorf("default role not found: %w", err)
+	}
+
 	user := &User{
 		Name:      input.Name,
 		Address:   input.Address,
 		Email:     input.Email,
 		Password:  hashedPassword,
 		BornDate:  bornDate,
-		Role:      "user",
+		Role:      roles.RoleUser,
+		Roles:     []roles.Role{userRole},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -62,10 +123,17 @@ func (s *userService) Create(input *CreateUserRequest) (*User, error) {
 		return nil, err
 	}
 
+	// Gagal kirim email tidak membatalkan registrasi, user bisa minta kirim ulang
+	if err := s.sendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	return user, nil
 }
 
-func (s *userService) Update(id string, input *UpdateUserRequest) (*User, error) {
+// Update mengubah data user. Tanggal lahir hanya bisa diubah staf (staff true) karena menentukan
+// batas umur pinjam dan perwalian; user tidak bisa menjadikan dirinya dewasa sendiri.
+func (s *userService) Update(id string, input *UpdateUserRequest, staff bool) (*User, error) {
 	var user User
 	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
 		return nil, errors.New("data tidak ditemukan")
@@ -77,18 +145,25 @@ func (s *userService) Update(id string, input *UpdateUserRequest) (*User, error)
 	if input.Address != "" {
 		user.Address = input.Address
 	}
-	if input.Email != "" {
+	emailChanged := false
+	if input.Email != "" && input.Email != user.Email {
 		var existing User
-		if err := s.db.Where("email = ? AND id <> ?", input.Email, id).First(&existing).Error; err == nil {
+		if err := s.db.Where("email_index = ? AND id <> ?", utils.BlindIndex(input.Email), id).First(&existing).Error; err == nil {
 			return nil, errors.New("email already exists")
 		}
 		user.Email = input.Email
+		// Email baru harus diverifikasi ulang sebelum bisa meminjam lagi
+		user.VerifiedAt = nil
+		emailChanged = true
 	}
 	if input.BornDate != "" {
 		bornDate, err := time.Parse("2006-01-02", input.BornDate)
 		if err != nil {
 			return nil, errors.New("born_date must be in YYYY-MM-DD format")
 		}
+		if !bornDate.Equal(user.BornDate) && !staff {
+			return nil, errBornDateLocked
+		}
 		user.BornDate = bornDate
 	}
 
@@ -98,6 +173,13 @@ func (s *userService) Update(id string, input *UpdateUserRequest) (*User, error)
 		return nil, err
 	}
 
+	if emailChanged {
+		// Seperti registrasi, gagal kirim email tidak membatalkan perubahan; user bisa minta kirim ulang
+		if err := s.sendVerification(&user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
 	return &user, nil
 }
 
@@ -118,12 +200,10 @@ func (s *userService) GetList(page, limit int, sortBy, order string) ([]User, in
 		limit = 10
 	}
 
+	// Kolom terenkripsi (email, address, born_date) tidak bisa diurutkan
 	allowedSort := map[string]bool{
 		"id":         true,
 		"name":       true,
-		"email":      true,
-		"address":    true,
-		"born_date":  true,
 		"created_at": true,
 		"updated_at": true,
 	}
@@ -175,7 +255,7 @@ func (s *userService) GetList2(page, limit int) ([]User, int64, error) {
 
 func (s *userService) GetByID(id string) (*User, error) {
 	var user User
-	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+	if err := s.db.Preload("Roles").Where("id = ?", id).First(&user).Error; err != nil {
 		return nil, errors.New("data tidak ditemukan")
 	}
 
@@ -187,30 +267,205 @@ func (s *userService) Search(query string) ([]User, error) {
 		return nil, errors.New("query parameter q is required")
 	}
 
+	// Email terenkripsi hanya bisa dicari dengan pencocokan persis lewat blind index
 	var users []User
-	if err := s.db.Where("name ILIKE ? OR email ILIKE ?", "%"+query+"%", "%"+query+"%").Find(&users).Error; err != nil {
+	if err := s.db.Where("name ILIKE ? OR email_index = ?", "%"+query+"%", utils.BlindIndex(query)).Find(&users).Error; err != nil {
 		return nil, err
 	}
 
 	return users, nil
 }
 
-func (s *userService) Login(input *LoginRequest) (*LoginResponse, error) {
+// Login memvalidasi password. Jika akun memakai 2FA (atau role-nya mewajibkan 2FA),
+// yang dikembalikan adalah challenge untuk LoginTwoFactor, bukan token.
+func (s *userService) Login(input *LoginRequest, meta LoginMeta) (*LoginResponse, *TwoFactorChallenge, error) {
+	if err := s.checkIPThrottle(meta.IP); err != nil {
+		s.recordLogin(nil, input.Email, meta, false, loginReasonIPThrottled)
+		return nil, nil, err
+	}
+
 	var user User
-	if err := s.db.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		return nil, errors.New("invalid email or password")
+	if err := s.db.Where("email_index = ?", utils.BlindIndex(input.Email)).First(&user).Error; err != nil {
+		s.recordLogin(nil, input.Email, meta, false, loginReasonUnknownEmail)
+		return nil, nil, errors.New("invalid email or password")
+	}
+
+	// Akun terkunci: password tidak dicek sama sekali
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		s.recordLogin(&user, input.Email, meta, false, loginReasonLocked)
+		return nil, nil, &LoginThrottledError{RetryAfter: time.Until(*user.LockedUntil)}
 	}
 
 	if !utils.CheckPassword(input.Password, user.Password) {
-		return nil, errors.New("invalid email or password")
+		s.recordLogin(&user, input.Email, meta, false, loginReasonInvalidPassword)
+		if err := s.registerFailedLogin(&user); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("invalid email or password")
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email, user.Name, user.Role)
+	// Upgrade hash lama (misal bcrypt) ke algoritma/parameter saat ini
+	if utils.NeedsRehash(user.Password) {
+		if hashed, err := utils.HashPassword(input.Password); err == nil {
+			if err := s.db.Model(&user).Update("password", hashed).Error; err != nil {
+				log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	// Dicek setelah password agar status akun tidak bocor ke orang yang tidak tahu password
+	if user.SuspendedAt != nil {
+		s.recordLogin(&user, input.Email, meta, false, loginReasonSuspended)
+		return nil, nil, errAccountSuspended
+	}
+
+	required, err := s.requires2FA(&user)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Counter gagal baru direset setelah semua faktor lolos, supaya password yang benar
+	// tidak membuka kesempatan menebak kode 2FA tanpa batas
+	if user.TOTPEnabled || required {
+		challenge, err := s.newChallenge(&user, !user.TOTPEnabled)
+		return nil, challenge, err
+	}
+	if err := s.resetFailedLogins(&user); err != nil {
+		return nil, nil, err
+	}
+
+	s.recordLogin(&user, input.Email, meta, true, "")
+	response, err := s.issueTokens(&user, "")
+	return response, nil, err
+}
+
+// issueTokens membuat access token dan refresh token baru.
+// familyID kosong berarti sesi login baru.
+func (s *userService) issueTokens(user *User, familyID string) (*LoginResponse, error) {
+	// Semua jalur login (password, 2FA, SSO, refresh) berakhir di sini
+	if user.SuspendedAt != nil {
+		return nil, errAccountSuspended
+	}
+
+	token, err := utils.GenerateJWT(user.ID, user.Email, user.Name, user.Role, user.TokenVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	return &LoginResponse{Token: token, User: user}, nil
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if familyID == "" {
+		if familyID, err = utils.RandomToken(16); err != nil {
+			return nil, err
+		}
+	}
+
+	record := RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	permissions, err := userPermissions(s.db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		User:         *user,
+		Permissions:  permissions,
+	}, nil
+}
+
+func (s *userService) Refresh(input *RefreshRequest) (*LoginResponse, error) {
+	var token RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(input.RefreshToken)).First(&token).Error; err != nil {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil {
+		// Token lama dipakai ulang: kemungkinan dicuri, cabut seluruh sesi ini
+		s.db.Model(&RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", token.FamilyID).
+			Update("revoked_at", now)
+		return nil, errors.New("refresh token has been revoked")
+	}
+	if now.After(token.ExpiresAt) {
+		return nil, errors.New("refresh token expired")
+	}
+
+	var user User
+	if err := s.db.First(&user, token.UserID).Error; err != nil {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	// Sesi lama tanpa 2FA tidak bisa diperpanjang setelah 2FA diwajibkan
+	if !user.TOTPEnabled {
+		required, err := s.requires2FA(&user)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			return nil, err2FARequiredRefresh
+		}
+	}
+
+	// Cabut token lama; kondisi revoked_at IS NULL mencegah dua request memakai token yang sama
+	result := s.db.Model(&RefreshToken{}).Where("id = ? AND revoked_at IS NULL", token.ID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("refresh token has been revoked")
+	}
+
+	return s.issueTokens(&user, token.FamilyID)
+}
+
+// Logout mencabut refresh token dan menaikkan token_version sehingga
+// semua access token user yang masih aktif langsung ditolak.
+// Sesi lain yang refresh token-nya masih berlaku cukup melakukan refresh.
+func (s *userService) Logout(userID uint, input *LogoutRequest) error {
+	now := time.Now()
+	tx := s.db.Begin()
+
+	query := tx.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if !input.All {
+		if input.RefreshToken == "" {
+			tx.Rollback()
+			return errors.New("refresh_token is required")
+		}
+		var token RefreshToken
+		if err := tx.Where("token_hash = ? AND user_id = ?", utils.HashToken(input.RefreshToken), userID).
+			First(&token).Error; err != nil {
+			tx.Rollback()
+			return errors.New("invalid refresh token")
+		}
+		query = query.Where("family_id = ?", token.FamilyID)
+	}
+
+	if err := query.Update("revoked_at", now).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
 func (s *userService) GetProfile(userID uint) (*User, error) {
@@ -253,6 +508,79 @@ func (s *userService) GetStats() (*UserStats, error) {
 	}, nil
 }
 
+// SetRoles mengganti seluruh role user. Role pertama menjadi role utama (users.role)
+// dan token_version dinaikkan agar token lama dengan role lama tidak berlaku lagi.
+func (s *userService) SetRoles(id string, input *SetRolesRequest, meta AuditMeta) (*User, error) {
+	var user User
+	if err := s.db.Preload("Roles").Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errors.New("data tidak ditemukan")
+	}
+
+	names := make([]string, 0, len(input.Roles))
+	seen := make(map[string]bool)
+	for _, name := range input.Roles {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("roles must not be empty")
+	}
+
+	var found []roles.Role
+	if err := s.db.Where("name IN ?", names).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	if len(found) != len(names) {
+		var unknown []string
+		for _, name := range names {
+			exists := false
+			for _, role := range found {
+				if role.Name == name {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				unknown = append(unknown, name)
+			}
+		}
+		return nil, fmt.Errorf("role tidak dikenal: %s", strings.Join(unknown, ", "))
+	}
+
+	// Jangan sampai tidak ada admin sama sekali
+	if user.Role == roles.RoleAdmin && !seen[roles.RoleAdmin] {
+		var admins int64
+		if err := s.db.Model(&User{}).Where("role = ? AND id <> ?", roles.RoleAdmin, user.ID).Count(&admins).Error; err != nil {
+			return nil, err
+		}
+		if admins == 0 {
+			return nil, errors.New("tidak dapat mencabut role admin terakhir")
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Replace(found); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"role":          names[0],
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		return audit(tx, meta, user.ID, AuditSetRoles, "", roleNames(found))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(id)
+}
+
 func (s *userService) String() string {
 	return fmt.Sprintf("userService{db:%v}", s.db)
 }
@@ -0,0 +1,53 @@
+package users
+
+import (
+	"errors"
+
+	"gin-gonic/middlewares"
+
+	"gorm.io/gorm"
+)
+
+type sessionStore struct {
+	db *gorm.DB
+}
+
+// NewSessionStore membuat SessionStore untuk JWTMiddleware dan WebSocket
+func NewSessionStore(db *gorm.DB) middlewares.SessionStore {
+	return &sessionStore{db: db}
+}
+
+func (s *sessionStore) FindSessionUser(userID uint) (*middlewares.SessionUser, error) {
+	var user User
+	err := s.db.Select("id", "role", "token_version", "suspended_at").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := userPermissions(s.db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &middlewares.SessionUser{
+		ID:           user.ID,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		Permissions:  permissions,
+		Suspended:    user.SuspendedAt != nil,
+	}, nil
+}
+
+// userPermissions mengembalikan permission gabungan dari semua role yang dimiliki user
+func userPermissions(db *gorm.DB, userID uint) ([]string, error) {
+	var permissions []string
+	err := db.Table("permissions").Distinct().
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Pluck("permissions.code", &permissions).Error
+	return permissions, err
+}
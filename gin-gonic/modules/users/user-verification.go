@@ -0,0 +1,113 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gin-gonic/helper"
+	"gin-gonic/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// EmailVerificationTTL adalah masa berlaku link verifikasi email
+	EmailVerificationTTL = 24 * time.Hour
+	// verificationResendCooldown membatasi seberapa sering email verifikasi dikirim ulang
+	verificationResendCooldown = time.Minute
+)
+
+var errInvalidVerifyToken = errors.New("invalid or expired verification token")
+
+// sendVerification membuat token verifikasi baru dan mengirim link-nya ke email user
+func (s *userService) sendVerification(user *User) error {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Hanya token terakhir yang berlaku
+		if err := tx.Model(&EmailVerificationToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&EmailVerificationToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(EmailVerificationTTL),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.config.EmailVerifyURL + "?token=" + token
+	return s.mailer.Send(helper.Mail{
+		To:      user.Email,
+		Subject: "Verifikasi email",
+		Body: fmt.Sprintf("Halo %s,\n\nKlik link berikut untuk memverifikasi email Anda:\n%s\n\n"+
+			"Link berlaku selama %s. Anda belum dapat meminjam buku sebelum email diverifikasi.\n",
+			user.Name, link, EmailVerificationTTL),
+	})
+}
+
+// VerifyEmail menandai email user sebagai terverifikasi
+func (s *userService) VerifyEmail(token string) error {
+	if token == "" {
+		return errInvalidVerifyToken
+	}
+
+	var record EmailVerificationToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&record).Error; err != nil {
+		return errInvalidVerifyToken
+	}
+	now := time.Now()
+	if record.UsedAt != nil || now.After(record.ExpiresAt) {
+		return errInvalidVerifyToken
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&EmailVerificationToken{}).Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidVerifyToken
+		}
+
+		return tx.Model(&User{}).Where("id = ? AND verified_at IS NULL", record.UserID).
+			Update("verified_at", now).Error
+	})
+}
+
+// ResendVerification mengirim ulang email verifikasi.
+// Email yang tidak terdaftar atau sudah terverifikasi diabaikan tanpa error.
+func (s *userService) ResendVerification(input *ResendVerificationRequest) error {
+	var user User
+	if err := s.db.Where("email_index = ?", utils.BlindIndex(input.Email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.VerifiedAt != nil {
+		return nil
+	}
+
+	var recent int64
+	if err := s.db.Model(&EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-verificationResendCooldown)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	return s.sendVerification(&user)
+}
@@ -3,32 +3,57 @@ package users
 import (
 	"time"
 
+	"gin-gonic/modules/roles"
+	"gin-gonic/utils"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey;autoIncrement"`
-	Name      string         `json:"name" gorm:"not null"`
-	Address   string         `json:"address"`
-	Email     string         `json:"email" gorm:"unique;not null"`
-	Password  string         `json:"-" gorm:""` // "-" means don't include in JSON, will be set NOT NULL after migration
-	Role      string         `json:"role" gorm:"default:user"`
-	BornDate  time.Time      `json:"born_date" gorm:"column:born_date"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID            uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name          string         `json:"name" gorm:"not null"`
+	Address       string         `json:"address" gorm:"serializer:encrypted"`
+	Email         string         `json:"email" gorm:"not null;serializer:encrypted"`
+	EmailIndex    string         `json:"-" gorm:"uniqueIndex"`     // Blind index email untuk pencarian, diisi BeforeSave
+	Password      string         `json:"-" gorm:""`                // "-" means don't include in JSON, will be set NOT NULL after migration
+	Role          string         `json:"role" gorm:"default:user"` // Role utama, disimpan juga di JWT
+	Roles         []roles.Role   `json:"roles,omitempty" gorm:"many2many:user_roles"`
+	BornDate      time.Time      `json:"born_date" gorm:"column:born_date;type:text;serializer:encrypted"`
+	TokenVersion  int            `json:"-" gorm:"not null;default:0"` // Dinaikkan untuk mencabut semua access token milik user
+	VerifiedAt    *time.Time     `json:"verified_at"`                 // Nil jika email belum diverifikasi
+	FailedLogins  int            `json:"failed_logins" gorm:"not null;default:0"`
+	LockedUntil   *time.Time     `json:"locked_until"`                               // Login ditolak sampai waktu ini
+	TOTPSecret    string         `json:"-" gorm:"type:text;serializer:encrypted"`    // Secret TOTP, terisi sejak enroll
+	TOTPEnabled   bool           `json:"totp_enabled" gorm:"not null;default:false"` // True setelah kode pertama diverifikasi
+	TOTPLastStep  int64          `json:"-" gorm:"not null;default:0"`                // Time step terakhir yang dipakai, mencegah replay
+	SuspendedAt   *time.Time     `json:"suspended_at"`                               // Nil jika akun aktif
+	SuspendReason string         `json:"suspend_reason,omitempty"`
+	CardNumber    string         `json:"card_number" gorm:"uniqueIndex;size:20"` // Nomor kartu anggota, diisi BeforeCreate
+	CardPIN       string         `json:"-"`                                      // Hash PIN untuk login kiosk
+	CardPINFailed int            `json:"-" gorm:"not null;default:0"`            // PIN salah berturut-turut
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (User) TableName() string {
 	return "users"
 }
 
+// BeforeSave mengisi blind index email karena kolom email terenkripsi
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	if u.Email != "" {
+		u.EmailIndex = utils.BlindIndex(u.Email)
+	}
+	return nil
+}
+
 // DTO untuk request Create User
 type CreateUserRequest struct {
 	Name     string `json:"name" binding:"required,min=2,max=100"`
 	Address  string `json:"address"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"` // Aturan panjang/kompleksitas dari password policy
 	BornDate string `json:"born_date" binding:"required" time_format:"2006-01-02"`
 }
 
@@ -40,6 +65,11 @@ type UpdateUserRequest struct {
 	BornDate string `json:"born_date" binding:"omitempty" time_format:"2006-01-02"`
 }
 
+// DTO untuk request Set Roles (role pertama menjadi role utama)
+type SetRolesRequest struct {
+	Roles []string `json:"roles" binding:"required,min=1"`
+}
+
 // DTO untuk request Login
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -48,6 +78,126 @@ type LoginRequest struct {
 
 // Response untuk login (JWT token)
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Masa berlaku access token dalam detik
+	User         User   `json:"user"`
+	// Permission gabungan dari semua role user, dipakai client untuk menampilkan fitur
+	Permissions []string `json:"permissions"`
+	// Hanya diisi sekali saat 2FA baru diaktifkan
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// Response login jika akun memakai 2FA: token akses baru diberikan setelah kode diverifikasi
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	SetupRequired     bool   `json:"setup_required"` // Role wajib 2FA tapi user belum enroll
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+// DTO untuk langkah kedua login (kode TOTP atau recovery code)
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// DTO untuk setup 2FA saat login (role wajib 2FA)
+type TwoFactorSetupRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// Response enroll 2FA
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code"` // data:image/png;base64,...
+}
+
+// DTO untuk verifikasi kode TOTP
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DTO untuk menonaktifkan 2FA
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// DTO untuk request Refresh Token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// DTO untuk request Logout
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"` // true = cabut semua refresh token milik user
+}
+
+// DTO untuk request Forgot Password
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// DTO untuk request Reset Password
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// DTO untuk request Change Password (user yang sedang login)
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// DTO untuk request kirim ulang email verifikasi
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// DTO untuk request Suspend User
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// DTO untuk request Impersonate User. Alasan wajib diisi untuk audit log.
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// DTO untuk mengatur PIN kartu anggota. Password akun wajib untuk konfirmasi.
+type SetCardPINRequest struct {
+	PIN      string `json:"pin" binding:"required,len=6,numeric"`
+	Password string `json:"password" binding:"required"`
+}
+
+// DTO untuk login kiosk dengan nomor kartu anggota dan PIN
+type KioskLoginRequest struct {
+	CardNumber string `json:"card_number" binding:"required,max=20"`
+	PIN        string `json:"pin" binding:"required,len=6,numeric"`
+}
+
+// DTO untuk response login kiosk. Token ber-scope kiosk, tidak ada refresh token.
+type KioskLoginResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expires_in"`
+	User      User   `json:"user"`
+}
+
+// DTO untuk response kartu anggota
+type CardResponse struct {
+	CardNumber string `json:"card_number"`
+	Name       string `json:"name"`
+	PINSet     bool   `json:"pin_set"`
+}
+
+// DTO untuk response Impersonate User. Tidak ada refresh token.
+type ImpersonationResponse struct {
+	Token          string `json:"token"`
+	ExpiresIn      int    `json:"expires_in"`
+	User           User   `json:"user"`
+	ImpersonatedBy uint   `json:"impersonated_by"`
 }
@@ -1,64 +1,74 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// getJWTSecret mengambil JWT secret dari environment variable
-func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Fallback untuk development - GANTI INI DI PRODUCTION!
-		secret = "your-secret-key-change-this-in-production"
-	}
-	return []byte(secret)
+// Masa berlaku token (bisa diubah dari config)
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// GenerateJWT membuat access token untuk user.
+// tokenVersion dibandingkan dengan users.token_version untuk mencabut token lebih awal.
+func GenerateJWT(userID uint, email string, name string, role string, tokenVersion int) (string, error) {
+	return generateJWT(userClaims(userID, email, name, role, tokenVersion), AccessTokenTTL)
 }
 
-// HashPassword menghash password menggunakan bcrypt
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+// GenerateImpersonationJWT membuat access token atas nama user untuk admin (actorID).
+// Admin dicatat di claim "act" (RFC 8693) dan token tidak bisa di-refresh.
+func GenerateImpersonationJWT(userID uint, email string, name string, role string, tokenVersion int, actorID uint, ttl time.Duration) (string, error) {
+	claims := userClaims(userID, email, name, role, tokenVersion)
+	claims["act"] = map[string]interface{}{"sub": strconv.FormatUint(uint64(actorID), 10)}
+	return generateJWT(claims, ttl)
 }
 
-// CheckPassword memverifikasi password dengan hash
-func CheckPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// GenerateScopedJWT membuat access token terbatas (claim "scope"), misalnya untuk kiosk.
+// Token tidak bisa di-refresh dan hanya diterima route yang mengizinkan scope tersebut.
+// kioskID (claim "kiosk_id") mengikat token ke perangkat kiosk yang membuatnya.
+func GenerateScopedJWT(userID uint, email string, name string, role string, tokenVersion int, scope string, kioskID uint, ttl time.Duration) (string, error) {
+	claims := userClaims(userID, email, name, role, tokenVersion)
+	claims["scope"] = scope
+	if kioskID != 0 {
+		claims["kiosk_id"] = kioskID
+	}
+	return generateJWT(claims, ttl)
 }
 
-// GenerateJWT membuat JWT token untuk user
-func GenerateJWT(userID uint, email string, name string, role string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func userClaims(userID uint, email string, name string, role string, tokenVersion int) jwt.MapClaims {
+	return jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
 		"name":    name,
 		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
-		"iat":     time.Now().Unix(),
-	})
+		"ver":     tokenVersion,
+	}
+}
 
-	tokenString, err := token.SignedString(getJWTSecret())
+func generateJWT(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	jti, err := RandomToken(16)
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	claims["jti"] = jti
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	claims["iat"] = time.Now().Unix()
+	return Keys().Sign(claims)
 }
 
 // ValidateJWT memvalidasi JWT token dan mengembalikan claims
 func ValidateJWT(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validasi signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return getJWTSecret(), nil
-	})
+	// Key dipilih berdasarkan header kid, signing method divalidasi oleh KeyManager
+	token, err := jwt.Parse(tokenString, Keys().Keyfunc)
 
 	if err != nil {
 		return nil, err
@@ -71,6 +81,21 @@ func ValidateJWT(tokenString string) (jwt.MapClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
+// RandomToken membuat string acak (hex) sepanjang n byte
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken menghash token (refresh token, ticket, dll) sebelum disimpan di database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetUserIDFromToken mengambil user ID dari JWT token
 func GetUserIDFromToken(tokenString string) (uint, error) {
 	claims, err := ValidateJWT(tokenString)
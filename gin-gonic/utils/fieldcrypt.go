@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix menandai nilai terenkripsi: "enc:<kid>:<base64(nonce+ciphertext)>".
+// Nilai tanpa prefix dianggap plaintext lama dan tetap bisa dibaca sampai dienkripsi ulang.
+const encryptedPrefix = "enc:"
+
+// devFieldKey hanya dipakai jika FIELD_ENCRYPTION_KEYS kosong dan DevMode aktif
+const devFieldKey = "dev-field-key-change-this-in-production"
+
+// FieldKeyConfig berisi konfigurasi enkripsi field dari helper.Config
+type FieldKeyConfig struct {
+	// Keys berformat "kid:base64key" dipisah koma, key AES-256 (32 byte), contoh:
+	// "2025-06:q83v...=,2025-01:Zm9v...="
+	Keys string
+	// ActiveKeyID adalah kid untuk enkripsi data baru, default key pertama
+	ActiveKeyID string
+	// BlindIndexKey (base64, minimal 32 byte) untuk HMAC pencarian. Tidak bisa dirotasi
+	// tanpa menghitung ulang semua blind index.
+	BlindIndexKey string
+	// DevMode mengizinkan key development jika Keys kosong (DEV_MODE=Y)
+	DevMode bool
+}
+
+// FieldKeyRing menyimpan semua key enkripsi field. Data baru dienkripsi dengan key aktif,
+// data lama didekripsi dengan key sesuai kid-nya sehingga key bisa dirotasi bertahap.
+type FieldKeyRing struct {
+	keys      map[string]cipher.AEAD
+	activeKID string
+	indexKey  []byte
+}
+
+var (
+	fieldKeysMu  sync.RWMutex
+	fieldKeyRing *FieldKeyRing // Diisi SetFieldKeyRing saat startup
+)
+
+func devFieldKeyRing() *FieldKeyRing {
+	sum := sha256.Sum256([]byte(devFieldKey))
+	aead, _ := newAEAD(sum[:])
+	index := sha256.Sum256([]byte(devFieldKey + ":index"))
+	return &FieldKeyRing{keys: map[string]cipher.AEAD{"dev": aead}, activeKID: "dev", indexKey: index[:]}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetFieldKeyRing mengganti key ring yang dipakai serializer "encrypted" dan BlindIndex
+func SetFieldKeyRing(r *FieldKeyRing) {
+	fieldKeysMu.Lock()
+	defer fieldKeysMu.Unlock()
+	fieldKeyRing = r
+}
+
+// FieldKeys mengembalikan key ring yang sedang aktif
+func FieldKeys() *FieldKeyRing {
+	fieldKeysMu.RLock()
+	defer fieldKeysMu.RUnlock()
+	if fieldKeyRing == nil {
+		panic("utils: field encryption keys are not loaded, call SetFieldKeyRing first")
+	}
+	return fieldKeyRing
+}
+
+// LoadFieldKeyRing membuat key ring dari konfigurasi
+func LoadFieldKeyRing(cfg FieldKeyConfig) (*FieldKeyRing, error) {
+	if strings.TrimSpace(cfg.Keys) == "" {
+		if !cfg.DevMode {
+			return nil, errors.New("FIELD_ENCRYPTION_KEYS is required (set DEV_MODE=Y to use the development key)")
+		}
+		log.Println("⚠️ FIELD_ENCRYPTION_KEYS kosong, memakai key development karena DEV_MODE=Y. JANGAN dipakai di production!")
+		return devFieldKeyRing(), nil
+	}
+
+	r := &FieldKeyRing{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(cfg.Keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid field key entry, expected kid:base64key")
+		}
+		kid := parts[0]
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("field key %q must be 32 bytes base64", kid)
+		}
+		if _, exists := r.keys[kid]; exists {
+			return nil, fmt.Errorf("duplicate field key id %q", kid)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		r.keys[kid] = aead
+		if r.activeKID == "" {
+			r.activeKID = kid
+		}
+	}
+
+	if cfg.ActiveKeyID != "" {
+		if _, ok := r.keys[cfg.ActiveKeyID]; !ok {
+			return nil, fmt.Errorf("active field key %q not found", cfg.ActiveKeyID)
+		}
+		r.activeKID = cfg.ActiveKeyID
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(cfg.BlindIndexKey)
+	if err != nil || len(indexKey) < 32 {
+		return nil, errors.New("BLIND_INDEX_KEY must be at least 32 bytes base64")
+	}
+	r.indexKey = indexKey
+	return r, nil
+}
+
+// Encrypt mengenkripsi plaintext dengan key aktif. aad mengikat ciphertext ke kolomnya
+// sehingga nilai tidak bisa dipindah ke kolom lain.
+func (r *FieldKeyRing) Encrypt(plaintext []byte, aad string) (string, error) {
+	aead := r.keys[r.activeKID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(aad))
+	return encryptedPrefix + r.activeKID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt mendekripsi nilai dari database. Nilai tanpa prefix dikembalikan apa adanya (plaintext lama).
+func (r *FieldKeyRing) Decrypt(value string, aad string) ([]byte, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return []byte(value), nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid encrypted value")
+	}
+	aead, ok := r.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown field key id %q", parts[0])
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted value")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+}
+
+// NeedsReencrypt mengecek apakah nilai masih plaintext atau dienkripsi dengan key lama
+func (r *FieldKeyRing) NeedsReencrypt(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, encryptedPrefix+r.activeKID+":")
+}
+
+// BlindIndex membuat HMAC deterministik dari nilai (lowercase, tanpa spasi di ujung)
+// sehingga kolom terenkripsi tetap bisa dicari dengan pencocokan persis.
+func (r *FieldKeyRing) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, r.indexKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BlindIndex menghitung blind index dengan key ring aktif
+func BlindIndex(value string) string {
+	return FieldKeys().BlindIndex(value)
+}
+
+// =================================================================
+// GORM serializer: `gorm:"serializer:encrypted"`
+// =================================================================
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer mengenkripsi field string dan time.Time dengan AES-GCM.
+// Nilai kosong disimpan sebagai string kosong. Kolom database bertipe text.
+type EncryptedSerializer struct{}
+
+// Layout untuk tanggal plaintext lama (kolom timestamp yang diubah menjadi text)
+var legacyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+
+	var raw string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	case time.Time:
+		// Kolom belum dimigrasikan ke text
+		raw = v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Errorf("encrypted serializer: unsupported database value %T for %s", dbValue, field.Name)
+	}
+
+	if raw != "" {
+		plaintext, err := FieldKeys().Decrypt(raw, field.DBName)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", field.DBName, err)
+		}
+
+		switch fieldValue.Elem().Interface().(type) {
+		case string:
+			fieldValue.Elem().SetString(string(plaintext))
+		case time.Time:
+			var parsed time.Time
+			var err error
+			for _, layout := range legacyTimeLayouts {
+				if parsed, err = time.Parse(layout, string(plaintext)); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("decrypt %s: invalid time value", field.DBName)
+			}
+			fieldValue.Elem().Set(reflect.ValueOf(parsed))
+		default:
+			return fmt.Errorf("encrypted serializer: unsupported field type %s", field.FieldType)
+		}
+	}
+
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plaintext string
+	switch v := fieldValue.(type) {
+	case string:
+		plaintext = v
+	case time.Time:
+		if !v.IsZero() {
+			plaintext = v.Format(time.RFC3339Nano)
+		}
+	default:
+		return nil, fmt.Errorf("encrypted serializer: unsupported field type %T", fieldValue)
+	}
+
+	if plaintext == "" {
+		return "", nil
+	}
+	return FieldKeys().Encrypt([]byte(plaintext), field.DBName)
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func testKeyRing(t *testing.T, keys, activeKID string) *FieldKeyRing {
+	t.Helper()
+	r, err := LoadFieldKeyRing(FieldKeyConfig{Keys: keys, ActiveKeyID: activeKID, BlindIndexKey: testKey('i')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestFieldKeyRingRoundTrip(t *testing.T) {
+	r := testKeyRing(t, "k1:"+testKey('a'), "")
+
+	encrypted, err := r.Encrypt([]byte("budi@example.com"), "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "enc:k1:") {
+		t.Fatalf("encrypted value %q does not carry the active kid", encrypted)
+	}
+	if strings.Contains(encrypted, "budi") {
+		t.Fatal("encrypted value contains the plaintext")
+	}
+
+	plaintext, err := r.Decrypt(encrypted, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "budi@example.com" {
+		t.Errorf("decrypted %q", plaintext)
+	}
+
+	// aad mengikat ciphertext ke kolomnya
+	if _, err := r.Decrypt(encrypted, "address"); err == nil {
+		t.Error("value encrypted for email decrypted as address")
+	}
+
+	// Plaintext lama dikembalikan apa adanya
+	plaintext, err = r.Decrypt("legacy@example.com", "email")
+	if err != nil || string(plaintext) != "legacy@example.com" {
+		t.Errorf("legacy plaintext = %q, %v", plaintext, err)
+	}
+}
+
+func TestFieldKeyRingRotation(t *testing.T) {
+	old := testKeyRing(t, "old:"+testKey('a'), "")
+	encrypted, err := old.Encrypt([]byte("Jl. Merdeka 1"), "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeyRing(t, "old:"+testKey('a')+",new:"+testKey('b'), "new")
+	if !rotated.NeedsReencrypt(encrypted) {
+		t.Error("value under the old key does not need re-encryption")
+	}
+	plaintext, err := rotated.Decrypt(encrypted, "address")
+	if err != nil || string(plaintext) != "Jl. Merdeka 1" {
+		t.Fatalf("decrypt with rotated ring = %q, %v", plaintext, err)
+	}
+
+	reencrypted, err := rotated.Encrypt(plaintext, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(reencrypted, "enc:new:") || rotated.NeedsReencrypt(reencrypted) {
+		t.Errorf("re-encrypted value %q is not under the active key", reencrypted)
+	}
+	if rotated.NeedsReencrypt("") {
+		t.Error("empty value needs re-encryption")
+	}
+	if !rotated.NeedsReencrypt("plain@example.com") {
+		t.Error("plaintext value does not need re-encryption")
+	}
+
+	// Setelah key lama dihapus, nilai lama tidak bisa dibaca lagi
+	newOnly := testKeyRing(t, "new:"+testKey('b'), "")
+	if _, err := newOnly.Decrypt(encrypted, "address"); err == nil {
+		t.Error("value under a removed key decrypted")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	r := testKeyRing(t, "k1:"+testKey('a'), "")
+
+	index := r.BlindIndex("Budi@Example.com ")
+	if index != r.BlindIndex("budi@example.com") {
+		t.Error("blind index is not case and space insensitive")
+	}
+	if index == r.BlindIndex("siti@example.com") {
+		t.Error("different values share a blind index")
+	}
+
+	// Blind index hanya bergantung pada BlindIndexKey, bukan key enkripsi aktif
+	rotated := testKeyRing(t, "k1:"+testKey('a')+",k2:"+testKey('b'), "k2")
+	if rotated.BlindIndex("budi@example.com") != index {
+		t.Error("blind index changed after rotating the encryption key")
+	}
+
+	other, err := LoadFieldKeyRing(FieldKeyConfig{Keys: "k1:" + testKey('a'), BlindIndexKey: testKey('j')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.BlindIndex("budi@example.com") == index {
+		t.Error("blind index does not depend on BlindIndexKey")
+	}
+}
+
+func TestLoadFieldKeyRingRequiresKeys(t *testing.T) {
+	if _, err := LoadFieldKeyRing(FieldKeyConfig{}); err == nil {
+		t.Error("empty FIELD_ENCRYPTION_KEYS accepted without DevMode")
+	}
+	if _, err := LoadFieldKeyRing(FieldKeyConfig{DevMode: true}); err != nil {
+		t.Errorf("DevMode: %v", err)
+	}
+	if _, err := LoadFieldKeyRing(FieldKeyConfig{Keys: "k1:" + testKey('a')}); err == nil {
+		t.Error("missing BLIND_INDEX_KEY accepted")
+	}
+	if _, err := LoadFieldKeyRing(FieldKeyConfig{Keys: "k1:" + testKey('a'), ActiveKeyID: "k2", BlindIndexKey: testKey('i')}); err == nil {
+		t.Error("unknown active key accepted")
+	}
+}
@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultKeyID dipakai untuk JWT_SECRET dan token lama yang belum memiliki header kid
+const defaultKeyID = "default"
+
+// devSecret hanya dipakai jika tidak ada key sama sekali dan DevMode aktif
+const devSecret = "your-secret-key-change-this-in-production"
+
+// KeyConfig berisi konfigurasi key JWT dari helper.Config
+type KeyConfig struct {
+	// Secret HS256 lama (JWT_SECRET), didaftarkan dengan kid "default"
+	Secret string
+	// Keys berformat "kid:ALG:path" dipisah koma, contoh:
+	// "2025-01:RS256:/keys/rsa.pem,2025-06:EdDSA:/keys/ed25519.pem,old:HS256:/keys/old.secret"
+	// File PEM berisi private key (bisa sign + verify) atau public key (verify saja).
+	// Untuk HS256, file berisi secret.
+	Keys string
+	// SigningKeyID adalah kid yang dipakai untuk membuat token baru
+	SigningKeyID string
+	// DevMode mengizinkan devSecret jika Secret dan Keys kosong (DEV_MODE=Y)
+	DevMode bool
+}
+
+// SigningKey adalah satu key yang dikenal oleh KeyManager
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// CanSign mengecek apakah key memiliki bagian private/secret
+func (k *SigningKey) CanSign() bool {
+	return k.secret != nil || k.private != nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *SigningKey) signKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private
+}
+
+func (k *SigningKey) verifyKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.public
+}
+
+// KeyManager menyimpan semua key aktif. Token ditandatangani dengan satu key
+// (signing key) tetapi divalidasi terhadap semua key, sehingga key bisa dirotasi
+// tanpa membuat token lama langsung tidak berlaku.
+type KeyManager struct {
+	mu         sync.RWMutex
+	keys       map[string]*SigningKey
+	signingKID string
+}
+
+func NewKeyManager() *KeyManager {
+	return &KeyManager{keys: make(map[string]*SigningKey)}
+}
+
+var (
+	keysMu     sync.RWMutex
+	keyManager *KeyManager // Diisi SetKeyManager saat startup
+)
+
+func devKeyManager() *KeyManager {
+	m := NewKeyManager()
+	m.AddKey(&SigningKey{ID: defaultKeyID, Algorithm: "HS256", secret: []byte(devSecret)})
+	m.signingKID = defaultKeyID
+	return m
+}
+
+// SetKeyManager mengganti KeyManager yang dipakai GenerateJWT dan ValidateJWT
+func SetKeyManager(m *KeyManager) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keyManager = m
+}
+
+// Keys mengembalikan KeyManager yang sedang aktif
+func Keys() *KeyManager {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if keyManager == nil {
+		panic("utils: JWT keys are not loaded, call SetKeyManager first")
+	}
+	return keyManager
+}
+
+// LoadKeyManager membuat KeyManager dari konfigurasi
+func LoadKeyManager(cfg KeyConfig) (*KeyManager, error) {
+	m := NewKeyManager()
+
+	if cfg.Secret != "" {
+		m.AddKey(&SigningKey{ID: defaultKeyID, Algorithm: "HS256", secret: []byte(cfg.Secret)})
+	}
+
+	var firstKID string
+	for _, entry := range strings.Split(cfg.Keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, err := loadKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := m.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		m.AddKey(key)
+		if firstKID == "" && key.CanSign() {
+			firstKID = key.ID
+		}
+	}
+
+	if len(m.keys) == 0 {
+		if !cfg.DevMode {
+			return nil, errors.New("JWT_SECRET or JWT_KEYS is required (set DEV_MODE=Y to use the development secret)")
+		}
+		log.Println("⚠️ JWT_SECRET / JWT_KEYS kosong, memakai secret development karena DEV_MODE=Y. JANGAN dipakai di production!")
+		return devKeyManager(), nil
+	}
+
+	signingKID := cfg.SigningKeyID
+	if signingKID == "" {
+		signingKID = firstKID
+	}
+	if signingKID == "" {
+		signingKID = defaultKeyID
+	}
+	if err := m.SetSigningKey(signingKID); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func loadKey(entry string) (*SigningKey, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWT key entry %q, expected kid:ALG:path", entry)
+	}
+	kid, alg, path := parts[0], strings.ToUpper(parts[1]), parts[2]
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key %q: %w", kid, err)
+	}
+
+	key := &SigningKey{ID: kid}
+	switch alg {
+	case "HS256":
+		key.Algorithm = "HS256"
+		key.secret = []byte(strings.TrimSpace(string(data)))
+	case "RS256":
+		key.Algorithm = "RS256"
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.private, key.public = private, &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key.public = public
+		} else {
+			return nil, fmt.Errorf("invalid RSA key %q", kid)
+		}
+	case "EDDSA":
+		key.Algorithm = "EdDSA"
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			signer := private.(ed25519.PrivateKey)
+			key.private, key.public = signer, signer.Public()
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			key.public = public
+		} else {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", kid)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q for key %q", parts[1], kid)
+	}
+
+	return key, nil
+}
+
+// AddKey mendaftarkan key untuk validasi token
+func (m *KeyManager) AddKey(key *SigningKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID] = key
+}
+
+// SetSigningKey memilih key yang dipakai untuk membuat token baru
+func (m *KeyManager) SetSigningKey(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[kid]
+	if !ok {
+		return fmt.Errorf("JWT signing key %q not found", kid)
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("JWT key %q has no private key", kid)
+	}
+	m.signingKID = kid
+	return nil
+}
+
+// Sign menandatangani claims dengan signing key aktif dan menambahkan header kid
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key := m.keys[m.signingKID]
+	m.mu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("no JWT signing key configured")
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey())
+}
+
+// Keyfunc dipakai jwt.Parse untuk memilih key berdasarkan header kid.
+// Token tanpa kid divalidasi dengan key "default" (JWT_SECRET).
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = defaultKeyID
+	}
+
+	m.mu.RLock()
+	key := m.keys[kid]
+	m.mu.RUnlock()
+
+	if key == nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// Algoritma token wajib sama dengan algoritma key (mencegah alg confusion)
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.verifyKey(), nil
+}
+
+// JWK adalah representasi public key sesuai RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet adalah isi /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS mengembalikan semua public key asimetris. Key HS256 tidak pernah dipublikasikan.
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: key.Algorithm,
+				Kid: key.ID,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: key.Algorithm,
+				Kid: key.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
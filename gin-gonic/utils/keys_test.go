@@ -0,0 +1,15 @@
+package utils
+
+import "testing"
+
+func TestLoadKeyManagerRequiresKeys(t *testing.T) {
+	if _, err := LoadKeyManager(KeyConfig{}); err == nil {
+		t.Error("empty JWT_SECRET / JWT_KEYS accepted without DevMode")
+	}
+	if _, err := LoadKeyManager(KeyConfig{DevMode: true}); err != nil {
+		t.Errorf("DevMode: %v", err)
+	}
+	if _, err := LoadKeyManager(KeyConfig{Secret: "a-configured-secret"}); err != nil {
+		t.Errorf("JWT_SECRET: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algoritma hash password yang didukung
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// PasswordHasherConfig mengatur algoritma dan parameter hash untuk password baru.
+// Hash lama dengan algoritma/parameter berbeda tetap bisa diverifikasi dan di-upgrade saat login.
+type PasswordHasherConfig struct {
+	Algorithm     string
+	Argon2Memory  uint32 // KiB
+	Argon2Time    uint32
+	Argon2Threads uint8
+	BcryptCost    int
+}
+
+// DefaultPasswordHasherConfig mengikuti rekomendasi OWASP untuk argon2id
+var DefaultPasswordHasherConfig = PasswordHasherConfig{
+	Algorithm:     HashArgon2id,
+	Argon2Memory:  64 * 1024,
+	Argon2Time:    3,
+	Argon2Threads: 2,
+	BcryptCost:    bcrypt.DefaultCost,
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	hasherMu     sync.RWMutex
+	hasherConfig = DefaultPasswordHasherConfig
+)
+
+// SetPasswordHasher mengganti konfigurasi hash untuk password baru. Nilai kosong memakai default.
+func SetPasswordHasher(cfg PasswordHasherConfig) error {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = DefaultPasswordHasherConfig.Algorithm
+	}
+	if cfg.Algorithm != HashArgon2id && cfg.Algorithm != HashBcrypt {
+		return fmt.Errorf("unsupported password hash algorithm %q", cfg.Algorithm)
+	}
+	if cfg.Argon2Memory == 0 {
+		cfg.Argon2Memory = DefaultPasswordHasherConfig.Argon2Memory
+	}
+	if cfg.Argon2Time == 0 {
+		cfg.Argon2Time = DefaultPasswordHasherConfig.Argon2Time
+	}
+	if cfg.Argon2Threads == 0 {
+		cfg.Argon2Threads = DefaultPasswordHasherConfig.Argon2Threads
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = DefaultPasswordHasherConfig.BcryptCost
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("invalid bcrypt cost %d", cfg.BcryptCost)
+	}
+
+	hasherMu.Lock()
+	hasherConfig = cfg
+	hasherMu.Unlock()
+	return nil
+}
+
+func currentHasher() PasswordHasherConfig {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	return hasherConfig
+}
+
+// HashPassword menghash password dengan algoritma yang sedang dikonfigurasi.
+// Format argon2id: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash> (base64 tanpa padding).
+func HashPassword(password string) (string, error) {
+	cfg := currentHasher()
+	if cfg.Algorithm == HashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Time, cfg.Argon2Memory, cfg.Argon2Threads, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		cfg.Argon2Memory, cfg.Argon2Time, cfg.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword memverifikasi password dengan hash (argon2id atau bcrypt)
+func CheckPassword(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash mengecek apakah hash dibuat dengan algoritma atau parameter lama
+func NeedsRehash(hash string) bool {
+	cfg := currentHasher()
+	if strings.HasPrefix(hash, "$argon2id$") {
+		if cfg.Algorithm != HashArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2(hash)
+		return err != nil || params.Argon2Memory != cfg.Argon2Memory ||
+			params.Argon2Time != cfg.Argon2Time || params.Argon2Threads != cfg.Argon2Threads
+	}
+
+	if cfg.Algorithm != HashBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != cfg.BcryptCost
+}
+
+func decodeArgon2(hash string) (PasswordHasherConfig, []byte, []byte, error) {
+	var params PasswordHasherConfig
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads); err != nil {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	params.Algorithm = HashArgon2id
+	return params, salt, key, nil
+}
+
+// =================================================================
+// Password policy
+// =================================================================
+
+// PasswordPolicy adalah aturan password untuk registrasi dan ganti password
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	RejectCommon   bool // Tolak password yang ada di daftar common-passwords.txt
+	RejectPersonal bool // Tolak password yang mengandung email/nama user
+}
+
+// DefaultPasswordPolicy dipakai jika tidak diubah dari config
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      128,
+	RejectCommon:   true,
+	RejectPersonal: true,
+}
+
+var (
+	policyMu       sync.RWMutex
+	passwordPolicy = DefaultPasswordPolicy
+)
+
+// SetPasswordPolicy mengganti password policy
+func SetPasswordPolicy(policy PasswordPolicy) {
+	policyMu.Lock()
+	passwordPolicy = policy
+	policyMu.Unlock()
+}
+
+//go:embed common-passwords.txt
+var commonPasswordsFile []byte
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]struct{}
+)
+
+func isCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]struct{})
+		scanner := bufio.NewScanner(bytes.NewReader(commonPasswordsFile))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				commonPasswords[strings.ToLower(line)] = struct{}{}
+			}
+		}
+	})
+	_, found := commonPasswords[strings.ToLower(password)]
+	return found
+}
+
+// ValidatePassword memeriksa password terhadap policy.
+// personal berisi data user (email, nama) yang tidak boleh dipakai sebagai password.
+func ValidatePassword(password string, personal ...string) error {
+	policyMu.RLock()
+	policy := passwordPolicy
+	policyMu.RUnlock()
+
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		return fmt.Errorf("password minimal %d karakter", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return fmt.Errorf("password maksimal %d karakter", policy.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper {
+		return errors.New("password harus mengandung huruf besar")
+	}
+	if policy.RequireLower && !lower {
+		return errors.New("password harus mengandung huruf kecil")
+	}
+	if policy.RequireDigit && !digit {
+		return errors.New("password harus mengandung angka")
+	}
+	if policy.RequireSymbol && !symbol {
+		return errors.New("password harus mengandung simbol")
+	}
+
+	if policy.RejectCommon && isCommonPassword(password) {
+		return errors.New("password terlalu umum, gunakan password lain")
+	}
+	if policy.RejectPersonal {
+		lowered := strings.ToLower(password)
+		for _, value := range personal {
+			value = strings.ToLower(strings.TrimSpace(value))
+			if at := strings.Index(value, "@"); at > 0 {
+				value = value[:at]
+			}
+			if len(value) >= 4 && strings.Contains(lowered, value) {
+				return errors.New("password tidak boleh mengandung nama atau email")
+			}
+		}
+	}
+	return nil
+}
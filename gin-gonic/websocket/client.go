@@ -10,6 +10,13 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512
+	sessionPeriod  = time.Minute
+)
+
+// Close code aplikasi (range 4000-4999) yang dikirim saat sesi berakhir
+const (
+	CloseTokenExpired   = 4001
+	CloseSessionRevoked = 4003
 )
 
 // Client merepresentasikan satu koneksi user
@@ -18,6 +25,12 @@ type Client struct {
 	Conn    *websocket.Conn
 	Send    chan []byte
 	UserID  string // Kita simpan ID user agar bisa kirim pesan privat jika perlu
+
+	userID         uint
+	role           string
+	permissions    []string // Dimuat ulang setiap sessionPeriod, dibaca dengan Manager.Mutex
+	tokenVersion   int
+	tokenExpiresAt time.Time
 }
 
 // ReadPump mendengarkan pesan dari frontend (misal: ping/pong)
@@ -40,8 +53,12 @@ func (c *Client) ReadPump() {
 // WritePump mengirim pesan dari server ke frontend
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
+	sessionTicker := time.NewTicker(sessionPeriod)
+	expiry := time.NewTimer(time.Until(c.tokenExpiresAt))
 	defer func() {
 		ticker.Stop()
+		sessionTicker.Stop()
+		expiry.Stop()
 		c.Conn.Close()
 	}()
 	for {
@@ -67,6 +84,35 @@ func (c *Client) WritePump() {
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-expiry.C:
+			c.closeWith(CloseTokenExpired, "token expired")
+			return
+		case <-sessionTicker.C:
+			// Cek ulang apakah token dicabut selama koneksi berjalan
+			session, code, reason := c.Manager.checkSession(c.userID, c.role, c.tokenVersion)
+			if code != 0 {
+				c.closeWith(code, reason)
+				return
+			}
+			if session != nil {
+				c.Manager.setPermissions(c, session.Permissions)
+			}
 		}
 	}
 }
+
+// can mengecek apakah client memiliki permission. Pemanggil wajib memegang Manager.Mutex.
+func (c *Client) can(code string) bool {
+	for _, owned := range c.permissions {
+		if owned == code {
+			return true
+		}
+	}
+	return false
+}
+
+// closeWith mengirim close frame dengan kode dan alasan sebelum koneksi ditutup
+func (c *Client) closeWith(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+}
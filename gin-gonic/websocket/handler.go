@@ -1,39 +1,116 @@
 package websocket
 
 import (
+	"errors"
 	"fmt"
-	"gin-gonic/utils"
+	"gin-gonic/middlewares"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// bearerProtocol adalah subprotocol yang dipakai client untuk mengirim token:
+// new WebSocket(url, ["bearer", token])
+const bearerProtocol = "bearer"
+
+var allowedOrigins []string
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// Mengizinkan koneksi dari domain mana saja (CORS)
-	CheckOrigin: func(r *http.Request) bool {
-		return true 
-	},
+	Subprotocols:    []string{bearerProtocol},
+	CheckOrigin:     checkOrigin,
+}
+
+// SetAllowedOrigins mengatur daftar origin (dipisah koma) yang boleh membuka koneksi WebSocket
+func SetAllowedOrigins(origins string) {
+	allowedOrigins = nil
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+}
+
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Client non-browser tidak mengirim Origin
+		return true
+	}
+
+	// Tanpa allowlist, hanya izinkan origin yang sama dengan host server
+	if len(allowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return strings.EqualFold(u.Host, r.Host)
+	}
+
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate mengambil identitas user dari ticket sekali pakai (?ticket=)
+// atau dari token di header Sec-WebSocket-Protocol
+func authenticate(c *gin.Context) (*ticket, error) {
+	if id := c.Query("ticket"); id != "" {
+		t, ok := tickets.redeem(id)
+		if !ok {
+			return nil, errors.New("invalid or expired ticket")
+		}
+		return &t, nil
+	}
+
+	protocols := websocket.Subprotocols(c.Request)
+	if len(protocols) != 2 || protocols[0] != bearerProtocol {
+		return nil, errors.New("token required")
+	}
+
+	principal, err := middlewares.ParseToken(protocols[1])
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	// Token ber-scope (sesi kiosk) tidak boleh membuka WebSocket
+	if principal.Scope != "" {
+		return nil, errors.New("invalid token")
+	}
+
+	return &ticket{
+		UserID:         principal.UserID,
+		Role:           principal.Role,
+		TokenVersion:   principal.TokenVersion,
+		TokenExpiresAt: principal.ExpiresAt,
+	}, nil
 }
 
 func ServeWS(manager *Manager, c *gin.Context) {
-	// 1. Ambil token dari Query Param: ws://localhost:8080/ws?token=...
-	tokenString := c.Query("token")
-	if tokenString == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
+	// 1. Autentikasi via ticket atau subprotocol (token tidak lagi diterima di query string)
+	auth, err := authenticate(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 2. Validasi Token menggunakan fungsi utils Anda
-	// Fungsi ini sudah sekaligus mengecek validitas token dan mengambil User ID
-	userIDUint, err := utils.GetUserIDFromToken(tokenString)
-	if err != nil {
-		// Jika error, berarti token tidak valid atau expired
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	// 2. Pastikan token belum dicabut sejak dibuat
+	session, code, reason := manager.checkSession(auth.UserID, auth.Role, auth.TokenVersion)
+	if code != 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": reason})
 		return
 	}
+	var permissions []string
+	if session != nil {
+		permissions = session.Permissions
+	}
 
 	// 3. Upgrade koneksi HTTP ke WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -42,12 +119,16 @@ func ServeWS(manager *Manager, c *gin.Context) {
 	}
 
 	// 4. Daftarkan Client ke Manager
-	// Kita ubah userID dari uint ke string agar seragam di struct Client
 	client := &Client{
-		Manager: manager, 
-		Conn:    conn, 
-		Send:    make(chan []byte, 256),
-		UserID:  fmt.Sprintf("%d", userIDUint), // Konversi uint ke string
+		Manager:        manager,
+		Conn:           conn,
+		Send:           make(chan []byte, 256),
+		UserID:         fmt.Sprintf("%d", auth.UserID),
+		userID:         auth.UserID,
+		role:           auth.Role,
+		permissions:    permissions,
+		tokenVersion:   auth.TokenVersion,
+		tokenExpiresAt: auth.TokenExpiresAt,
 	}
 
 	client.Manager.Register <- client
@@ -55,4 +136,4 @@ func ServeWS(manager *Manager, c *gin.Context) {
 	// Jalankan routine baca & tulis
 	go client.WritePump()
 	go client.ReadPump()
-}
\ No newline at end of file
+}
@@ -3,6 +3,8 @@ package websocket
 import (
 	"log"
 	"sync"
+
+	"gin-gonic/middlewares"
 )
 
 type Manager struct {
@@ -22,6 +24,29 @@ func NewManager() *Manager {
 	}
 }
 
+// checkSession memastikan token pemilik koneksi belum dicabut (user dihapus,
+// role berubah, atau logout). Mengembalikan close code 0 jika sesi masih valid,
+// beserta data sesi terbaru (nil jika database sedang error).
+func (m *Manager) checkSession(userID uint, role string, tokenVersion int) (*middlewares.SessionUser, int, string) {
+	session, err := middlewares.LoadSession(userID, role, tokenVersion)
+	if err == nil {
+		return session, 0, ""
+	}
+	if !middlewares.IsSessionError(err) {
+		// Error database sementara tidak boleh memutus koneksi
+		log.Printf("Failed to check websocket session for user %d: %v", userID, err)
+		return nil, 0, ""
+	}
+	return nil, CloseSessionRevoked, err.Error()
+}
+
+// setPermissions memperbarui permission client setelah sesi dicek ulang
+func (m *Manager) setPermissions(client *Client, permissions []string) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	client.permissions = permissions
+}
+
 func (m *Manager) Run() {
 	// =================================================================
 	// SUBSCRIBER REMOVED - MOVED TO EXTERNAL SERVICE
@@ -32,6 +57,7 @@ func (m *Manager) Run() {
 		case client := <-m.Register:
 			m.Mutex.Lock()
 			m.Clients[client] = true
+			m.broadcastPresence()
 			m.Mutex.Unlock()
 			log.Printf("Client Connected: %s", client.UserID)
 
@@ -40,6 +66,7 @@ func (m *Manager) Run() {
 			if _, ok := m.Clients[client]; ok {
 				delete(m.Clients, client)
 				close(client.Send)
+				m.broadcastPresence()
 			}
 			m.Mutex.Unlock()
 			log.Printf("Client Disconnected: %s", client.UserID)
@@ -47,12 +74,7 @@ func (m *Manager) Run() {
 		case message := <-m.Broadcast:
 			m.Mutex.Lock()
 			for client := range m.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(m.Clients, client)
-				}
+				m.deliver(client, message)
 			}
 			m.Mutex.Unlock()
 		}
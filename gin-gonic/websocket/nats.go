@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"gin-gonic/modules/roles"
+
+	"github.com/nats-io/nats.go"
+)
+
+// loanEventTopics adalah topic NATS yang diteruskan ke dashboard sebagai LOAN_EVENT
+var loanEventTopics = []string{"book.borrowed", "book_returned"}
+
+// ForwardNats meneruskan event dari NATS ke client WebSocket.
+// STATS_UPDATE dikirim ke semua client, sedangkan event peminjaman hanya ke user dengan PermLoansRead.
+func (m *Manager) ForwardNats(nc *nats.Conn) {
+	if nc == nil {
+		log.Println("⚠️ WebSocket forwarder batal: NATS Conn is NIL")
+		return
+	}
+
+	if _, err := nc.Subscribe("book.stats", func(msg *nats.Msg) {
+		m.sendToAll(msg.Data)
+	}); err != nil {
+		log.Printf("can't subscribe to book.stats: %v", err)
+	}
+
+	for _, topic := range loanEventTopics {
+		if _, err := nc.Subscribe(topic, func(msg *nats.Msg) {
+			var data map[string]interface{}
+			if err := json.Unmarshal(msg.Data, &data); err != nil {
+				log.Printf("Gagal parsing event %s: %v", msg.Subject, err)
+				return
+			}
+			payload, _ := json.Marshal(map[string]interface{}{
+				"type": "LOAN_EVENT",
+				"data": data,
+				"time": time.Now(),
+			})
+			m.sendToPermission(roles.PermLoansRead, payload)
+		}); err != nil {
+			log.Printf("can't subscribe to %s: %v", topic, err)
+		}
+	}
+}
+
+func (m *Manager) sendToAll(message []byte) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	for client := range m.Clients {
+		m.deliver(client, message)
+	}
+}
+
+func (m *Manager) sendToPermission(code string, message []byte) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	for client := range m.Clients {
+		if client.can(code) {
+			m.deliver(client, message)
+		}
+	}
+}
+
+// deliver mengirim pesan tanpa blocking; client yang buffer-nya penuh diputus.
+// Pemanggil wajib memegang m.Mutex.
+func (m *Manager) deliver(client *Client, message []byte) {
+	select {
+	case client.Send <- message:
+	default:
+		close(client.Send)
+		delete(m.Clients, client)
+	}
+}
+
+// broadcastPresence mengirim daftar user yang sedang terhubung ke client dengan PermUsersRead.
+// Pemanggil wajib memegang m.Mutex.
+func (m *Manager) broadcastPresence() {
+	seen := make(map[string]bool)
+	userIDs := []string{}
+	for client := range m.Clients {
+		if !seen[client.UserID] {
+			seen[client.UserID] = true
+			userIDs = append(userIDs, client.UserID)
+		}
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type": "PRESENCE",
+		"data": map[string]interface{}{
+			"connections": len(m.Clients),
+			"user_ids":    userIDs,
+		},
+		"time": time.Now(),
+	})
+
+	for client := range m.Clients {
+		if client.can(roles.PermUsersRead) {
+			m.deliver(client, payload)
+		}
+	}
+}
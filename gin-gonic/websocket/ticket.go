@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"gin-gonic/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ticketTTL adalah masa berlaku ticket sebelum dipakai untuk membuka koneksi
+const ticketTTL = 30 * time.Second
+
+// ticket menyimpan identitas user yang diambil dari JWT saat ticket dibuat
+type ticket struct {
+	UserID         uint
+	Role           string
+	TokenVersion   int
+	TokenExpiresAt time.Time
+	ExpiresAt      time.Time
+}
+
+type ticketStore struct {
+	mu    sync.Mutex
+	items map[string]ticket
+}
+
+var tickets = &ticketStore{items: make(map[string]ticket)}
+
+func (s *ticketStore) issue(t ticket) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Bersihkan ticket kadaluarsa agar map tidak terus membesar
+	now := time.Now()
+	for k, v := range s.items {
+		if now.After(v.ExpiresAt) {
+			delete(s.items, k)
+		}
+	}
+	s.items[id] = t
+	return id, nil
+}
+
+// redeem mengambil ticket sekaligus menghapusnya, sehingga ticket hanya bisa dipakai sekali
+func (s *ticketStore) redeem(id string) (ticket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.items[id]
+	if !ok {
+		return ticket{}, false
+	}
+	delete(s.items, id)
+	if time.Now().After(t.ExpiresAt) {
+		return ticket{}, false
+	}
+	return t, true
+}
+
+// IssueTicket membuat ticket sekali pakai untuk koneksi WebSocket (POST /ws/ticket).
+// Route ini harus dipasang di belakang JWTMiddleware.
+func IssueTicket(c *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id, err := tickets.issue(ticket{
+		UserID:         principal.UserID,
+		Role:           principal.Role,
+		TokenVersion:   principal.TokenVersion,
+		TokenExpiresAt: principal.ExpiresAt,
+		ExpiresAt:      time.Now().Add(ticketTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     id,
+		"expires_in": int(ticketTTL.Seconds()),
+	})
+}